@@ -45,6 +45,7 @@ func DisconnectErrCallback(ctx context.Context, callbackFn nats.ConnHandler) nat
 			Str("cluster_name", c.ConnectedClusterName()).
 			Str("server_id", c.ConnectedServerId()).
 			Str("server_name", c.ConnectedServerName()).
+			Uint64("reconnects", c.Stats().Reconnects).
 			Msg("disconnected from NATS server")
 	}
 }
@@ -58,6 +59,8 @@ func ReconnectCallback(ctx context.Context, callbackFn nats.ConnHandler) nats.Co
 			Str("cluster_name", c.ConnectedClusterName()).
 			Str("server_id", c.ConnectedServerId()).
 			Str("server_name", c.ConnectedServerName()).
+			Str("server_url", c.ConnectedUrlRedacted()).
+			Uint64("reconnects", c.Stats().Reconnects).
 			Msg("reconnected to NATS server")
 	}
 }
@@ -66,10 +69,12 @@ func ClosedCallback(ctx context.Context) nats.ConnHandler {
 	return func(c *nats.Conn) {
 		sdk.Logger(ctx).
 			Warn().
+			Err(c.LastError()).
 			Str("connection_name", c.Opts.Name).
 			Str("cluster_name", c.ConnectedClusterName()).
 			Str("server_id", c.ConnectedServerId()).
 			Str("server_name", c.ConnectedServerName()).
+			Uint64("reconnects", c.Stats().Reconnects).
 			Msg("connection has been closed")
 	}
 }
@@ -0,0 +1,121 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when records aren't published, because the circuit breaker
+// is open after too many consecutive publish failures.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker makes the writer fail fast instead of publishing once threshold consecutive
+// publishes failed within the window, until the cooldown passes. The publishes after the cooldown
+// probe whether the server is back: a success closes the breaker, a failure opens it again.
+// A nil circuitBreaker is disabled.
+type circuitBreaker struct {
+	threshold int
+	// window is the time the consecutive failures must happen within. If it's zero, it's not limited.
+	window   time.Duration
+	cooldown time.Duration
+
+	mu sync.Mutex
+	// failures is the number of consecutive failures since the firstFailure.
+	failures     int
+	firstFailure time.Time
+	// openUntil is the time the breaker fails fast until. It's zero while the breaker is closed,
+	// once it passes the breaker is half-open.
+	openUntil time.Time
+}
+
+// newCircuitBreaker creates a circuitBreaker, or returns nil if the threshold isn't positive.
+func newCircuitBreaker(threshold int, window, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+
+	return &circuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+	}
+}
+
+// allow returns ErrCircuitOpen if the breaker is open and its cooldown hasn't passed yet.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if remaining := time.Until(b.openUntil); remaining > 0 {
+		return fmt.Errorf("%w, publishing is paused for %s", ErrCircuitOpen, remaining.Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// success closes the breaker and resets the failures.
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// failure counts a failed publish and reports whether it opened the breaker,
+// which happens once the failures reach the threshold or right away if the breaker is half-open.
+func (b *circuitBreaker) failure() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	if !b.openUntil.IsZero() {
+		b.openUntil = now.Add(b.cooldown)
+
+		return true
+	}
+
+	if b.failures == 0 || (b.window > 0 && now.Sub(b.firstFailure) > b.window) {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+
+	if b.failures < b.threshold {
+		return false
+	}
+
+	b.failures = 0
+	b.openUntil = now.Add(b.cooldown)
+
+	return true
+}
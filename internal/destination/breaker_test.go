@@ -0,0 +1,87 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		is := is.New(t)
+
+		b := newCircuitBreaker(0, time.Minute, time.Minute)
+		is.Equal(b, nil)
+
+		is.True(!b.failure())
+		is.NoErr(b.allow())
+	})
+
+	t.Run("opens after consecutive failures", func(t *testing.T) {
+		is := is.New(t)
+
+		b := newCircuitBreaker(3, time.Minute, time.Minute)
+
+		is.True(!b.failure())
+		is.True(!b.failure())
+		// a success in between resets the failures
+		b.success()
+		is.True(!b.failure())
+		is.True(!b.failure())
+		is.NoErr(b.allow())
+
+		is.True(b.failure())
+		is.True(errors.Is(b.allow(), ErrCircuitOpen))
+	})
+
+	t.Run("failures outside the window", func(t *testing.T) {
+		is := is.New(t)
+
+		b := newCircuitBreaker(2, time.Minute, time.Minute)
+
+		is.True(!b.failure())
+		b.firstFailure = time.Now().Add(-2 * time.Minute)
+
+		// the old failure doesn't count
+		is.True(!b.failure())
+		is.True(b.failure())
+	})
+
+	t.Run("half-open after the cooldown", func(t *testing.T) {
+		is := is.New(t)
+
+		b := newCircuitBreaker(1, time.Minute, time.Minute)
+
+		is.True(b.failure())
+		is.True(errors.Is(b.allow(), ErrCircuitOpen))
+
+		// a failure of the probe opens the breaker right away
+		b.openUntil = time.Now().Add(-time.Second)
+		is.NoErr(b.allow())
+		is.True(b.failure())
+		is.True(errors.Is(b.allow(), ErrCircuitOpen))
+
+		// a success of the probe closes it
+		b.openUntil = time.Now().Add(-time.Second)
+		is.NoErr(b.allow())
+		b.success()
+		is.NoErr(b.allow())
+		is.True(b.openUntil.IsZero())
+	})
+}
@@ -19,29 +19,219 @@ package destination
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/conduitio-labs/conduit-connector-nats-jetstream/config"
 	commonscfg "github.com/conduitio/conduit-commons/config"
 	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/nats-io/nats.go"
 )
 
-var errNegativeRetryWait = errors.New("RetryWait can't be a negative value")
+var (
+	errNegativeRetryWait         = errors.New("RetryWait can't be a negative value")
+	errNonPositivePublishTimeout = errors.New("PublishTimeout must be a positive value")
+	errInvalidMsgIDField         = errors.New(`MsgIDField must be one of "key", "payload" or "metadata.<name>"`)
+	errVerifyPublishStream       = errors.New("Stream must be set to verify publishes")
+	errVerifyPublishAsync        = errors.New("VerifyPublish can't be used in the async mode")
+	errVerifyPublishPubSub       = errors.New("VerifyPublish can't be used in the pubsub mode")
+	errDeadLetterAsync           = errors.New("DeadLetterSubject can't be used in the async mode")
+	errDeadLetterPubSub          = errors.New("DeadLetterSubject can't be used in the pubsub mode")
+	errKVBucketAsync             = errors.New("KVBucket can't be used in the async mode")
+	errKVBucketPubSub            = errors.New("KVBucket can't be used in the pubsub mode")
+	errObjectStoreAsync          = errors.New("ObjectStoreBucket can't be used in the async mode")
+	errObjectStorePubSub         = errors.New("ObjectStoreBucket can't be used in the pubsub mode")
+	errObjectStoreKVBucket       = errors.New("ObjectStoreBucket can't be combined with the KVBucket")
+	errNegativeCompressThreshold = errors.New("CompressThreshold can't be a negative value")
+	errCompressGzipEncoding      = errors.New(`CompressThreshold can't be combined with the "gzip" PayloadEncoding`)
+	errCompressBucket            = errors.New(
+		"CompressThreshold can't be combined with the KVBucket or the ObjectStoreBucket",
+	)
+	errExpectedSeqPubSub = errors.New("expected last sequences can't be used in the pubsub mode")
+	errExpectedSeqBucket = errors.New(
+		"expected last sequences can't be combined with the KVBucket or the ObjectStoreBucket",
+	)
+	errNegativePartitions = errors.New("Partitions can't be a negative value")
+	errPartitionsBucket   = errors.New(
+		"Partitions can't be combined with the KVBucket or the ObjectStoreBucket",
+	)
+	errInvalidEmptyKeyPartition = errors.New(
+		`EmptyKeyPartition must be "round-robin" or a partition index less than the Partitions`,
+	)
+	errPayloadFieldBucket = errors.New(
+		"PayloadField can't be combined with the KVBucket or the ObjectStoreBucket",
+	)
+	errNegativeBreakerThreshold = errors.New("BreakerThreshold can't be a negative value")
+	errNegativeBreakerWindow    = errors.New("BreakerWindow can't be a negative value")
+	errBreakerCooldown          = errors.New("BreakerCooldown must be a positive value")
+	errBreakerMode              = errors.New("BreakerThreshold can't be used in the async or the pubsub mode, " +
+		"or with the KVBucket or the ObjectStoreBucket")
+	errNegativeAsyncMaxPending   = errors.New("PublishAsyncMaxPending can't be a negative value")
+	errNonPositiveAsyncStallWait = errors.New("PublishAsyncStallWait must be a positive value")
+	errOnDeleteBucket            = errors.New(
+		`OnDelete can't be combined with the KVBucket or the ObjectStoreBucket, unless it's "publish"`,
+	)
+)
 
 // Config holds destination specific configurable values.
 type Config struct {
 	config.Config
 
+	// Mode defines whether the connector publishes messages to JetStream ("jetstream")
+	// or to core NATS ("pubsub"). Messages published to core NATS are fire-and-forget,
+	// they're not acknowledged, retried or deduplicated, so the RetryWait, RetryAttempts,
+	// Async and MaxPendingAsync are ignored.
+	Mode string `json:"mode" validate:"inclusion=jetstream|pubsub" default:"jetstream"`
+	// ValidateOnOpen makes the connector check that records can be written when it starts,
+	// without writing any, and fail to start otherwise. "check" checks the connection and that
+	// a stream, which is the Stream if it's set, captures the Subject. "publish" additionally
+	// publishes an empty message with the Conduit-Validate header to the Subject, which proves
+	// the subject is publishable, but stores the message in the stream. "none" checks nothing.
+	ValidateOnOpen string `json:"validateOnOpen" validate:"inclusion=none|check|publish" default:"none"`
 	// RetryWait is the retry wait time after a failure to send a message.
 	RetryWait time.Duration `json:"retryWait" default:"5s"`
 	// RetryAttempts is the number of attempts to send a message after a failure.
 	RetryAttempts int `json:"retryAttempts" validate:"greater-than=0" default:"3"`
+	// PublishTimeout is the maximum amount of time a synchronously written record waits for
+	// its acknowledgement. It includes all the retries, so it should be greater than
+	// RetryWait multiplied by RetryAttempts, otherwise the publish fails before retries are exhausted.
+	PublishTimeout time.Duration `json:"publishTimeout" default:"10s"`
+	// BreakerThreshold is the number of consecutive publish failures, e.g. while the server is down,
+	// within the BreakerWindow which make the connector stop publishing for the BreakerCooldown.
+	// Writes fail fast in the meantime, instead of waiting for the retries to time out. Once the cooldown
+	// passes, the next publish probes the server, closing the breaker if it succeeds or opening it again
+	// otherwise. If it's not set, the connector always publishes. It can't be used in the async or the
+	// pubsub mode, or with the KVBucket or the ObjectStoreBucket.
+	BreakerThreshold int `json:"breakerThreshold"`
+	// BreakerWindow is the time the consecutive publish failures must happen within to stop publishing.
+	// If it's zero, it's not limited.
+	BreakerWindow time.Duration `json:"breakerWindow" default:"1m"`
+	// BreakerCooldown is the time the connector stops publishing for once the BreakerThreshold is reached.
+	BreakerCooldown time.Duration `json:"breakerCooldown" default:"30s"`
+	// MetadataHeaders defines which record metadata is written as NATS message headers.
+	// "prefixed" writes only the metadata under the "nats.header." prefix, without the prefix,
+	// "all" writes all the metadata and "none" doesn't write any headers.
+	MetadataHeaders string `json:"metadataHeaders" validate:"inclusion=none|prefixed|all" default:"prefixed"`
+	// Async makes the connector publish messages without waiting for their acknowledgements.
+	// Records are reported as written as soon as they're published, failed publishes
+	// are reported by the next write or when the connector stops.
+	Async bool `json:"async" default:"false"`
+	// MaxPendingAsync is the maximum number of pending acknowledgements in the async mode.
+	// Writing blocks until all pending acknowledgements are received once it's reached.
+	MaxPendingAsync int `json:"maxPendingAsync" validate:"greater-than=0" default:"4000"`
+	// PublishAsyncMaxPending is the maximum number of pending acknowledgements the NATS client allows
+	// in the async mode, publishing stalls once it's reached. The connector waits for the pending
+	// acknowledgements at the MaxPendingAsync first, so it matters only if it's lower.
+	// If it's not set, the MaxPendingAsync is used.
+	PublishAsyncMaxPending int `json:"publishAsyncMaxPending"`
+	// PublishAsyncStallWait is the maximum time publishing waits for pending acknowledgements
+	// in the async mode, once the MaxPendingAsync or the PublishAsyncMaxPending is reached.
+	// Writing fails once it's exceeded.
+	PublishAsyncStallWait time.Duration `json:"publishAsyncStallWait" default:"30s"`
+	// MsgIDField defines where the Nats-Msg-Id header used by the server to deduplicate
+	// messages is taken from. "key" takes the record key, "payload" a hash of the record payload
+	// and "metadata.<name>" the record metadata field <name>. If it's not set,
+	// messages are not deduplicated.
+	MsgIDField string `json:"msgIDField"`
+	// SubjectTemplate is a Go template evaluated against every record to determine the subject
+	// it's published to, e.g. "events.{{.Metadata.tenant}}.{{.Operation}}". A record referencing
+	// a missing metadata field fails to be written. If it's not set, all the records are published
+	// to the Subject.
+	SubjectTemplate string `json:"subjectTemplate"`
+	// Partitions is the number of partitions records are spread across, so consumers can be scaled
+	// by subject. If it's greater than 1, the index of a partition determined by a hash of the record key
+	// is appended to the subject, e.g. "events.0" to "events.3" for 4 partitions, so records with
+	// the same key always end up in the same partition.
+	Partitions int `json:"partitions"`
+	// EmptyKeyPartition is the partition records without a key are published to if the Partitions
+	// are set. It's either the index of a partition or "round-robin", which spreads them across
+	// all the partitions in turns.
+	EmptyKeyPartition string `json:"emptyKeyPartition" default:"round-robin"`
+	// VerifyPublish makes the connector check that every message is acknowledged by the Stream.
+	// Writing a record fails if the message is stored in a different stream.
+	// It can't be used in the async mode.
+	VerifyPublish bool `json:"verifyPublish" default:"false"`
+	// Stream is the name of the stream expected to store the messages. It's required by VerifyPublish.
+	Stream string `json:"stream"`
+	// PayloadField is a dot separated path to a field of the structured record payload, e.g. "data.body",
+	// whose value is published instead of the whole record. String values are published as they are
+	// and the other values as JSON. Raw payloads are parsed as JSON objects. A record without the field
+	// fails to be written, unless SkipMissingPayloadField is set. If it's not set, the whole record is published.
+	PayloadField string `json:"payloadField"`
+	// SkipMissingPayloadField makes the connector skip the records without the PayloadField instead of failing.
+	SkipMissingPayloadField bool `json:"skipMissingPayloadField" default:"false"`
+	// OnDelete defines how delete records, which usually don't have a payload, are published.
+	// "publish" publishes them like any other record, "tombstone" publishes a message with an empty
+	// payload and the "Conduit-Deleted: true" header, "skip" skips them and "error" fails to write them.
+	// KV buckets and object stores always delete the keys of delete records.
+	OnDelete string `json:"onDelete" validate:"inclusion=publish|tombstone|skip|error" default:"publish"`
+	// PayloadEncoding defines how message payloads are encoded before they're published.
+	PayloadEncoding string `json:"payloadEncoding" validate:"inclusion=none|base64|gzip" default:"none"`
+	// CompressThreshold is the size in bytes from which payloads are compressed using gzip, after they're
+	// encoded, and published with the "Content-Encoding: gzip" header, which makes the source decompress them.
+	// Smaller payloads aren't worth the compression overhead, so they're published as they are, and so are
+	// payloads which the compression wouldn't make smaller. If it's not set payloads aren't compressed.
+	CompressThreshold int `json:"compressThreshold"`
+	// DeadLetterSubject is a subject records which fail to be published are published to instead,
+	// with the error in the Conduit-Dead-Letter-Reason header and the original subject in the
+	// Conduit-Dead-Letter-Subject header. Writing a record fails only if it also fails to be published
+	// to the DeadLetterSubject. It can't be used in the async or the pubsub mode.
+	DeadLetterSubject string `json:"deadLetterSubject"`
+	// CreatedAtHeader is the name of a header the record creation time (the opencdc.createdAt
+	// metadata field) is written to, as nanoseconds since the Unix epoch, e.g. "Conduit-Created-At".
+	// Records without a valid creation time are published without the header.
+	// If it's not set, the creation time is not written.
+	CreatedAtHeader string `json:"createdAtHeader"`
+	// SourcePositionHeader makes the connector write the base64 encoded record position
+	// to the Conduit-Source-Position header of every message, to trace messages back to
+	// the records they were published from.
+	SourcePositionHeader bool `json:"sourcePositionHeader" default:"false"`
+	// BeforeHeader makes the connector write the base64 encoded payload before the change
+	// of update records to the Conduit-Before header, which the source's BeforeHeader option
+	// reads back into update records. Records without the payload before the change are
+	// published without the header.
+	BeforeHeader bool `json:"beforeHeader" default:"false"`
+	// ExpectedLastSeqMetadata is the name of a record metadata field holding the sequence the last
+	// message of the stream is expected to have, e.g. "expected-seq". If the stream's last sequence
+	// is different, the message isn't stored and writing the record fails. Records without the field
+	// are published without the expectation. It can't be used in the pubsub mode.
+	ExpectedLastSeqMetadata string `json:"expectedLastSeqMetadata"`
+	// ExpectedLastSubjectSeqMetadata is the name of a record metadata field holding the sequence
+	// the last message published to the same subject is expected to have, with "0" meaning
+	// there's no such message. If it's different, the message isn't stored and writing the record
+	// fails. Records without the field are published without the expectation.
+	// It can't be used in the pubsub mode.
+	ExpectedLastSubjectSeqMetadata string `json:"expectedLastSubjectSeqMetadata"`
+	// KVBucket makes the connector write records to the KV bucket instead of publishing them
+	// to the Subject. Delete records delete their keys and the other records put their
+	// payloads under their keys. Records without a key fail to be written.
+	// It can't be used in the async or the pubsub mode.
+	KVBucket string `json:"kvBucket"`
+	// KVAutoCreateBucket makes the connector create the KVBucket if it doesn't exist.
+	KVAutoCreateBucket bool `json:"kvAutoCreateBucket" default:"false"`
+	// KVPurgeDeletes makes the connector purge the keys of delete records, which removes
+	// all their revisions, instead of deleting them.
+	KVPurgeDeletes bool `json:"kvPurgeDeletes" default:"false"`
+	// ObjectStoreBucket makes the connector write records to the object store instead of
+	// publishing them to the Subject, which suits payloads too large for a single message.
+	// Delete records delete the objects named by their keys and the other records put their
+	// payloads into the objects, overwriting them. Records without a key fail to be written.
+	// It can't be used in the async or the pubsub mode.
+	ObjectStoreBucket string `json:"objectStoreBucket"`
+	// ObjectStoreAutoCreate makes the connector create the ObjectStoreBucket if it doesn't exist.
+	ObjectStoreAutoCreate bool `json:"objectStoreAutoCreate" default:"false"`
+	// BucketStorage is the storage type of the KVBucket or the ObjectStoreBucket created by
+	// the KVAutoCreateBucket or the ObjectStoreAutoCreate. Memory storage is faster, but
+	// the data is lost once the server restarts, so it suits ephemeral pipelines.
+	BucketStorage string `json:"bucketStorage" validate:"inclusion=file|memory" default:"file"`
 }
 
 func ParseConfig(ctx context.Context, cfg commonscfg.Config, parameters commonscfg.Parameters) (Config, error) {
 	parsedCfg := Config{
 		Config: config.Config{
-			ConnectionName: sdk.ConnectorIDFromContext(ctx),
+			ConnectionName: config.DefaultConnectionName("destination", sdk.ConnectorIDFromContext(ctx)),
 		},
 	}
 
@@ -69,5 +259,163 @@ func (c *Config) Validate() error {
 		errs = append(errs, errNegativeRetryWait)
 	}
 
+	if c.PublishTimeout <= 0 {
+		errs = append(errs, errNonPositivePublishTimeout)
+	}
+
+	if c.PublishAsyncMaxPending < 0 {
+		errs = append(errs, errNegativeAsyncMaxPending)
+	}
+
+	if c.PublishAsyncStallWait <= 0 {
+		errs = append(errs, errNonPositiveAsyncStallWait)
+	}
+
+	if !isValidMsgIDField(c.MsgIDField) {
+		errs = append(errs, errInvalidMsgIDField)
+	}
+
+	if c.VerifyPublish && c.Stream == "" {
+		errs = append(errs, errVerifyPublishStream)
+	}
+
+	if err := c.validateBreaker(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.VerifyPublish && c.Async {
+		errs = append(errs, errVerifyPublishAsync)
+	}
+
+	if c.VerifyPublish && c.Mode == modePubSub {
+		errs = append(errs, errVerifyPublishPubSub)
+	}
+
+	if c.DeadLetterSubject != "" && c.Async {
+		errs = append(errs, errDeadLetterAsync)
+	}
+
+	if c.DeadLetterSubject != "" && c.Mode == modePubSub {
+		errs = append(errs, errDeadLetterPubSub)
+	}
+
+	if c.KVBucket != "" && c.Async {
+		errs = append(errs, errKVBucketAsync)
+	}
+
+	if c.KVBucket != "" && c.Mode == modePubSub {
+		errs = append(errs, errKVBucketPubSub)
+	}
+
+	if c.ObjectStoreBucket != "" && c.Async {
+		errs = append(errs, errObjectStoreAsync)
+	}
+
+	if c.ObjectStoreBucket != "" && c.Mode == modePubSub {
+		errs = append(errs, errObjectStorePubSub)
+	}
+
+	if c.ObjectStoreBucket != "" && c.KVBucket != "" {
+		errs = append(errs, errObjectStoreKVBucket)
+	}
+
+	if c.CompressThreshold < 0 {
+		errs = append(errs, errNegativeCompressThreshold)
+	}
+
+	if c.CompressThreshold > 0 && c.PayloadEncoding == "gzip" {
+		errs = append(errs, errCompressGzipEncoding)
+	}
+
+	if c.CompressThreshold > 0 && (c.KVBucket != "" || c.ObjectStoreBucket != "") {
+		errs = append(errs, errCompressBucket)
+	}
+
+	expectsSeq := c.ExpectedLastSeqMetadata != "" || c.ExpectedLastSubjectSeqMetadata != ""
+	if expectsSeq && c.Mode == modePubSub {
+		errs = append(errs, errExpectedSeqPubSub)
+	}
+
+	if expectsSeq && (c.KVBucket != "" || c.ObjectStoreBucket != "") {
+		errs = append(errs, errExpectedSeqBucket)
+	}
+
+	if c.Partitions < 0 {
+		errs = append(errs, errNegativePartitions)
+	}
+
+	if c.Partitions > 1 && (c.KVBucket != "" || c.ObjectStoreBucket != "") {
+		errs = append(errs, errPartitionsBucket)
+	}
+
+	if c.PayloadField != "" && (c.KVBucket != "" || c.ObjectStoreBucket != "") {
+		errs = append(errs, errPayloadFieldBucket)
+	}
+
+	if c.OnDelete != "" && c.OnDelete != onDeletePublish && (c.KVBucket != "" || c.ObjectStoreBucket != "") {
+		errs = append(errs, errOnDeleteBucket)
+	}
+
+	if _, err := c.EmptyKeyPartitionIndex(); err != nil {
+		errs = append(errs, err)
+	}
+
 	return errors.Join(errs...)
 }
+
+// validateBreaker checks the circuit breaker settings, if it's enabled.
+func (c Config) validateBreaker() error {
+	switch {
+	case c.BreakerThreshold < 0:
+		return errNegativeBreakerThreshold
+	case c.BreakerThreshold == 0:
+		return nil
+	case c.BreakerWindow < 0:
+		return errNegativeBreakerWindow
+	case c.BreakerCooldown <= 0:
+		return errBreakerCooldown
+	case c.Async || c.Mode == modePubSub || c.KVBucket != "" || c.ObjectStoreBucket != "":
+		return errBreakerMode
+	}
+
+	return nil
+}
+
+// EmptyKeyPartitionIndex returns the partition records without a key are published to,
+// or the roundRobinPartition.
+func (c Config) EmptyKeyPartitionIndex() (int, error) {
+	if c.EmptyKeyPartition == "" || c.EmptyKeyPartition == "round-robin" {
+		return roundRobinPartition, nil
+	}
+
+	partition, err := strconv.Atoi(c.EmptyKeyPartition)
+	if err != nil || partition < 0 || (c.Partitions > 1 && partition >= c.Partitions) {
+		return 0, errInvalidEmptyKeyPartition
+	}
+
+	return partition, nil
+}
+
+// isValidMsgIDField checks if the msgIDField is empty or refers to a supported record field.
+func isValidMsgIDField(msgIDField string) bool {
+	switch msgIDField {
+	case "", msgIDFieldKey, msgIDFieldPayload:
+		return true
+	default:
+		name, ok := strings.CutPrefix(msgIDField, msgIDFieldMetadataPrefix)
+
+		return ok && name != ""
+	}
+}
+
+func (c Config) NATSStorageType() nats.StorageType {
+	switch c.BucketStorage {
+	case "file", "":
+		return nats.FileStorage
+	case "memory":
+		return nats.MemoryStorage
+	default:
+		// shouldn't happen, because the SDK should limit the options to only the valid ones
+		panic(fmt.Errorf("invalid bucket storage %q", c.BucketStorage))
+	}
+}
@@ -16,6 +16,7 @@ package destination
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -68,37 +69,145 @@ func (d *Destination) Open(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("connect to NATS: %w", err)
 	}
-	d.nc = conn
+	d.nc = internal.WithJetStreamOptions(conn, internal.JetStreamOptions(d.config.Config)...)
 
 	// Async handlers & callbacks
 	conn.SetErrorHandler(internal.ErrorHandlerCallback(ctx))
 	conn.SetDisconnectErrHandler(internal.DisconnectErrCallback(ctx, func(*nats.Conn) {}))
-	conn.SetReconnectHandler(internal.ReconnectCallback(ctx, func(*nats.Conn) {
-		d.writer, err = NewWriter(writerParams{
-			nc:            d.nc,
-			subject:       d.config.Subject,
-			retryWait:     d.config.RetryWait,
-			retryAttempts: d.config.RetryAttempts,
-		})
-	}))
+	conn.SetReconnectHandler(d.reconnectHandler(ctx))
 	conn.SetClosedHandler(internal.ClosedCallback(ctx))
 	conn.SetDiscoveredServersHandler(internal.DiscoveredServersCallback(ctx))
 
-	d.writer, err = NewWriter(writerParams{
-		nc:            d.nc,
-		subject:       d.config.Subject,
-		retryWait:     d.config.RetryWait,
-		retryAttempts: d.config.RetryAttempts,
-	})
+	d.writer, err = NewWriter(d.writerParams())
 	if err != nil {
 		return fmt.Errorf("init jetstream writer: %w", err)
 	}
 
+	if d.config.ValidateOnOpen != validateOnOpenNone {
+		if err := d.writer.Validate(ctx, d.config.ValidateOnOpen == validateOnOpenPublish); err != nil {
+			return err
+		}
+	}
+
+	d.checkDuplicateWindow(ctx)
+
 	return nil
 }
 
+// checkDuplicateWindow warns if messages are published with a Nats-Msg-Id header
+// to a stream that doesn't deduplicate them, because its duplicate window is zero.
+func (d *Destination) checkDuplicateWindow(ctx context.Context) {
+	if d.config.MsgIDField == "" || d.config.Stream == "" || d.config.Mode == modePubSub {
+		return
+	}
+
+	js, err := d.nc.JetStream()
+	if err != nil {
+		sdk.Logger(ctx).Warn().Err(err).Msg("failed to get the JetStream context to check the duplicate window")
+
+		return
+	}
+
+	info, err := js.StreamInfo(d.config.Stream, nats.Context(ctx))
+	if err != nil {
+		sdk.Logger(ctx).Warn().Err(err).
+			Str("stream", d.config.Stream).
+			Msg("failed to get the stream info to check the duplicate window")
+
+		return
+	}
+
+	if info.Config.Duplicates == 0 {
+		sdk.Logger(ctx).Warn().
+			Str("stream", d.config.Stream).
+			Str("msgIDField", d.config.MsgIDField).
+			Msg("the stream's duplicate window is zero, messages won't be deduplicated")
+	}
+}
+
+// reconnectHandler returns the handler called once the connection to NATS is re-established.
+// The writer is kept, as the connection and its JetStream context survive a reconnect.
+func (d *Destination) reconnectHandler(ctx context.Context) nats.ConnHandler {
+	return internal.ReconnectCallback(ctx, func(*nats.Conn) {})
+}
+
+// writerParams returns the params for the NewWriter function based on the Destination's config.
+func (d *Destination) writerParams() writerParams {
+	// the empty key partition is validated by ParseConfig
+	emptyKeyPartition, _ := d.config.EmptyKeyPartitionIndex()
+
+	return writerParams{
+		nc:                d.nc,
+		subject:           d.config.Subject,
+		pubsub:            d.config.Mode == modePubSub,
+		subjectTemplate:   d.config.SubjectTemplate,
+		subjectPrefix:     d.config.SubjectPrefix,
+		partitions:        d.config.Partitions,
+		emptyKeyPartition: emptyKeyPartition,
+		retryWait:         d.config.RetryWait,
+		retryAttempts:     d.config.RetryAttempts,
+		publishTimeout:    d.config.PublishTimeout,
+		// the writer is flushed before the connection is drained, within the same time
+		closeTimeout:                   d.config.DrainTimeout,
+		metadataHeaders:                d.config.MetadataHeaders,
+		async:                          d.config.Async,
+		maxPendingAsync:                d.config.MaxPendingAsync,
+		publishAsyncMaxPending:         d.config.PublishAsyncMaxPending,
+		publishAsyncStallWait:          d.config.PublishAsyncStallWait,
+		msgIDField:                     d.config.MsgIDField,
+		verifyPublish:                  d.config.VerifyPublish,
+		stream:                         d.config.Stream,
+		payloadField:                   d.config.PayloadField,
+		skipMissingPayloadField:        d.config.SkipMissingPayloadField,
+		onDelete:                       d.config.OnDelete,
+		payloadEncoding:                d.config.PayloadEncoding,
+		compressThreshold:              d.config.CompressThreshold,
+		deadLetterSubject:              d.config.DeadLetterSubject,
+		createdAtHeader:                d.config.CreatedAtHeader,
+		sourcePositionHeader:           d.config.SourcePositionHeader,
+		beforeHeader:                   d.config.BeforeHeader,
+		expectedLastSeqMetadata:        d.config.ExpectedLastSeqMetadata,
+		expectedLastSubjectSeqMetadata: d.config.ExpectedLastSubjectSeqMetadata,
+		enableTracing:                  d.config.EnableTracing,
+		breakerThreshold:               d.config.BreakerThreshold,
+		breakerWindow:                  d.config.BreakerWindow,
+		breakerCooldown:                d.config.BreakerCooldown,
+		kvBucket:                       d.config.KVBucket,
+		kvAutoCreateBucket:             d.config.KVAutoCreateBucket,
+		kvPurgeDeletes:                 d.config.KVPurgeDeletes,
+		objectStoreBucket:              d.config.ObjectStoreBucket,
+		objectStoreAutoCreate:          d.config.ObjectStoreAutoCreate,
+		bucketStorage:                  d.config.NATSStorageType(),
+	}
+}
+
 // Write writes a record into a Destination.
 func (d *Destination) Write(ctx context.Context, records []opencdc.Record) (int, error) {
+	if d.writer.kv != nil || d.writer.objectStore != nil || d.writer.pubsub || d.writer.async || len(records) > 1 {
+		writeFn := d.writer.writeBatch
+		switch {
+		case d.writer.kv != nil:
+			writeFn = d.writer.writeKV
+		case d.writer.objectStore != nil:
+			writeFn = d.writer.writeObjectStore
+		case d.writer.pubsub:
+			writeFn = d.writer.writePubSub
+		case d.writer.async:
+			writeFn = d.writer.writeAsync
+		}
+
+		recorded, err := writeFn(ctx, records)
+		if err != nil {
+			sdk.Logger(ctx).Debug().
+				Int("record total", len(records)).
+				Int("record recorded", recorded).
+				Err(err).
+				Msg("batch write stopped before having all records recorded")
+		}
+
+		return recorded, err
+	}
+
 	recorded := 0
 	for _, record := range records {
 		select {
@@ -128,11 +237,21 @@ func (d *Destination) Write(ctx context.Context, records []opencdc.Record) (int,
 	return recorded, nil
 }
 
-// Teardown gracefully closes connections.
-func (d *Destination) Teardown(context.Context) error {
+// Teardown waits for pending acknowledgements and gracefully closes connections.
+func (d *Destination) Teardown(ctx context.Context) error {
+	var errs []error
+	if d.writer != nil {
+		if err := d.writer.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("close writer: %w", err))
+		}
+	}
+
 	if d.nc != nil {
-		d.nc.Close()
+		// draining flushes the pending publishes before the connection is closed
+		if err := internal.DrainConn(ctx, d.nc); err != nil {
+			errs = append(errs, fmt.Errorf("drain connection: %w", err))
+		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
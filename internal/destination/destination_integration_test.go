@@ -18,11 +18,16 @@ package destination
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/conduitio/conduit-commons/opencdc"
 
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal/source"
 	test "github.com/conduitio-labs/conduit-connector-nats-jetstream/test"
+	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/matryer/is"
 )
 
@@ -113,3 +118,75 @@ func TestIntegrationDestination_Write(t *testing.T) {
 	err = destination.Teardown(ctx)
 	is.NoErr(err)
 }
+
+func TestIntegrationDestination_Write_compressed(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	stream, subject := "mystreamcompressed", "foo_destination_compressed"
+
+	conn, err := test.GetTestConnection()
+	is.NoErr(err)
+	t.Cleanup(conn.Close)
+
+	err = test.CreateTestStream(conn, stream, []string{subject})
+	is.NoErr(err)
+
+	destination := NewDestination()
+	err = destination.Configure(ctx, map[string]string{
+		"urls":              test.TestURL,
+		"subject":           subject,
+		"compressThreshold": "64",
+	})
+	is.NoErr(err)
+	is.NoErr(destination.Open(ctx))
+	t.Cleanup(func() {
+		_ = destination.Teardown(ctx)
+	})
+
+	record := opencdc.Record{
+		Payload: opencdc.Change{After: opencdc.RawData(strings.Repeat(`{"id":1,"name":"foo"}`, 100))},
+	}
+	// the whole record is published as the message payload
+	payload := opencdc.RawData(record.Bytes())
+
+	written, err := destination.Write(ctx, []opencdc.Record{record})
+	is.NoErr(err)
+	is.Equal(written, 1)
+
+	// the message is stored compressed
+	js, err := conn.JetStream()
+	is.NoErr(err)
+	stored, err := js.GetLastMsg(stream, subject)
+	is.NoErr(err)
+	is.Equal(stored.Header.Get("Content-Encoding"), "gzip")
+	is.True(len(stored.Data) < len(payload))
+
+	src := source.NewSource()
+	err = src.Configure(ctx, map[string]string{
+		"urls":    test.TestURL,
+		"subject": subject,
+		"stream":  stream,
+	})
+	is.NoErr(err)
+	is.NoErr(src.Open(ctx, nil))
+	t.Cleanup(func() {
+		_ = src.Teardown(ctx)
+	})
+
+	readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	for {
+		record, err := src.Read(readCtx)
+		if errors.Is(err, sdk.ErrBackoffRetry) {
+			continue
+		}
+		is.NoErr(err)
+
+		// the source decompresses it transparently
+		is.Equal(record.Payload.After, payload)
+
+		break
+	}
+}
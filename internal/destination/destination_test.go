@@ -55,6 +55,257 @@ func TestDestination_Configure(t *testing.T) {
 			},
 			expectedErr: "RetryWait can't be a negative value",
 		},
+		{
+			name: "fail, zero publish timeout",
+			args: args{
+				cfg: map[string]string{
+					"urls":           "nats://127.0.0.1:4222",
+					"subject":        "foo",
+					"publishTimeout": "0s",
+				},
+			},
+			expectedErr: "PublishTimeout must be a positive value",
+		},
+		{
+			name: "success, msg ID from metadata",
+			args: args{
+				cfg: map[string]string{
+					"urls":       "nats://127.0.0.1:4222",
+					"subject":    "foo",
+					"msgIDField": "metadata.id",
+				},
+			},
+		},
+		{
+			name: "fail, invalid msg ID field",
+			args: args{
+				cfg: map[string]string{
+					"urls":       "nats://127.0.0.1:4222",
+					"subject":    "foo",
+					"msgIDField": "metadata.",
+				},
+			},
+			expectedErr: `MsgIDField must be one of "key", "payload" or "metadata.<name>"`,
+		},
+		{
+			name: "success, verify publish",
+			args: args{
+				cfg: map[string]string{
+					"urls":          "nats://127.0.0.1:4222",
+					"subject":       "foo",
+					"stream":        "bar",
+					"verifyPublish": "true",
+				},
+			},
+		},
+		{
+			name: "fail, verify publish without stream",
+			args: args{
+				cfg: map[string]string{
+					"urls":          "nats://127.0.0.1:4222",
+					"subject":       "foo",
+					"verifyPublish": "true",
+				},
+			},
+			expectedErr: "Stream must be set to verify publishes",
+		},
+		{
+			name: "fail, dead-letter subject in the async mode",
+			args: args{
+				cfg: map[string]string{
+					"urls":              "nats://127.0.0.1:4222",
+					"subject":           "foo",
+					"async":             "true",
+					"deadLetterSubject": "foo.dlq",
+				},
+			},
+			expectedErr: "DeadLetterSubject can't be used in the async mode",
+		},
+		{
+			name: "success, compress threshold",
+			args: args{
+				cfg: map[string]string{
+					"urls":              "nats://127.0.0.1:4222",
+					"subject":           "foo",
+					"compressThreshold": "1024",
+				},
+			},
+		},
+		{
+			name: "fail, compress threshold with gzip payload encoding",
+			args: args{
+				cfg: map[string]string{
+					"urls":              "nats://127.0.0.1:4222",
+					"subject":           "foo",
+					"compressThreshold": "1024",
+					"payloadEncoding":   "gzip",
+				},
+			},
+			expectedErr: `CompressThreshold can't be combined with the "gzip" PayloadEncoding`,
+		},
+		{
+			name: "success, expected last sequence",
+			args: args{
+				cfg: map[string]string{
+					"urls":                           "nats://127.0.0.1:4222",
+					"subject":                        "foo",
+					"expectedLastSeqMetadata":        "expected-seq",
+					"expectedLastSubjectSeqMetadata": "expected-subject-seq",
+				},
+			},
+		},
+		{
+			name: "fail, expected last sequence in the pubsub mode",
+			args: args{
+				cfg: map[string]string{
+					"urls":                    "nats://127.0.0.1:4222",
+					"subject":                 "foo",
+					"mode":                    "pubsub",
+					"expectedLastSeqMetadata": "expected-seq",
+				},
+			},
+			expectedErr: "expected last sequences can't be used in the pubsub mode",
+		},
+		{
+			name: "success, partitions",
+			args: args{
+				cfg: map[string]string{
+					"urls":              "nats://127.0.0.1:4222",
+					"subject":           "events",
+					"partitions":        "4",
+					"emptyKeyPartition": "3",
+				},
+			},
+		},
+		{
+			name: "fail, empty key partition out of range",
+			args: args{
+				cfg: map[string]string{
+					"urls":              "nats://127.0.0.1:4222",
+					"subject":           "events",
+					"partitions":        "4",
+					"emptyKeyPartition": "4",
+				},
+			},
+			expectedErr: `EmptyKeyPartition must be "round-robin" or a partition index less than the Partitions`,
+		},
+		{
+			name: "fail, partitions with a kv bucket",
+			args: args{
+				cfg: map[string]string{
+					"urls":       "nats://127.0.0.1:4222",
+					"subject":    "events",
+					"partitions": "4",
+					"kvBucket":   "bucket",
+				},
+			},
+			expectedErr: "Partitions can't be combined with the KVBucket or the ObjectStoreBucket",
+		},
+		{
+			name: "success, payload field",
+			args: args{
+				cfg: map[string]string{
+					"urls":                    "nats://127.0.0.1:4222",
+					"subject":                 "foo",
+					"payloadField":            "data.body",
+					"skipMissingPayloadField": "true",
+				},
+			},
+		},
+		{
+			name: "fail, payload field with a kv bucket",
+			args: args{
+				cfg: map[string]string{
+					"urls":         "nats://127.0.0.1:4222",
+					"subject":      "foo",
+					"payloadField": "data.body",
+					"kvBucket":     "bucket",
+				},
+			},
+			expectedErr: "PayloadField can't be combined with the KVBucket or the ObjectStoreBucket",
+		},
+		{
+			name: "fail, on delete with an object store",
+			args: args{
+				cfg: map[string]string{
+					"urls":              "nats://127.0.0.1:4222",
+					"subject":           "foo",
+					"onDelete":          "tombstone",
+					"objectStoreBucket": "bucket",
+				},
+			},
+			expectedErr: `OnDelete can't be combined with the KVBucket or the ObjectStoreBucket, unless it's "publish"`,
+		},
+		{
+			name: "success, circuit breaker",
+			args: args{
+				cfg: map[string]string{
+					"urls":             "nats://127.0.0.1:4222",
+					"subject":          "foo",
+					"breakerThreshold": "5",
+					"breakerCooldown":  "10s",
+				},
+			},
+		},
+		{
+			name: "fail, circuit breaker in the async mode",
+			args: args{
+				cfg: map[string]string{
+					"urls":             "nats://127.0.0.1:4222",
+					"subject":          "foo",
+					"breakerThreshold": "5",
+					"async":            "true",
+				},
+			},
+			expectedErr: "BreakerThreshold can't be used in the async or the pubsub mode, " +
+				"or with the KVBucket or the ObjectStoreBucket",
+		},
+		{
+			name: "success, async publish limits",
+			args: args{
+				cfg: map[string]string{
+					"urls":                   "nats://127.0.0.1:4222",
+					"subject":                "foo",
+					"async":                  "true",
+					"publishAsyncMaxPending": "8000",
+					"publishAsyncStallWait":  "5s",
+				},
+			},
+		},
+		{
+			name: "fail, negative async max pending",
+			args: args{
+				cfg: map[string]string{
+					"urls":                   "nats://127.0.0.1:4222",
+					"subject":                "foo",
+					"publishAsyncMaxPending": "-1",
+				},
+			},
+			expectedErr: "PublishAsyncMaxPending can't be a negative value",
+		},
+		{
+			name: "fail, zero async stall wait",
+			args: args{
+				cfg: map[string]string{
+					"urls":                  "nats://127.0.0.1:4222",
+					"subject":               "foo",
+					"publishAsyncStallWait": "0s",
+				},
+			},
+			expectedErr: "PublishAsyncStallWait must be a positive value",
+		},
+		{
+			name: "fail, invalid validate on open",
+			args: args{
+				cfg: map[string]string{
+					"urls":           "nats://127.0.0.1:4222",
+					"subject":        "foo",
+					"validateOnOpen": "write",
+				},
+			},
+			expectedErr: `config invalid: error validating "validateOnOpen": "write" value must be included ` +
+				`in the list [none,check,publish]: inclusion validation failed`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -106,6 +357,29 @@ func TestDestination_Write(t *testing.T) {
 			expectedWritten: 0,
 			expectedErr:     errors.New("an error"),
 		},
+		{
+			name: "Write works as expected with a batch",
+			args: args{
+				records: []opencdc.Record{
+					{Payload: opencdc.Change{After: make(opencdc.RawData, 10)}},
+					{Payload: opencdc.Change{After: make(opencdc.RawData, 10)}},
+					{Payload: opencdc.Change{After: make(opencdc.RawData, 10)}},
+				},
+			},
+			expectedWritten: 3,
+		},
+		{
+			name: "Write reports the first failed record of a batch",
+			args: args{
+				failedWrites: 1,
+				records: []opencdc.Record{
+					{Payload: opencdc.Change{After: make(opencdc.RawData, 10)}},
+					{Payload: opencdc.Change{After: make(opencdc.RawData, 10)}},
+				},
+			},
+			expectedWritten: 0,
+			expectedErr:     errors.New("an error"),
+		},
 		{
 			name: "context can be closed",
 			args: args{
@@ -153,6 +427,36 @@ func TestDestination_Write(t *testing.T) {
 	}
 }
 
+func TestDestination_reconnectHandler(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	kv := &mockKeyValue{}
+	w := &Writer{kv: kv}
+	d := &Destination{
+		// re-creating the writer would fail, as the bucket can't be looked up
+		nc:     &natsMock{js: &mockStoreJetStream{kvErr: nats.ErrTimeout}},
+		config: Config{KVBucket: "bucket"},
+		writer: w,
+	}
+
+	d.reconnectHandler(ctx)(&nats.Conn{})
+
+	// the writer is kept and still writes the records
+	is.Equal(d.writer, w)
+
+	written, err := d.Write(ctx, []opencdc.Record{
+		{
+			Operation: opencdc.OperationCreate,
+			Key:       opencdc.RawData("a"),
+			Payload:   opencdc.Change{After: opencdc.RawData("1")},
+		},
+	})
+	is.NoErr(err)
+	is.Equal(written, 1)
+	is.Equal(kv.ops, []string{"put a 1"})
+}
+
 func TestDestination_Teardown(t *testing.T) {
 	type args struct {
 		ctx context.Context
@@ -161,6 +465,7 @@ func TestDestination_Teardown(t *testing.T) {
 	tests := []struct {
 		name        string
 		args        args
+		drainCalled bool
 		closeCalled bool
 	}{
 		{
@@ -168,6 +473,7 @@ func TestDestination_Teardown(t *testing.T) {
 			args: args{
 				ctx: context.Background(),
 			},
+			drainCalled: true,
 			closeCalled: true,
 		},
 	}
@@ -184,6 +490,11 @@ func TestDestination_Teardown(t *testing.T) {
 				t.Errorf("Destination.Teardown() unexpected error = %v", err)
 			}
 
+			// nats drain
+			if tt.drainCalled != nm.drainCalled {
+				t.Errorf("Destination.Teardown() nats Drain method was not called")
+			}
+
 			// nats close
 			if tt.closeCalled != nm.closeCalled {
 				t.Errorf("Destination.Teardown() nats Close method was not called")
@@ -193,19 +504,61 @@ func TestDestination_Teardown(t *testing.T) {
 }
 
 type natsMock struct {
+	drainCalled bool
 	closeCalled bool
+	connected   bool
+	published   []*nats.Msg
+	publishErr  error
+	flushCalled bool
+	js          nats.JetStreamContext
+	maxPayload  int64
+}
+
+func (m *natsMock) PublishMsg(msg *nats.Msg) error {
+	if m.publishErr != nil {
+		return m.publishErr
+	}
+	m.published = append(m.published, msg)
+
+	return nil
+}
+
+func (m *natsMock) Subscribe(string, nats.MsgHandler) (*nats.Subscription, error) {
+	return nil, nil
+}
+
+func (m *natsMock) QueueSubscribe(string, string, nats.MsgHandler) (*nats.Subscription, error) {
+	return nil, nil
+}
+
+func (m *natsMock) FlushWithContext(context.Context) error {
+	m.flushCalled = true
+
+	return nil
 }
 
 func (m *natsMock) Drain() error {
+	m.drainCalled = true
+	// the connection is closed once it's drained
+	m.closeCalled = true
+
 	return nil
 }
 
+func (m *natsMock) IsClosed() bool {
+	return m.closeCalled
+}
+
 func (m *natsMock) JetStream(...nats.JSOpt) (nats.JetStreamContext, error) {
-	return nil, nil
+	return m.js, nil
+}
+
+func (m *natsMock) MaxPayload() int64 {
+	return m.maxPayload
 }
 
 func (m *natsMock) IsConnected() bool {
-	return false
+	return m.connected
 }
 
 func (m *natsMock) Close() {
@@ -216,6 +569,8 @@ type mockJetstreamPublisher struct {
 	totalWrites  int
 	failedWrites int
 	err          error
+	pubAck       *nats.PubAck
+	published    []*nats.Msg
 }
 
 func (m *mockJetstreamPublisher) Publish(_ string, _ []byte, _ ...nats.PubOpt) (*nats.PubAck, error) {
@@ -224,5 +579,57 @@ func (m *mockJetstreamPublisher) Publish(_ string, _ []byte, _ ...nats.PubOpt) (
 		return nil, m.err
 	}
 
-	return nil, nil
+	return m.pubAck, nil
+}
+
+func (m *mockJetstreamPublisher) PublishMsg(msg *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	m.published = append(m.published, msg)
+
+	return m.Publish(msg.Subject, msg.Data, opts...)
+}
+
+func (m *mockJetstreamPublisher) PublishMsgAsync(msg *nats.Msg, opts ...nats.PubOpt) (nats.PubAckFuture, error) {
+	future := &mockPubAckFuture{
+		msg: msg,
+		ok:  make(chan *nats.PubAck, 1),
+		err: make(chan error, 1),
+	}
+
+	pubAck, err := m.Publish(msg.Subject, msg.Data, opts...)
+	if err != nil {
+		future.err <- err
+	} else {
+		future.ok <- pubAck
+	}
+
+	return future, nil
+}
+
+func (m *mockJetstreamPublisher) PublishAsyncPending() int {
+	return 0
+}
+
+func (m *mockJetstreamPublisher) PublishAsyncComplete() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+
+	return done
+}
+
+type mockPubAckFuture struct {
+	msg *nats.Msg
+	ok  chan *nats.PubAck
+	err chan error
+}
+
+func (f *mockPubAckFuture) Ok() <-chan *nats.PubAck {
+	return f.ok
+}
+
+func (f *mockPubAckFuture) Err() <-chan error {
+	return f.err
+}
+
+func (f *mockPubAckFuture) Msg() *nats.Msg {
+	return f.msg
 }
@@ -15,34 +15,314 @@
 package destination
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/conduitio/conduit-commons/opencdc"
 
 	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
+	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/nats-io/nats.go"
 )
 
+const (
+	// metadataHeadersNone doesn't write any record metadata as message headers.
+	metadataHeadersNone = "none"
+	// metadataHeadersPrefixed writes only the record metadata under the
+	// internal.MetadataHeaderPrefix as message headers, without the prefix.
+	metadataHeadersPrefixed = "prefixed"
+	// metadataHeadersAll writes all the record metadata as message headers.
+	metadataHeadersAll = "all"
+)
+
+// modePubSub publishes messages to core NATS instead of JetStream.
+const modePubSub = "pubsub"
+
+const (
+	// validateOnOpenNone doesn't validate the writer when the destination opens.
+	validateOnOpenNone = "none"
+	// validateOnOpenPublish validates the writer including a test publish when the destination opens.
+	validateOnOpenPublish = "publish"
+)
+
+const (
+	// msgIDFieldKey takes the message ID from the record key.
+	msgIDFieldKey = "key"
+	// msgIDFieldPayload takes the message ID from a hash of the record payload.
+	msgIDFieldPayload = "payload"
+	// msgIDFieldMetadataPrefix takes the message ID from the record metadata field
+	// following the prefix.
+	msgIDFieldMetadataPrefix = "metadata."
+)
+
+const (
+	// onDeletePublish publishes delete records like any other record.
+	onDeletePublish = "publish"
+	// onDeleteTombstone publishes delete records as messages with an empty payload and the deletedHeader.
+	onDeleteTombstone = "tombstone"
+	// onDeleteSkip skips delete records.
+	onDeleteSkip = "skip"
+	// onDeleteError fails to write delete records.
+	onDeleteError = "error"
+)
+
+// deletedHeader marks the tombstone messages published for delete records.
+const deletedHeader = "Conduit-Deleted"
+
+// roundRobinPartition makes the writer spread records without a key across the partitions
+// in turns instead of publishing them to a fixed partition.
+const roundRobinPartition = -1
+
+// validateHeader marks the test message published by Validate, so it can be told apart from the records.
+const validateHeader = "Conduit-Validate"
+
+const (
+	// deadLetterReasonHeader holds the error that made a message be published to the dead-letter subject.
+	deadLetterReasonHeader = "Conduit-Dead-Letter-Reason"
+	// deadLetterSubjectHeader holds the subject a dead-lettered message failed to be published to.
+	deadLetterSubjectHeader = "Conduit-Dead-Letter-Subject"
+)
+
+// ErrEmptyKVKey is returned when a record without a key is written to a KV bucket.
+var ErrEmptyKVKey = errors.New("record key is empty, it's required to write to a kv bucket")
+
+// ErrEmptyObjectName is returned when a record without a key is written to an object store.
+var ErrEmptyObjectName = errors.New("record key is empty, it's required as the object name to write to an object store")
+
+// ErrWrongLastSequence is returned when a message isn't stored, because the last sequence
+// of the stream or of its subject doesn't match the one expected by the record.
+var ErrWrongLastSequence = errors.New("wrong last sequence")
+
+// ErrMissingPayloadField is returned when a record doesn't have the field selected by the payload field.
+var ErrMissingPayloadField = errors.New("payload field is missing")
+
+// ErrDeleteRecord is returned when a delete record is written with the "error" OnDelete policy.
+var ErrDeleteRecord = errors.New("delete records aren't allowed")
+
+// errDeleteSkipped means that a delete record is skipped with the "skip" OnDelete policy.
+var errDeleteSkipped = errors.New("delete record skipped")
+
+// ErrPayloadTooLarge is returned when a message is larger than the maximum payload of the server.
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+// ErrPublishAsyncStalled is returned when no pending acknowledgement is received
+// within the stall wait in the async mode.
+var ErrPublishAsyncStalled = errors.New("async publish stalled")
+
+// ErrPublishRetriesExhausted is returned when a message couldn't be published,
+// because the stream didn't respond to any of the publish attempts.
+var ErrPublishRetriesExhausted = errors.New("publish retries exhausted")
+
 type jetstreamPublisher interface {
 	Publish(subj string, data []byte, opts ...nats.PubOpt) (*nats.PubAck, error)
+	PublishMsg(m *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error)
+	PublishMsgAsync(m *nats.Msg, opts ...nats.PubOpt) (nats.PubAckFuture, error)
+	PublishAsyncPending() int
+	PublishAsyncComplete() <-chan struct{}
 }
 
 // Writer implements a JetStream writer.
-// It writes messages asynchronously.
+// It writes single messages synchronously and batches of messages asynchronously.
+// In the pubsub mode it publishes messages to core NATS instead.
 type Writer struct {
-	subject     string
-	publisher   jetstreamPublisher
-	publishOpts []nats.PubOpt
+	nc              internal.NATSClient
+	subject         string
+	subjectTemplate *template.Template
+	// subjectPrefix is prepended to the subjects evaluated from the subjectTemplate.
+	subjectPrefix string
+	// partitions is the number of partitions the subjects are split into, if it's greater than 1.
+	partitions int
+	// emptyKeyPartition is the partition of the records without a key, or the roundRobinPartition.
+	emptyKeyPartition int
+	// nextPartition is the partition the next record without a key is published to in turns.
+	nextPartition   atomic.Uint64
+	pubsub          bool
+	publisher       jetstreamPublisher
+	kv              nats.KeyValue
+	kvPurgeDeletes  bool
+	objectStore     nats.ObjectStore
+	publishOpts     []nats.PubOpt
+	publishTimeout  time.Duration
+	closeTimeout    time.Duration
+	retryAttempts   int
+	metadataHeaders string
+	async           bool
+	maxPendingAsync int
+	// publishAsyncStallWait is the maximum time the async mode waits for pending acknowledgements.
+	// If it's zero the wait is limited only by the context.
+	publishAsyncStallWait time.Duration
+	msgIDField            string
+	verifyPublish         bool
+	stream                string
+	// payloadField is the path to the field of the record payload published instead of the whole record.
+	payloadField []string
+	// skipMissingPayloadField makes the writer skip the records without the payloadField.
+	skipMissingPayloadField bool
+	// onDelete defines how delete records are published.
+	onDelete          string
+	payloadEncoding   string
+	compressThreshold int
+	deadLetterSubject string
+	createdAtHeader   string
+	// sourcePositionHeader makes the writer write the record position to the internal.SourcePositionHeader.
+	sourcePositionHeader bool
+	// beforeHeader makes the writer write the payload before the change to the internal.BeforeHeader.
+	beforeHeader bool
+	// expectedLastSeqMetadata and expectedLastSubjectSeqMetadata are the names of the record metadata
+	// fields holding the last sequence the stream, or the subject of the message, is expected to have.
+	expectedLastSeqMetadata        string
+	expectedLastSubjectSeqMetadata string
+	// enableTracing makes the writer write the trace context into the message headers.
+	enableTracing bool
+	// maxPayload is the maximum size in bytes of the payload and the headers of a message accepted
+	// by the server. If it's zero, the size isn't checked.
+	maxPayload int64
+	// breaker makes the writer fail fast after too many consecutive publish failures, if it's set.
+	breaker *circuitBreaker
+
+	mu sync.Mutex
+	// asyncErrs holds errors of failed asynchronous publishes
+	// which haven't been reported yet.
+	asyncErrs []error
+
+	// counters reported by Stats
+	published    atomic.Uint64
+	failed       atomic.Uint64
+	deadLettered atomic.Uint64
+	skipped      atomic.Uint64
+}
+
+// WriterStats contains counters of the Writer's activity since it was created.
+type WriterStats struct {
+	// Published is the number of successfully published messages. In the async mode
+	// messages are counted once they're sent, without waiting for their acknowledgements.
+	Published uint64
+	// Failed is the number of messages which failed to be published.
+	Failed uint64
+	// DeadLettered is the number of messages which failed to be published
+	// and were published to the dead-letter subject instead.
+	DeadLettered uint64
+	// Skipped is the number of records skipped, because they don't have the payload field
+	// or they're delete records skipped by the OnDelete policy.
+	Skipped uint64
+	// PendingAsync is the number of asynchronously published messages awaiting an acknowledgement.
+	PendingAsync int
 }
 
 // writerParams is an incoming params for the NewWriter function.
 type writerParams struct {
-	nc            internal.NATSClient
-	subject       string
+	nc      internal.NATSClient
+	subject string
+	// subjectTemplate is a Go template evaluated against every record to determine its subject.
+	// If it's empty all the messages are published to the subject.
+	subjectTemplate string
+	// subjectPrefix is prepended to the subject and the subjects evaluated from the subjectTemplate.
+	subjectPrefix string
+	// partitions makes the writer append the index of a partition determined by a hash of the record key
+	// to the subject, e.g. "events.0", if it's greater than 1.
+	partitions int
+	// emptyKeyPartition is the partition records without a key are published to. If it's the
+	// roundRobinPartition, they're published to all the partitions in turns.
+	emptyKeyPartition int
+	// pubsub makes the writer publish messages to core NATS instead of JetStream.
+	pubsub        bool
 	retryWait     time.Duration
 	retryAttempts int
+	// closeTimeout is the maximum amount of time Close waits for the pending messages to be flushed.
+	// If it's zero Close waits until its context is done.
+	closeTimeout time.Duration
+	// publishTimeout is the maximum amount of time a synchronous publish waits for its acknowledgement,
+	// including the retries. If it's zero the publish is limited only by the context.
+	publishTimeout time.Duration
+	// metadataHeaders defines which record metadata is written as message headers.
+	metadataHeaders string
+	// async makes the writer publish messages without waiting for their acknowledgements.
+	async bool
+	// maxPendingAsync is the maximum number of pending acknowledgements in the async mode.
+	maxPendingAsync int
+	// publishAsyncMaxPending is the maximum number of pending acknowledgements the NATS client allows
+	// in the async mode. If it's zero the maxPendingAsync is used.
+	publishAsyncMaxPending int
+	// publishAsyncStallWait is the maximum time the async mode waits for pending acknowledgements.
+	publishAsyncStallWait time.Duration
+	// msgIDField defines where the message ID used for deduplication is taken from.
+	msgIDField string
+	// verifyPublish makes the writer check that every message is acknowledged by the stream.
+	verifyPublish bool
+	// stream is the name of the stream expected to store the messages.
+	stream string
+	// payloadField is a dot separated path to the field of the structured record payload
+	// published instead of the whole record. If it's empty, the whole record is published.
+	payloadField string
+	// skipMissingPayloadField makes the writer skip the records without the payloadField
+	// instead of failing to write them.
+	skipMissingPayloadField bool
+	// onDelete defines how delete records are published, one of the onDelete constants.
+	// If it's empty, they're published like any other record.
+	onDelete string
+	// payloadEncoding is the encoding of message payloads.
+	payloadEncoding string
+	// compressThreshold is the size in bytes from which payloads are compressed using gzip,
+	// which is announced by the internal.ContentEncodingHeader. If it's zero payloads aren't compressed.
+	compressThreshold int
+	// deadLetterSubject is the subject messages which failed to be published are published to.
+	// If it's empty, failed messages fail the write.
+	deadLetterSubject string
+	// createdAtHeader is the name of the header the record creation time is written to.
+	// If it's empty, the creation time is not written.
+	createdAtHeader string
+	// sourcePositionHeader makes the writer write the base64 encoded record position
+	// to the internal.SourcePositionHeader.
+	sourcePositionHeader bool
+	// beforeHeader makes the writer write the base64 encoded payload before the change of update
+	// records to the internal.BeforeHeader.
+	beforeHeader bool
+	// expectedLastSeqMetadata is the name of the record metadata field holding the last sequence
+	// the stream is expected to have. The message isn't stored if the sequence doesn't match.
+	// Records without the field are published without the expectation.
+	expectedLastSeqMetadata string
+	// expectedLastSubjectSeqMetadata is the name of the record metadata field holding the last sequence
+	// the subject of the message is expected to have. The message isn't stored if the sequence doesn't match.
+	// Records without the field are published without the expectation.
+	expectedLastSubjectSeqMetadata string
+	// enableTracing makes the writer write the trace context held by the record metadata,
+	// or the span of the context of the write, into the message headers.
+	enableTracing bool
+	// breakerThreshold is the number of consecutive publish failures within the breakerWindow which
+	// make the writer fail fast without publishing for the breakerCooldown. If it's zero, the writer
+	// always publishes.
+	breakerThreshold int
+	// breakerWindow is the time the consecutive publish failures must happen within to open
+	// the circuit breaker. If it's zero, it's not limited.
+	breakerWindow time.Duration
+	// breakerCooldown is the time the writer fails fast for once the circuit breaker is open.
+	breakerCooldown time.Duration
+	// kvBucket makes the writer write records to the KV bucket instead of publishing them.
+	kvBucket string
+	// kvAutoCreateBucket makes the writer create the kvBucket if it doesn't exist.
+	kvAutoCreateBucket bool
+	// kvPurgeDeletes makes the writer purge the keys of delete records instead of deleting them.
+	kvPurgeDeletes bool
+	// objectStoreBucket makes the writer write records to the object store instead of publishing them.
+	objectStoreBucket string
+	// objectStoreAutoCreate makes the writer create the objectStoreBucket if it doesn't exist.
+	objectStoreAutoCreate bool
+	// bucketStorage is the storage type of the auto-created kvBucket or objectStoreBucket.
+	bucketStorage nats.StorageType
 }
 
 // getPublishOptions returns a NATS publish options based on the WriterParams's fields.
@@ -57,33 +337,1115 @@ func (p writerParams) getPublishOptions() []nats.PubOpt {
 		opts = append(opts, nats.RetryAttempts(p.retryAttempts))
 	}
 
+	if p.async && p.publishAsyncStallWait > 0 {
+		opts = append(opts, nats.StallWait(p.publishAsyncStallWait))
+	}
+
+	return opts
+}
+
+// jetStreamOptions returns the options of the JetStream context based on the WriterParams's fields.
+func (p writerParams) jetStreamOptions(errHandler nats.MsgErrHandler) []nats.JSOpt {
+	opts := []nats.JSOpt{nats.PublishAsyncErrHandler(errHandler)}
+
+	maxPending := p.publishAsyncMaxPending
+	if maxPending == 0 {
+		maxPending = p.maxPendingAsync
+	}
+
+	if maxPending > 0 {
+		opts = append(opts, nats.PublishAsyncMaxPending(maxPending))
+	}
+
 	return opts
 }
 
 // NewWriter creates new instance of the Writer.
 func NewWriter(params writerParams) (*Writer, error) {
-	jetstream, err := params.nc.JetStream()
+	// records written to a kv bucket or an object store aren't published to the subject
+	if params.kvBucket == "" && params.objectStoreBucket == "" {
+		// the subject is only a fallback if the subject template is set
+		subject := internal.PrefixSubject(params.subjectPrefix, params.subject)
+		if err := internal.ValidateSubject(subject, params.subjectTemplate != ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if params.partitions > 1 && params.emptyKeyPartition >= params.partitions {
+		return nil, fmt.Errorf("empty key partition %d must be less than the number of partitions %d",
+			params.emptyKeyPartition, params.partitions)
+	}
+
+	if params.deadLetterSubject != "" {
+		if err := internal.ValidateSubject(params.deadLetterSubject, false); err != nil {
+			return nil, fmt.Errorf("dead-letter subject: %w", err)
+		}
+	}
+
+	payloadField, err := parsePayloadField(params.payloadField)
 	if err != nil {
-		return nil, fmt.Errorf("get jetstream context: %w", err)
+		return nil, err
 	}
 
 	w := &Writer{
-		subject:     params.subject,
-		publisher:   jetstream,
-		publishOpts: params.getPublishOptions(),
+		nc:                params.nc,
+		subject:           internal.PrefixSubject(params.subjectPrefix, params.subject),
+		subjectPrefix:     params.subjectPrefix,
+		partitions:        params.partitions,
+		emptyKeyPartition: params.emptyKeyPartition,
+		pubsub:            params.pubsub,
+		publishOpts:       params.getPublishOptions(),
+		publishTimeout:    params.publishTimeout,
+		closeTimeout:      params.closeTimeout,
+		retryAttempts:     params.retryAttempts,
+		metadataHeaders:   params.metadataHeaders,
+		// messages published to core NATS aren't acknowledged
+		async:                          params.async && !params.pubsub,
+		maxPendingAsync:                params.maxPendingAsync,
+		publishAsyncStallWait:          params.publishAsyncStallWait,
+		msgIDField:                     params.msgIDField,
+		verifyPublish:                  params.verifyPublish,
+		stream:                         params.stream,
+		payloadField:                   payloadField,
+		skipMissingPayloadField:        params.skipMissingPayloadField,
+		onDelete:                       params.onDelete,
+		payloadEncoding:                params.payloadEncoding,
+		compressThreshold:              params.compressThreshold,
+		deadLetterSubject:              params.deadLetterSubject,
+		createdAtHeader:                params.createdAtHeader,
+		sourcePositionHeader:           params.sourcePositionHeader,
+		beforeHeader:                   params.beforeHeader,
+		expectedLastSeqMetadata:        params.expectedLastSeqMetadata,
+		expectedLastSubjectSeqMetadata: params.expectedLastSubjectSeqMetadata,
+		enableTracing:                  params.enableTracing,
+		maxPayload:                     params.nc.MaxPayload(),
+		kvPurgeDeletes:                 params.kvPurgeDeletes,
+		breaker: newCircuitBreaker(
+			params.breakerThreshold, params.breakerWindow, params.breakerCooldown,
+		),
+	}
+
+	if params.subjectTemplate != "" {
+		tmpl, err := template.New("subject").Option("missingkey=error").Parse(params.subjectTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("parse subject template: %w", err)
+		}
+		w.subjectTemplate = tmpl
+	}
+
+	// core NATS doesn't require a JetStream context
+	if w.pubsub {
+		return w, nil
+	}
+
+	jetstream, err := params.nc.JetStream(params.jetStreamOptions(w.asyncErrHandler)...)
+	if err != nil {
+		return nil, fmt.Errorf("get jetstream context: %w", err)
+	}
+	w.publisher = jetstream
+
+	if params.kvBucket != "" {
+		w.kv, err = keyValue(jetstream, params.kvBucket, params.kvAutoCreateBucket, params.bucketStorage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if params.objectStoreBucket != "" {
+		w.objectStore, err = objectStore(
+			jetstream, params.objectStoreBucket, params.objectStoreAutoCreate, params.bucketStorage,
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return w, nil
 }
 
+// objectStore returns the object store, creating it with the storage
+// if it doesn't exist and autoCreate is set.
+func objectStore(
+	js nats.JetStreamContext,
+	bucket string,
+	autoCreate bool,
+	storage nats.StorageType,
+) (nats.ObjectStore, error) {
+	store, err := js.ObjectStore(bucket)
+	switch {
+	case err == nil:
+		return store, nil
+	// the object store is backed by a stream, which is missing if the store doesn't exist
+	case errors.Is(err, nats.ErrStreamNotFound) && autoCreate:
+		store, err = js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: bucket, Storage: storage})
+		if err != nil {
+			return nil, fmt.Errorf("create object store %q: %w", bucket, err)
+		}
+
+		return store, nil
+	default:
+		return nil, fmt.Errorf("get object store %q: %w", bucket, err)
+	}
+}
+
+// keyValue returns the KV bucket, creating it with the storage if it doesn't exist and autoCreate is set.
+func keyValue(
+	js nats.JetStreamContext,
+	bucket string,
+	autoCreate bool,
+	storage nats.StorageType,
+) (nats.KeyValue, error) {
+	kv, err := js.KeyValue(bucket)
+	switch {
+	case err == nil:
+		return kv, nil
+	case errors.Is(err, nats.ErrBucketNotFound) && autoCreate:
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: bucket, Storage: storage})
+		if err != nil {
+			return nil, fmt.Errorf("create kv bucket %q: %w", bucket, err)
+		}
+
+		return kv, nil
+	default:
+		return nil, fmt.Errorf("get kv bucket %q: %w", bucket, err)
+	}
+}
+
 // Write synchronously writes a record.
 func (w *Writer) write(ctx context.Context, record opencdc.Record) error {
+	if err := w.breaker.allow(); err != nil {
+		return err
+	}
+
+	// the dead-letter publish must not be limited by the timeout of the failed publish
+	parentCtx := ctx
+	if w.publishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.publishTimeout)
+		defer cancel()
+	}
+
 	//nolint:golint,gocritic // false positive, the fix will create a memory leak
 	publishOpts := append(w.publishOpts, nats.Context(ctx))
-	_, err := w.publisher.Publish(w.subject, record.Bytes(), publishOpts...)
+
+	msg, err := w.newMessage(ctx, record)
+	if err != nil {
+		if w.skipRecord(ctx, err) {
+			return nil
+		}
+		w.failed.Add(1)
+
+		return err
+	}
+
+	if err := w.checkSize(msg); err != nil {
+		w.failed.Add(1)
+
+		return w.deadLetter(parentCtx, withoutPayload(msg), err)
+	}
+
+	pubAck, err := w.publisher.PublishMsg(msg, publishOpts...)
 	if err != nil {
-		return fmt.Errorf("publish sync: %w", err)
+		w.failed.Add(1)
+		w.publishFailed(ctx, err)
+
+		// the publish is retried only while the stream doesn't respond,
+		// so this error means that all the attempts have failed
+		switch {
+		case errors.Is(err, nats.ErrNoStreamResponse):
+			err = fmt.Errorf("%w: publish to %q failed after %d attempts: %w",
+				ErrPublishRetriesExhausted, msg.Subject, w.retryAttempts+1, err)
+		case isWrongLastSequence(err):
+			err = fmt.Errorf("publish sync: %w: %w", ErrWrongLastSequence, err)
+		default:
+			err = fmt.Errorf("publish sync: %w", err)
+		}
+
+		return w.deadLetter(parentCtx, msg, err)
+	}
+	w.breaker.success()
+
+	if err := w.verifyPubAck(ctx, pubAck); err != nil {
+		w.failed.Add(1)
+
+		return err
 	}
+	w.published.Add(1)
 
 	return nil
 }
+
+// writeBatch asynchronously publishes the records and waits until all of them are acknowledged.
+// It returns the number of records written before the first record that failed to be published.
+func (w *Writer) writeBatch(ctx context.Context, records []opencdc.Record) (int, error) {
+	if err := w.breaker.allow(); err != nil {
+		return 0, err
+	}
+
+	futures := make([]nats.PubAckFuture, 0, len(records))
+	// indexes are the indexes of the records the futures belong to, as skipped records have none
+	indexes := make([]int, 0, len(records))
+
+	written := len(records)
+	var publishErr error
+	for n, record := range records {
+		if err := ctx.Err(); err != nil {
+			written, publishErr = n, err
+
+			break
+		}
+
+		msg, err := w.newMessage(ctx, record)
+		if err != nil {
+			if w.skipRecord(ctx, err) {
+				continue
+			}
+			w.failed.Add(1)
+			written, publishErr = n, err
+
+			break
+		}
+
+		if err := w.checkSize(msg); err != nil {
+			w.failed.Add(1)
+
+			// the records before this one are published already, so it's dead-lettered right away
+			if err := w.deadLetter(ctx, withoutPayload(msg), err); err != nil {
+				written, publishErr = n, err
+
+				break
+			}
+
+			continue
+		}
+
+		future, err := w.publisher.PublishMsgAsync(msg, w.publishOpts...)
+		if err != nil {
+			w.failed.Add(1)
+			w.publishFailed(ctx, err)
+			written, publishErr = n, fmt.Errorf("publish async: %w", err)
+
+			break
+		}
+
+		futures = append(futures, future)
+		indexes = append(indexes, n)
+	}
+
+	// wait for the acknowledgements of all the published messages, even if some
+	// of them failed to be published, so the failed record can be determined
+	for i, future := range futures {
+		n := indexes[i]
+		select {
+		case pubAck := <-future.Ok():
+			w.breaker.success()
+
+			if err := w.verifyPubAck(ctx, pubAck); err != nil {
+				w.failed.Add(1)
+
+				return n, fmt.Errorf("verify record %d of %d: %w", n+1, len(records), err)
+			}
+			w.published.Add(1)
+		case err := <-future.Err():
+			w.failed.Add(1)
+			w.publishFailed(ctx, err)
+
+			if isWrongLastSequence(err) {
+				err = fmt.Errorf("%w: %w", ErrWrongLastSequence, err)
+			}
+
+			err = fmt.Errorf("publish async record %d of %d: %w", n+1, len(records), err)
+			if err := w.deadLetter(ctx, future.Msg(), err); err != nil {
+				return n, err
+			}
+		case <-ctx.Done():
+			return n, ctx.Err()
+		}
+	}
+
+	return written, publishErr
+}
+
+// writeAsync publishes the records without waiting for their acknowledgements.
+// It blocks while the number of pending acknowledgements reaches the maxPendingAsync.
+// Errors of messages which failed to be published are returned by the subsequent call.
+func (w *Writer) writeAsync(ctx context.Context, records []opencdc.Record) (int, error) {
+	if err := w.asyncErr(); err != nil {
+		return 0, err
+	}
+
+	for n, record := range records {
+		if w.publisher.PublishAsyncPending() >= w.maxPendingAsync {
+			if err := w.waitAsyncComplete(ctx); err != nil {
+				return n, err
+			}
+		}
+
+		msg, err := w.newMessage(ctx, record)
+		if err != nil {
+			if w.skipRecord(ctx, err) {
+				continue
+			}
+			w.failed.Add(1)
+
+			return n, err
+		}
+
+		if err := w.checkSize(msg); err != nil {
+			w.failed.Add(1)
+
+			return n, err
+		}
+
+		if _, err := w.publisher.PublishMsgAsync(msg, w.publishOpts...); err != nil {
+			w.failed.Add(1)
+
+			if errors.Is(err, nats.ErrTooManyStalledMsgs) {
+				return n, fmt.Errorf("publish async: %w: %w", ErrPublishAsyncStalled, err)
+			}
+
+			return n, fmt.Errorf("publish async: %w", err)
+		}
+		w.published.Add(1)
+	}
+
+	return len(records), nil
+}
+
+// waitAsyncComplete waits until all pending acknowledgements are received.
+// The wait is bounded by the publishAsyncStallWait if it's set, so a server which stopped
+// acknowledging messages fails the write with ErrPublishAsyncStalled instead of blocking it.
+func (w *Writer) waitAsyncComplete(ctx context.Context) error {
+	var stalled <-chan time.Time
+	if w.publishAsyncStallWait > 0 {
+		timer := time.NewTimer(w.publishAsyncStallWait)
+		defer timer.Stop()
+		stalled = timer.C
+	}
+
+	select {
+	case <-w.publisher.PublishAsyncComplete():
+		return nil
+	case <-stalled:
+		return fmt.Errorf("%w: %d acknowledgements pending for %s",
+			ErrPublishAsyncStalled, w.publisher.PublishAsyncPending(), w.publishAsyncStallWait)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writePubSub publishes the records to core NATS without waiting for any acknowledgement.
+// The messages are buffered by the connection and flushed in the background.
+func (w *Writer) writePubSub(ctx context.Context, records []opencdc.Record) (int, error) {
+	for n, record := range records {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		msg, err := w.newMessage(ctx, record)
+		if err != nil {
+			if w.skipRecord(ctx, err) {
+				continue
+			}
+			w.failed.Add(1)
+
+			return n, err
+		}
+
+		if err := w.checkSize(msg); err != nil {
+			w.failed.Add(1)
+
+			return n, err
+		}
+
+		if err := w.nc.PublishMsg(msg); err != nil {
+			w.failed.Add(1)
+
+			return n, fmt.Errorf("publish: %w", err)
+		}
+		w.published.Add(1)
+	}
+
+	return len(records), nil
+}
+
+// writeKV writes the records to the KV bucket. Delete records delete their keys, or purge
+// them if kvPurgeDeletes is set, and the other records put their payloads under their keys.
+func (w *Writer) writeKV(ctx context.Context, records []opencdc.Record) (int, error) {
+	for n, record := range records {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		if err := w.writeKVRecord(record); err != nil {
+			w.failed.Add(1)
+
+			return n, fmt.Errorf("write record %d of %d to kv bucket: %w", n+1, len(records), err)
+		}
+		w.published.Add(1)
+	}
+
+	return len(records), nil
+}
+
+// writeKVRecord writes a single record to the KV bucket.
+func (w *Writer) writeKVRecord(record opencdc.Record) error {
+	if record.Key == nil || len(record.Key.Bytes()) == 0 {
+		return ErrEmptyKVKey
+	}
+	key := string(record.Key.Bytes())
+
+	switch {
+	case record.Operation == opencdc.OperationDelete && w.kvPurgeDeletes:
+		if err := w.kv.Purge(key); err != nil {
+			return fmt.Errorf("purge key %q: %w", key, err)
+		}
+	case record.Operation == opencdc.OperationDelete:
+		if err := w.kv.Delete(key); err != nil {
+			return fmt.Errorf("delete key %q: %w", key, err)
+		}
+	default:
+		var value []byte
+		if record.Payload.After != nil {
+			value = record.Payload.After.Bytes()
+		}
+
+		if _, err := w.kv.Put(key, value); err != nil {
+			return fmt.Errorf("put key %q: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// writeObjectStore writes the records to the object store. Delete records delete the objects
+// named by their keys, and the other records put their payloads into the objects, overwriting them.
+func (w *Writer) writeObjectStore(ctx context.Context, records []opencdc.Record) (int, error) {
+	for n, record := range records {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		if err := w.writeObject(ctx, record); err != nil {
+			w.failed.Add(1)
+
+			return n, fmt.Errorf("write record %d of %d to object store: %w", n+1, len(records), err)
+		}
+		w.published.Add(1)
+	}
+
+	return len(records), nil
+}
+
+// writeObject writes a single record to the object store.
+func (w *Writer) writeObject(ctx context.Context, record opencdc.Record) error {
+	if record.Key == nil || len(record.Key.Bytes()) == 0 {
+		return ErrEmptyObjectName
+	}
+	name := string(record.Key.Bytes())
+
+	if record.Operation == opencdc.OperationDelete {
+		// the object is already gone if it doesn't exist
+		if err := w.objectStore.Delete(name); err != nil && !errors.Is(err, nats.ErrObjectNotFound) {
+			return fmt.Errorf("delete object %q: %w", name, err)
+		}
+
+		return nil
+	}
+
+	var value []byte
+	if record.Payload.After != nil {
+		value = record.Payload.After.Bytes()
+	}
+
+	// the object is sent in chunks, so large payloads don't exceed the max payload of a message
+	_, err := w.objectStore.Put(&nats.ObjectMeta{Name: name}, bytes.NewReader(value), nats.Context(ctx))
+	if err != nil {
+		return fmt.Errorf("put object %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// deadLetter publishes a message which failed to be published with the publishErr
+// to the deadLetterSubject, along with the error and the original subject in its headers.
+// It returns the publishErr if the deadLetterSubject is not set, the context is done,
+// or the message also fails to be published to the deadLetterSubject.
+func (w *Writer) deadLetter(ctx context.Context, msg *nats.Msg, publishErr error) error {
+	if w.deadLetterSubject == "" || ctx.Err() != nil {
+		return publishErr
+	}
+
+	if w.publishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.publishTimeout)
+		defer cancel()
+	}
+
+	header := make(nats.Header, len(msg.Header)+2)
+	for key, values := range msg.Header {
+		header[key] = values
+	}
+	// the dead-lettered message must not be deduplicated against the original one
+	delete(header, nats.MsgIdHdr)
+	header.Set(deadLetterReasonHeader, publishErr.Error())
+	header.Set(deadLetterSubjectHeader, msg.Subject)
+
+	dlMsg := &nats.Msg{
+		Subject: w.deadLetterSubject,
+		Header:  header,
+		Data:    msg.Data,
+	}
+
+	//nolint:golint,gocritic // false positive, the fix will create a memory leak
+	publishOpts := append(w.publishOpts, nats.Context(ctx))
+
+	if _, err := w.publisher.PublishMsg(dlMsg, publishOpts...); err != nil {
+		return errors.Join(publishErr, fmt.Errorf("publish to dead-letter subject %q: %w", w.deadLetterSubject, err))
+	}
+	w.deadLettered.Add(1)
+
+	sdk.Logger(ctx).Warn().
+		Err(publishErr).
+		Str("subject", msg.Subject).
+		Str("deadLetterSubject", w.deadLetterSubject).
+		Msg("message published to the dead-letter subject")
+
+	return nil
+}
+
+// verifyPubAck checks that a message was acknowledged by the expected stream if verifyPublish is set.
+func (w *Writer) verifyPubAck(ctx context.Context, pubAck *nats.PubAck) error {
+	if !w.verifyPublish {
+		return nil
+	}
+
+	if pubAck == nil {
+		return errors.New("verify publish: missing acknowledgement")
+	}
+
+	if pubAck.Stream != w.stream {
+		return fmt.Errorf("verify publish: message stored in stream %q instead of %q", pubAck.Stream, w.stream)
+	}
+
+	sdk.Logger(ctx).Debug().
+		Str("stream", pubAck.Stream).
+		Uint64("sequence", pubAck.Sequence).
+		Msg("message published")
+
+	return nil
+}
+
+// Stats returns the counters of the Writer's activity.
+func (w *Writer) Stats() WriterStats {
+	stats := WriterStats{
+		Published:    w.published.Load(),
+		Failed:       w.failed.Load(),
+		DeadLettered: w.deadLettered.Load(),
+		Skipped:      w.skipped.Load(),
+	}
+
+	if w.async {
+		stats.PendingAsync = w.publisher.PublishAsyncPending()
+	}
+
+	return stats
+}
+
+// Connected reports whether the underlying NATS connection is currently established.
+func (w *Writer) Connected() bool {
+	return w.nc.IsConnected()
+}
+
+// Validate checks that records can be written without writing any. The connection must be
+// established and, when publishing to JetStream, a stream (the configured one, if set) must
+// capture the subject or each of its partitions. Only the stream is checked for a subject template.
+// If testPublish is set, an empty message with the validateHeader is published to the subject,
+// or its first partition, too, which stores it in the stream.
+func (w *Writer) Validate(ctx context.Context, testPublish bool) error {
+	if !w.nc.IsConnected() {
+		return errors.New("validate: not connected to the NATS server")
+	}
+
+	// the kv bucket and the object store are looked up when the writer is created
+	if w.pubsub || w.kv != nil || w.objectStore != nil {
+		return nil
+	}
+
+	js, err := w.nc.JetStream()
+	if err != nil {
+		return fmt.Errorf("validate: get jetstream context: %w", err)
+	}
+
+	if w.subjectTemplate != nil {
+		if w.stream == "" {
+			return nil
+		}
+
+		if _, err := js.StreamInfo(w.stream, nats.Context(ctx)); err != nil {
+			return fmt.Errorf("validate: get stream %q: %w", w.stream, err)
+		}
+
+		return nil
+	}
+
+	subjects := w.subjects()
+	for _, subject := range subjects {
+		stream, err := js.StreamNameBySubject(subject, nats.Context(ctx))
+		switch {
+		case errors.Is(err, nats.ErrNoMatchingStream):
+			return fmt.Errorf("validate: no stream captures the subject %q: %w", subject, err)
+		case err != nil:
+			return fmt.Errorf("validate: get stream of the subject %q: %w", subject, err)
+		case w.stream != "" && stream != w.stream:
+			return fmt.Errorf("validate: subject %q is captured by stream %q instead of %q", subject, stream, w.stream)
+		}
+	}
+
+	if testPublish {
+		msg := &nats.Msg{
+			Subject: subjects[0],
+			Header:  nats.Header{validateHeader: []string{"true"}},
+		}
+
+		if _, err := w.publisher.PublishMsg(msg, nats.Context(ctx)); err != nil {
+			return fmt.Errorf("validate: test publish to %q: %w", msg.Subject, err)
+		}
+	}
+
+	return nil
+}
+
+// Flush waits until all the asynchronously published messages are acknowledged
+// and returns errors of the ones that failed to be published.
+// In the pubsub mode it flushes the messages buffered by the connection.
+// Records written in the async or the pubsub mode must be considered durable only
+// once Flush returns without an error. Synchronous writes are durable once they return.
+func (w *Writer) Flush(ctx context.Context) error {
+	if w.pubsub {
+		if err := w.nc.FlushWithContext(ctx); err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+
+		return nil
+	}
+
+	if w.async {
+		select {
+		case <-w.publisher.PublishAsyncComplete():
+		case <-ctx.Done():
+			return fmt.Errorf("wait for pending acknowledgements: %w", ctx.Err())
+		}
+	}
+
+	return w.asyncErr()
+}
+
+// Close flushes the Writer, see Flush. The flush is bounded by the closeTimeout if it's set,
+// so a server which doesn't acknowledge the pending messages can't keep the connector from stopping.
+// The returned error means the last written records may not have been stored.
+func (w *Writer) Close(ctx context.Context) error {
+	if w.closeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.closeTimeout)
+		defer cancel()
+	}
+
+	return w.Flush(ctx)
+}
+
+// asyncErrHandler collects errors of failed asynchronous publishes in the async mode.
+// Errors of batches are reported by writeBatch itself.
+func (w *Writer) asyncErrHandler(_ nats.JetStream, msg *nats.Msg, err error) {
+	if !w.async {
+		return
+	}
+
+	// the message was counted as published once it was sent
+	w.published.Add(^uint64(0))
+	w.failed.Add(1)
+
+	if isWrongLastSequence(err) {
+		err = fmt.Errorf("%w: %w", ErrWrongLastSequence, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.asyncErrs = append(w.asyncErrs, fmt.Errorf("publish async to %q: %w", msg.Subject, err))
+}
+
+// publishFailed counts the failed publish in the circuit breaker, unless the server rejected
+// the message itself, which doesn't mean that it's unavailable.
+func (w *Writer) publishFailed(ctx context.Context, err error) {
+	if isWrongLastSequence(err) {
+		return
+	}
+
+	if w.breaker.failure() {
+		sdk.Logger(ctx).Warn().Err(err).
+			Dur("cooldown", w.breaker.cooldown).
+			Msg("too many publish failures, pausing publishing")
+	}
+}
+
+// isWrongLastSequence checks if the err is the server's rejection of a message,
+// whose expected last sequence doesn't match the stream or the subject.
+func isWrongLastSequence(err error) bool {
+	var apiErr *nats.APIError
+
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence
+}
+
+// asyncErr returns the collected errors of failed asynchronous publishes and resets them.
+func (w *Writer) asyncErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := errors.Join(w.asyncErrs...)
+	w.asyncErrs = nil
+
+	return err
+}
+
+// newMessage creates a message with headers taken from the record.
+func (w *Writer) newMessage(ctx context.Context, record opencdc.Record) (*nats.Msg, error) {
+	isDelete := record.Operation == opencdc.OperationDelete
+	if isDelete {
+		switch w.onDelete {
+		case onDeleteSkip:
+			return nil, errDeleteSkipped
+		case onDeleteError:
+			return nil, ErrDeleteRecord
+		}
+	}
+
+	subject, err := w.messageSubject(record)
+	if err != nil {
+		return nil, err
+	}
+
+	// a tombstone has no payload, the payload field of a delete record is usually missing anyway
+	tombstone := isDelete && w.onDelete == onDeleteTombstone
+
+	var payload []byte
+	if !tombstone {
+		payload, err = w.payload(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := internal.EncodePayload(w.payloadEncoding, payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode payload: %w", err)
+	}
+
+	msg := &nats.Msg{
+		Subject: subject,
+		Data:    data,
+	}
+
+	header := w.metadataHeader(record)
+
+	// the content type is a field of its own, it takes precedence over the mapped headers
+	if contentType := record.Metadata[internal.MetadataContentType]; contentType != "" {
+		header[internal.ContentTypeHeader] = []string{contentType}
+	}
+
+	// a payload which already has a content encoding, e.g. forwarded as it was read, isn't compressed again
+	if _, ok := header[internal.ContentEncodingHeader]; !ok {
+		var compressed bool
+		msg.Data, compressed, err = internal.CompressPayload(msg.Data, w.compressThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("compress payload: %w", err)
+		}
+
+		if compressed {
+			header[internal.ContentEncodingHeader] = []string{internal.ContentEncodingGzip}
+		}
+	}
+
+	if tombstone {
+		header[deletedHeader] = []string{"true"}
+	}
+
+	if id := w.msgID(record); id != "" {
+		header[nats.MsgIdHdr] = []string{id}
+	}
+
+	// a missing or malformed creation time is skipped, it's not essential to the message
+	if w.createdAtHeader != "" {
+		if createdAt, err := record.Metadata.GetCreatedAt(); err == nil {
+			header[w.createdAtHeader] = []string{strconv.FormatInt(createdAt.UnixNano(), 10)}
+		}
+	}
+
+	if w.sourcePositionHeader && len(record.Position) > 0 {
+		header[internal.SourcePositionHeader] = []string{base64.StdEncoding.EncodeToString(record.Position)}
+	}
+
+	if w.beforeHeader && record.Operation == opencdc.OperationUpdate && record.Payload.Before != nil {
+		if before := record.Payload.Before.Bytes(); len(before) > 0 {
+			header[internal.BeforeHeader] = []string{base64.StdEncoding.EncodeToString(before)}
+		}
+	}
+
+	// the publish options are shared by all the messages, so the expectations of the record
+	// are written as the headers nats.ExpectLastSequence and nats.ExpectLastSubjectSequence set
+	if err := setExpectedSeq(header, nats.ExpectedLastSeqHdr, record, w.expectedLastSeqMetadata); err != nil {
+		return nil, err
+	}
+
+	err = setExpectedSeq(header, nats.ExpectedLastSubjSeqHdr, record, w.expectedLastSubjectSeqMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.enableTracing {
+		internal.InjectTrace(ctx, record.Metadata, header)
+	}
+
+	// keep the message without headers if there's nothing to send
+	if len(header) > 0 {
+		msg.Header = header
+	}
+
+	return msg, nil
+}
+
+// setExpectedSeq sets the header to the sequence held by the record metadata field.
+// The header isn't set if the field isn't configured or the record doesn't have it.
+func setExpectedSeq(header nats.Header, name string, record opencdc.Record, field string) error {
+	if field == "" {
+		return nil
+	}
+
+	value, ok := record.Metadata[field]
+	if !ok {
+		return nil
+	}
+
+	seq, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parse expected sequence of metadata field %q: %w", field, err)
+	}
+
+	header[name] = []string{strconv.FormatUint(seq, 10)}
+
+	return nil
+}
+
+// parsePayloadField splits the dot separated path to a payload field into the names of the nested fields.
+func parsePayloadField(payloadField string) ([]string, error) {
+	if payloadField == "" {
+		return nil, nil
+	}
+
+	names := strings.Split(payloadField, ".")
+	if slices.Contains(names, "") {
+		return nil, fmt.Errorf("payload field %q must be a dot separated path without empty field names", payloadField)
+	}
+
+	return names, nil
+}
+
+// payload returns the value of the payloadField of the record's structured payload,
+// or the whole record if the payloadField isn't set.
+func (w *Writer) payload(record opencdc.Record) ([]byte, error) {
+	if len(w.payloadField) == 0 {
+		return record.Bytes(), nil
+	}
+
+	path := strings.Join(w.payloadField, ".")
+
+	var value any
+	switch after := record.Payload.After.(type) {
+	case opencdc.StructuredData:
+		value = map[string]any(after)
+	case opencdc.RawData:
+		if err := json.Unmarshal(after, &value); err != nil {
+			return nil, fmt.Errorf("payload field %q: parse raw payload as JSON: %w", path, err)
+		}
+	}
+
+	for _, name := range w.payloadField {
+		var fields map[string]any
+		switch v := value.(type) {
+		case map[string]any:
+			fields = v
+		case opencdc.StructuredData:
+			fields = v
+		}
+
+		var ok bool
+		if value, ok = fields[name]; !ok {
+			return nil, fmt.Errorf("payload field %q: %w", path, ErrMissingPayloadField)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("payload field %q: marshal value: %w", path, err)
+		}
+
+		return data, nil
+	}
+}
+
+// checkSize returns ErrPayloadTooLarge if the payload and the headers of the msg are larger than
+// the maxPayload, as the server would reject it with a generic error anyway.
+func (w *Writer) checkSize(msg *nats.Msg) error {
+	if w.maxPayload <= 0 {
+		return nil
+	}
+
+	// the server limits the size of the headers and the payload, but not of the subject
+	size := int64(msg.Size() - len(msg.Subject) - len(msg.Reply))
+	if size <= w.maxPayload {
+		return nil
+	}
+
+	return fmt.Errorf("%w: message to %q of %d bytes exceeds the server's max payload of %d bytes",
+		ErrPayloadTooLarge, msg.Subject, size, w.maxPayload)
+}
+
+// withoutPayload returns a copy of the msg without the payload, which can be dead-lettered
+// even if the payload is too large.
+func withoutPayload(msg *nats.Msg) *nats.Msg {
+	return &nats.Msg{Subject: msg.Subject, Header: msg.Header}
+}
+
+// skipRecord reports whether the record whose message couldn't be created because of the err
+// is skipped instead of failing the write.
+func (w *Writer) skipRecord(ctx context.Context, err error) bool {
+	switch {
+	case errors.Is(err, errDeleteSkipped):
+		// skipping deletes is what the OnDelete policy asks for, it's not worth a warning
+	case w.skipMissingPayloadField && errors.Is(err, ErrMissingPayloadField):
+		sdk.Logger(ctx).Warn().Err(err).Msg("skipping record without the payload field")
+	default:
+		return false
+	}
+	w.skipped.Add(1)
+
+	return true
+}
+
+// messageSubject returns the subject of a message evaluating the subjectTemplate against the record,
+// or the static subject if there's no template, followed by the partition of the record, if any.
+func (w *Writer) messageSubject(record opencdc.Record) (string, error) {
+	if w.subjectTemplate == nil {
+		return w.partitionSubject(w.subject, record), nil
+	}
+
+	var sb strings.Builder
+	if err := w.subjectTemplate.Execute(&sb, record); err != nil {
+		return "", fmt.Errorf("execute subject template: %w", err)
+	}
+
+	subject := internal.PrefixSubject(w.subjectPrefix, sb.String())
+	if err := internal.ValidateSubject(subject, false); err != nil {
+		return "", fmt.Errorf("evaluate subject template: %w", err)
+	}
+
+	return w.partitionSubject(subject, record), nil
+}
+
+// partitionSubject appends the partition of the record to the subject if the partitions are set.
+func (w *Writer) partitionSubject(subject string, record opencdc.Record) string {
+	if w.partitions <= 1 {
+		return subject
+	}
+
+	return subject + "." + strconv.Itoa(w.partition(record))
+}
+
+// partition returns the partition of the record based on a FNV-1a hash of its key,
+// so records with the same key always end up in the same partition. Records without
+// a key are published to the emptyKeyPartition, or to all the partitions in turns.
+func (w *Writer) partition(record opencdc.Record) int {
+	var key []byte
+	if record.Key != nil {
+		key = record.Key.Bytes()
+	}
+
+	if len(key) == 0 {
+		if w.emptyKeyPartition != roundRobinPartition {
+			return w.emptyKeyPartition
+		}
+
+		return int((w.nextPartition.Add(1) - 1) % uint64(w.partitions)) //nolint:gosec // partitions is positive
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+
+	return int(h.Sum32() % uint32(w.partitions)) //nolint:gosec // partitions is positive
+}
+
+// subjects returns the static subject, or all its partitions if the partitions are set.
+func (w *Writer) subjects() []string {
+	if w.partitions <= 1 {
+		return []string{w.subject}
+	}
+
+	subjects := make([]string, w.partitions)
+	for n := range subjects {
+		subjects[n] = w.subject + "." + strconv.Itoa(n)
+	}
+
+	return subjects
+}
+
+// metadataHeader returns message headers taken from the record metadata according to the metadataHeaders.
+func (w *Writer) metadataHeader(record opencdc.Record) nats.Header {
+	header := make(nats.Header)
+	if w.metadataHeaders == metadataHeadersNone {
+		return header
+	}
+
+	for key, value := range record.Metadata {
+		name, ok := strings.CutPrefix(key, internal.MetadataHeaderPrefix)
+		if !ok && w.metadataHeaders != metadataHeadersAll {
+			continue
+		}
+
+		// assign directly to preserve the key as is, without canonicalization
+		header[name] = []string{value}
+	}
+
+	return header
+}
+
+// msgID returns the ID of the message used by the server for deduplication
+// taken from the record according to the msgIDField.
+// It returns an empty string if the ID is not configured or not present in the record.
+func (w *Writer) msgID(record opencdc.Record) string {
+	switch {
+	case w.msgIDField == "":
+		return ""
+	case w.msgIDField == msgIDFieldKey:
+		if record.Key == nil {
+			return ""
+		}
+
+		return string(record.Key.Bytes())
+	case w.msgIDField == msgIDFieldPayload:
+		var payload []byte
+		if record.Payload.After != nil {
+			payload = record.Payload.After.Bytes()
+		}
+		sum := sha256.Sum256(payload)
+
+		return hex.EncodeToString(sum[:])
+	default:
+		return record.Metadata[strings.TrimPrefix(w.msgIDField, msgIDFieldMetadataPrefix)]
+	}
+}
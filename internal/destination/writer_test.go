@@ -0,0 +1,1648 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+)
+
+func TestWriter_newMessage(t *testing.T) {
+	record := opencdc.Record{
+		Metadata: opencdc.Metadata{
+			"nats.header.Trace-Id": "abc",
+			"opencdc.createdAt":    "1700000000000000000",
+		},
+		Payload: opencdc.Change{After: opencdc.RawData("hello")},
+	}
+
+	tests := []struct {
+		name            string
+		metadataHeaders string
+		record          opencdc.Record
+		want            nats.Header
+	}{
+		{
+			name:            "prefixed",
+			metadataHeaders: metadataHeadersPrefixed,
+			record:          record,
+			want:            nats.Header{"Trace-Id": []string{"abc"}},
+		},
+		{
+			name:            "all",
+			metadataHeaders: metadataHeadersAll,
+			record:          record,
+			want: nats.Header{
+				"Trace-Id":          []string{"abc"},
+				"opencdc.createdAt": []string{"1700000000000000000"},
+			},
+		},
+		{
+			name:            "none",
+			metadataHeaders: metadataHeadersNone,
+			record:          record,
+			want:            nil,
+		},
+		{
+			name:            "content type",
+			metadataHeaders: metadataHeadersNone,
+			record: opencdc.Record{
+				Metadata: opencdc.Metadata{
+					"nats.contentType":         "application/json",
+					"nats.header.Content-Type": "text/plain",
+				},
+				Payload: opencdc.Change{After: opencdc.RawData("{}")},
+			},
+			want: nats.Header{"Content-Type": []string{"application/json"}},
+		},
+		{
+			name:            "no matching metadata",
+			metadataHeaders: metadataHeadersPrefixed,
+			record:          opencdc.Record{Payload: opencdc.Change{After: opencdc.RawData("hello")}},
+			want:            nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			w := &Writer{subject: "foo", metadataHeaders: tt.metadataHeaders}
+
+			msg, err := w.newMessage(context.Background(), tt.record)
+			is.NoErr(err)
+			is.Equal(msg.Subject, "foo")
+			is.Equal(msg.Data, tt.record.Bytes())
+			is.Equal(msg.Header, tt.want)
+		})
+	}
+}
+
+func TestWriter_newMessage_createdAtHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		createdAt string
+		want      []string
+	}{
+		{
+			name:      "valid creation time",
+			createdAt: "1700000000000000000",
+			want:      []string{"1700000000000000000"},
+		},
+		{
+			name:      "malformed creation time",
+			createdAt: "yesterday",
+		},
+		{
+			name: "missing creation time",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			record := opencdc.Record{Metadata: opencdc.Metadata{}}
+			if tt.createdAt != "" {
+				record.Metadata["opencdc.createdAt"] = tt.createdAt
+			}
+
+			w := &Writer{subject: "foo", createdAtHeader: "Conduit-Created-At"}
+
+			msg, err := w.newMessage(context.Background(), record)
+			is.NoErr(err)
+			is.Equal(msg.Header["Conduit-Created-At"], tt.want)
+		})
+	}
+}
+
+func TestWriter_newMessage_sourcePositionHeader(t *testing.T) {
+	is := is.New(t)
+
+	record := opencdc.Record{Position: opencdc.Position(`{"opt_seq":1}`)}
+
+	w := &Writer{subject: "foo", sourcePositionHeader: true}
+
+	msg, err := w.newMessage(context.Background(), record)
+	is.NoErr(err)
+	is.Equal(msg.Header.Get("Conduit-Source-Position"), "eyJvcHRfc2VxIjoxfQ==")
+
+	// records without a position are published without the header
+	msg, err = w.newMessage(context.Background(), opencdc.Record{})
+	is.NoErr(err)
+	is.Equal(msg.Header, nil)
+
+	// the header is written only if requested
+	w.sourcePositionHeader = false
+
+	msg, err = w.newMessage(context.Background(), record)
+	is.NoErr(err)
+	is.Equal(msg.Header, nil)
+}
+
+func TestWriter_newMessage_beforeHeader(t *testing.T) {
+	is := is.New(t)
+
+	record := opencdc.Record{
+		Operation: opencdc.OperationUpdate,
+		Payload: opencdc.Change{
+			Before: opencdc.RawData("hi"),
+			After:  opencdc.RawData("hello"),
+		},
+	}
+
+	w := &Writer{subject: "foo", beforeHeader: true}
+
+	msg, err := w.newMessage(context.Background(), record)
+	is.NoErr(err)
+	is.Equal(msg.Header.Get("Conduit-Before"), "aGk=")
+
+	// only update records with the payload before the change have the header
+	msg, err = w.newMessage(context.Background(), opencdc.Record{
+		Operation: opencdc.OperationCreate,
+		Payload:   record.Payload,
+	})
+	is.NoErr(err)
+	is.Equal(msg.Header, nil)
+
+	msg, err = w.newMessage(context.Background(), opencdc.Record{
+		Operation: opencdc.OperationUpdate,
+		Payload:   opencdc.Change{After: opencdc.RawData("hello")},
+	})
+	is.NoErr(err)
+	is.Equal(msg.Header, nil)
+
+	// the header is written only if requested
+	w.beforeHeader = false
+
+	msg, err = w.newMessage(context.Background(), record)
+	is.NoErr(err)
+	is.Equal(msg.Header, nil)
+}
+
+func TestWriter_newMessage_tracing(t *testing.T) {
+	is := is.New(t)
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	record := opencdc.Record{Metadata: opencdc.Metadata{"traceparent": traceparent}}
+
+	w := &Writer{subject: "foo", metadataHeaders: metadataHeadersNone, enableTracing: true}
+
+	msg, err := w.newMessage(context.Background(), record)
+	is.NoErr(err)
+	is.Equal(msg.Header.Get("traceparent"), traceparent)
+
+	// records without a trace context are published without the header
+	msg, err = w.newMessage(context.Background(), opencdc.Record{})
+	is.NoErr(err)
+	is.Equal(msg.Header, nil)
+
+	// the trace context is written only if requested
+	w.enableTracing = false
+
+	msg, err = w.newMessage(context.Background(), record)
+	is.NoErr(err)
+	is.Equal(msg.Header, nil)
+}
+
+func TestWriter_newMessage_expectedLastSeq(t *testing.T) {
+	is := is.New(t)
+
+	w := &Writer{
+		subject:                        "foo",
+		expectedLastSeqMetadata:        "expected-seq",
+		expectedLastSubjectSeqMetadata: "expected-subject-seq",
+	}
+
+	msg, err := w.newMessage(context.Background(), opencdc.Record{Metadata: opencdc.Metadata{
+		"expected-seq":         "42",
+		"expected-subject-seq": "0",
+	}})
+	is.NoErr(err)
+	is.Equal(msg.Header.Get(nats.ExpectedLastSeqHdr), "42")
+	is.Equal(msg.Header.Get(nats.ExpectedLastSubjSeqHdr), "0")
+
+	// records without the fields are published without the expectations
+	msg, err = w.newMessage(context.Background(), opencdc.Record{})
+	is.NoErr(err)
+	is.Equal(msg.Header, nil)
+
+	_, err = w.newMessage(context.Background(), opencdc.Record{Metadata: opencdc.Metadata{"expected-seq": "-1"}})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `metadata field "expected-seq"`))
+}
+
+func TestWriter_newMessage_compress(t *testing.T) {
+	record := opencdc.Record{
+		Payload: opencdc.Change{After: opencdc.RawData(strings.Repeat(`{"id":1,"name":"foo"}`, 10))},
+	}
+	data := record.Bytes()
+
+	t.Run("above the threshold", func(t *testing.T) {
+		is := is.New(t)
+
+		w := &Writer{subject: "foo", compressThreshold: 100}
+
+		msg, err := w.newMessage(context.Background(), record)
+		is.NoErr(err)
+		is.Equal(msg.Header.Get("Content-Encoding"), "gzip")
+		is.True(len(msg.Data) < len(data))
+
+		// the source decompresses it based on the header
+		decompressed, ok, err := internal.DecompressPayload(msg.Header.Get("Content-Encoding"), msg.Data)
+		is.NoErr(err)
+		is.True(ok)
+		is.Equal(decompressed, data)
+	})
+
+	t.Run("below the threshold", func(t *testing.T) {
+		is := is.New(t)
+
+		w := &Writer{subject: "foo", compressThreshold: len(data) + 1}
+
+		msg, err := w.newMessage(context.Background(), record)
+		is.NoErr(err)
+		is.Equal(msg.Header, nil)
+		is.Equal(msg.Data, data)
+	})
+
+	t.Run("already encoded", func(t *testing.T) {
+		is := is.New(t)
+
+		w := &Writer{subject: "foo", compressThreshold: 100, metadataHeaders: metadataHeadersPrefixed}
+
+		encoded := record.Clone()
+		encoded.Metadata = opencdc.Metadata{"nats.header.Content-Encoding": "br"}
+
+		msg, err := w.newMessage(context.Background(), encoded)
+		is.NoErr(err)
+		is.Equal(msg.Header.Get("Content-Encoding"), "br")
+		is.Equal(msg.Data, encoded.Bytes())
+	})
+}
+
+func TestWriter_newMessage_payloadEncoding(t *testing.T) {
+	is := is.New(t)
+
+	w := &Writer{subject: "foo", payloadEncoding: internal.PayloadEncodingBase64}
+
+	record := opencdc.Record{Payload: opencdc.Change{After: opencdc.RawData("hello")}}
+
+	msg, err := w.newMessage(context.Background(), record)
+	is.NoErr(err)
+
+	decoded, err := internal.DecodePayload(internal.PayloadEncodingBase64, msg.Data)
+	is.NoErr(err)
+	is.Equal(decoded, record.Bytes())
+}
+
+func TestWriter_newMessage_payloadField(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload opencdc.Data
+		want    []byte
+		wantErr error
+	}{
+		{
+			name: "string field of a structured payload",
+			payload: opencdc.StructuredData{
+				"data": map[string]any{"body": "hello"},
+			},
+			want: []byte("hello"),
+		},
+		{
+			name: "object field of a structured payload",
+			payload: opencdc.StructuredData{
+				"data": opencdc.StructuredData{"body": map[string]any{"id": 1}},
+			},
+			want: []byte(`{"id":1}`),
+		},
+		{
+			name:    "field of a raw JSON payload",
+			payload: opencdc.RawData(`{"data":{"body":"hello"}}`),
+			want:    []byte("hello"),
+		},
+		{
+			name:    "missing field",
+			payload: opencdc.StructuredData{"data": map[string]any{"id": 1}},
+			wantErr: ErrMissingPayloadField,
+		},
+		{
+			name:    "parent isn't an object",
+			payload: opencdc.StructuredData{"data": "hello"},
+			wantErr: ErrMissingPayloadField,
+		},
+		{
+			name:    "no payload",
+			wantErr: ErrMissingPayloadField,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			w := &Writer{subject: "foo", payloadField: []string{"data", "body"}}
+
+			msg, err := w.newMessage(context.Background(), opencdc.Record{
+				Payload: opencdc.Change{After: tt.payload},
+			})
+			if tt.wantErr != nil {
+				is.True(errors.Is(err, tt.wantErr))
+
+				return
+			}
+			is.NoErr(err)
+			is.Equal(msg.Data, tt.want)
+		})
+	}
+}
+
+func TestWriter_newMessage_onDelete(t *testing.T) {
+	// delete records usually don't have the payload after the change
+	deleteRecord := opencdc.Record{
+		Operation: opencdc.OperationDelete,
+		Key:       opencdc.RawData("1"),
+		Payload:   opencdc.Change{Before: opencdc.RawData("hello")},
+	}
+
+	t.Run("publish", func(t *testing.T) {
+		is := is.New(t)
+
+		w := &Writer{subject: "foo", onDelete: onDeletePublish}
+
+		msg, err := w.newMessage(context.Background(), deleteRecord)
+		is.NoErr(err)
+		is.Equal(msg.Data, deleteRecord.Bytes())
+		is.Equal(msg.Header, nil)
+
+		// the payload field of a delete record is missing
+		w.payloadField = []string{"body"}
+		_, err = w.newMessage(context.Background(), deleteRecord)
+		is.True(errors.Is(err, ErrMissingPayloadField))
+	})
+
+	t.Run("tombstone", func(t *testing.T) {
+		is := is.New(t)
+
+		w := &Writer{subject: "foo", onDelete: onDeleteTombstone, payloadField: []string{"body"}}
+
+		msg, err := w.newMessage(context.Background(), deleteRecord)
+		is.NoErr(err)
+		is.Equal(len(msg.Data), 0)
+		is.Equal(msg.Header.Get(deletedHeader), "true")
+
+		// other records are published as they are
+		msg, err = w.newMessage(context.Background(), opencdc.Record{
+			Operation: opencdc.OperationCreate,
+			Payload:   opencdc.Change{After: opencdc.StructuredData{"body": "hello"}},
+		})
+		is.NoErr(err)
+		is.Equal(msg.Data, []byte("hello"))
+		is.Equal(msg.Header, nil)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		is := is.New(t)
+		ctx := context.Background()
+
+		publisher := &mockJetstreamPublisher{}
+		w := &Writer{subject: "foo", publisher: publisher, onDelete: onDeleteSkip}
+
+		is.NoErr(w.write(ctx, deleteRecord))
+		is.Equal(len(publisher.published), 0)
+		is.Equal(w.Stats(), WriterStats{Skipped: 1})
+	})
+
+	t.Run("error", func(t *testing.T) {
+		is := is.New(t)
+
+		w := &Writer{subject: "foo", onDelete: onDeleteError}
+
+		_, err := w.newMessage(context.Background(), deleteRecord)
+		is.True(errors.Is(err, ErrDeleteRecord))
+	})
+}
+
+func TestWriter_messageSubject(t *testing.T) {
+	record := opencdc.Record{
+		Operation: opencdc.OperationUpdate,
+		Metadata:  opencdc.Metadata{"tenant": "acme"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "static subject",
+			want: "foo",
+		},
+		{
+			name:     "template",
+			template: "events.{{.Metadata.tenant}}.{{.Operation}}",
+			want:     "events.acme.update",
+		},
+		{
+			name:     "missing metadata field",
+			template: "events.{{.Metadata.region}}",
+			wantErr:  true,
+		},
+		{
+			name:     "empty subject",
+			template: "{{if false}}foo{{end}}",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid subject",
+			template: "events.{{.Metadata.tenant}}.*",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			w, err := NewWriter(writerParams{
+				nc:              &natsMock{},
+				subject:         "foo",
+				subjectTemplate: tt.template,
+			})
+			is.NoErr(err)
+
+			msg, err := w.newMessage(context.Background(), record)
+			if tt.wantErr {
+				is.True(err != nil)
+
+				return
+			}
+			is.NoErr(err)
+			is.Equal(msg.Subject, tt.want)
+		})
+	}
+}
+
+func TestWriter_messageSubject_prefix(t *testing.T) {
+	is := is.New(t)
+
+	record := opencdc.Record{Operation: opencdc.OperationCreate}
+
+	w, err := NewWriter(writerParams{nc: &natsMock{}, subject: "foo", subjectPrefix: "tenant"})
+	is.NoErr(err)
+
+	msg, err := w.newMessage(context.Background(), record)
+	is.NoErr(err)
+	is.Equal(msg.Subject, "tenant.foo")
+
+	// the subjects evaluated from the template are prefixed as well
+	w, err = NewWriter(writerParams{
+		nc:              &natsMock{},
+		subject:         "foo",
+		subjectPrefix:   "tenant",
+		subjectTemplate: "events.{{.Operation}}",
+	})
+	is.NoErr(err)
+
+	msg, err = w.newMessage(context.Background(), record)
+	is.NoErr(err)
+	is.Equal(msg.Subject, "tenant.events.create")
+}
+
+func TestWriter_messageSubject_partitions(t *testing.T) {
+	is := is.New(t)
+
+	w, err := NewWriter(writerParams{
+		nc:                &natsMock{},
+		subject:           "events",
+		partitions:        4,
+		emptyKeyPartition: roundRobinPartition,
+	})
+	is.NoErr(err)
+
+	// records with the same key always end up in the same partition
+	partitions := make(map[string]bool)
+	for n := range 100 {
+		key := opencdc.RawData(fmt.Sprintf("key-%d", n))
+
+		subject, err := w.messageSubject(opencdc.Record{Key: key})
+		is.NoErr(err)
+
+		again, err := w.messageSubject(opencdc.Record{Key: key})
+		is.NoErr(err)
+		is.Equal(subject, again)
+
+		partitions[subject] = true
+	}
+	is.Equal(partitions, map[string]bool{"events.0": true, "events.1": true, "events.2": true, "events.3": true})
+
+	// records without a key are spread across the partitions in turns
+	for _, want := range []string{"events.0", "events.1", "events.2", "events.3", "events.0"} {
+		subject, err := w.messageSubject(opencdc.Record{})
+		is.NoErr(err)
+		is.Equal(subject, want)
+	}
+
+	// or published to a fixed partition
+	w.emptyKeyPartition = 2
+	subject, err := w.messageSubject(opencdc.Record{Key: opencdc.RawData{}})
+	is.NoErr(err)
+	is.Equal(subject, "events.2")
+
+	// the partition is appended to the subjects evaluated from the template as well
+	w, err = NewWriter(writerParams{
+		nc:              &natsMock{},
+		subject:         "foo",
+		subjectTemplate: "events.{{.Operation}}",
+		partitions:      2,
+	})
+	is.NoErr(err)
+
+	subject, err = w.messageSubject(opencdc.Record{Operation: opencdc.OperationCreate})
+	is.NoErr(err)
+	is.Equal(subject, "events.create.0")
+
+	_, err = NewWriter(writerParams{nc: &natsMock{}, subject: "events", partitions: 2, emptyKeyPartition: 2})
+	is.Equal(err.Error(), "empty key partition 2 must be less than the number of partitions 2")
+}
+
+func TestNewWriter_invalidSubject(t *testing.T) {
+	is := is.New(t)
+
+	_, err := NewWriter(writerParams{nc: &natsMock{}, subject: "foo.*"})
+	is.True(errors.Is(err, internal.ErrInvalidSubject))
+
+	// wildcards are allowed in the fallback subject of a subject template
+	_, err = NewWriter(writerParams{nc: &natsMock{}, subject: "foo.*", subjectTemplate: "foo.{{.Operation}}"})
+	is.NoErr(err)
+}
+
+func TestNewWriter_invalidSubjectTemplate(t *testing.T) {
+	is := is.New(t)
+
+	_, err := NewWriter(writerParams{
+		nc:              &natsMock{},
+		subject:         "foo",
+		subjectTemplate: "events.{{.Metadata.tenant",
+	})
+	is.True(err != nil)
+}
+
+func TestNewWriter_invalidPayloadField(t *testing.T) {
+	is := is.New(t)
+
+	_, err := NewWriter(writerParams{nc: &natsMock{}, subject: "foo", payloadField: "data..body"})
+	is.Equal(err.Error(), `payload field "data..body" must be a dot separated path without empty field names`)
+}
+
+func TestWriter_writeBatch_skipMissingPayloadField(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	publisher := &mockJetstreamPublisher{failedWrites: 1, err: errors.New("stream unavailable")}
+	w := &Writer{
+		subject:                 "foo",
+		publisher:               publisher,
+		payloadField:            []string{"body"},
+		skipMissingPayloadField: true,
+	}
+
+	records := []opencdc.Record{
+		{Payload: opencdc.Change{After: opencdc.StructuredData{"id": 1}}},
+		{Payload: opencdc.Change{After: opencdc.StructuredData{"body": "hello"}}},
+	}
+
+	// the failed record follows the skipped one
+	written, err := w.writeBatch(ctx, records)
+	is.True(errors.Is(err, publisher.err))
+	is.Equal(written, 1)
+
+	written, err = w.writeBatch(ctx, records)
+	is.NoErr(err)
+	is.Equal(written, 2)
+	is.Equal(w.Stats(), WriterStats{Published: 1, Failed: 1, Skipped: 2})
+
+	// without skipping, the missing field fails the write
+	w.skipMissingPayloadField = false
+	written, err = w.writeBatch(ctx, records)
+	is.True(errors.Is(err, ErrMissingPayloadField))
+	is.Equal(written, 0)
+}
+
+func TestWriter_verifyPublish(t *testing.T) {
+	records := []opencdc.Record{
+		{Payload: opencdc.Change{After: opencdc.RawData("foo")}},
+		{Payload: opencdc.Change{After: opencdc.RawData("bar")}},
+	}
+
+	tests := []struct {
+		name    string
+		pubAck  *nats.PubAck
+		wantErr bool
+	}{
+		{
+			name:   "expected stream",
+			pubAck: &nats.PubAck{Stream: "orders", Sequence: 7},
+		},
+		{
+			name:    "different stream",
+			pubAck:  &nats.PubAck{Stream: "payments", Sequence: 7},
+			wantErr: true,
+		},
+		{
+			name:    "missing acknowledgement",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+
+			w := &Writer{
+				subject:       "foo",
+				publisher:     &mockJetstreamPublisher{pubAck: tt.pubAck},
+				verifyPublish: true,
+				stream:        "orders",
+			}
+
+			err := w.write(ctx, records[0])
+			is.Equal(err != nil, tt.wantErr)
+
+			written, err := w.writeBatch(ctx, records)
+			is.Equal(err != nil, tt.wantErr)
+			if !tt.wantErr {
+				is.Equal(written, 2)
+			} else {
+				is.Equal(written, 0)
+			}
+		})
+	}
+}
+
+func TestWriter_writePubSub(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	nc := &natsMock{}
+	w, err := NewWriter(writerParams{
+		nc:      nc,
+		subject: "foo",
+		pubsub:  true,
+		async:   true,
+	})
+	is.NoErr(err)
+	is.True(!w.async)
+
+	records := []opencdc.Record{
+		{Payload: opencdc.Change{After: opencdc.RawData("foo")}},
+		{Payload: opencdc.Change{After: opencdc.RawData("bar")}},
+	}
+
+	written, err := w.writePubSub(ctx, records)
+	is.NoErr(err)
+	is.Equal(written, 2)
+	is.Equal(len(nc.published), 2)
+	is.Equal(nc.published[1].Data, records[1].Bytes())
+
+	// buffered messages are flushed when the writer is closed
+	is.NoErr(w.Close(ctx))
+	is.True(nc.flushCalled)
+
+	nc.publishErr = errors.New("connection closed")
+
+	written, err = w.writePubSub(ctx, records)
+	is.True(errors.Is(err, nc.publishErr))
+	is.Equal(written, 0)
+	is.Equal(w.Stats(), WriterStats{Published: 2, Failed: 1})
+}
+
+func TestWriter_write_retriesExhausted(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	w := &Writer{
+		subject:       "foo",
+		retryAttempts: 3,
+		publisher: &mockJetstreamPublisher{
+			failedWrites: 1,
+			err:          nats.ErrNoStreamResponse,
+		},
+	}
+
+	record := opencdc.Record{Payload: opencdc.Change{After: opencdc.RawData("foo")}}
+
+	err := w.write(ctx, record)
+	is.True(errors.Is(err, ErrPublishRetriesExhausted))
+	is.True(errors.Is(err, nats.ErrNoStreamResponse))
+	is.True(strings.Contains(err.Error(), `"foo" failed after 4 attempts`))
+
+	// other errors are returned as they are
+	w.publisher = &mockJetstreamPublisher{failedWrites: 1, err: nats.ErrConnectionClosed}
+
+	err = w.write(ctx, record)
+	is.True(!errors.Is(err, ErrPublishRetriesExhausted))
+	is.True(errors.Is(err, nats.ErrConnectionClosed))
+}
+
+func TestWriter_write_circuitBreaker(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	publisher := &mockJetstreamPublisher{failedWrites: 2, err: nats.ErrNoResponders}
+	w := &Writer{
+		subject:   "foo",
+		publisher: publisher,
+		breaker:   newCircuitBreaker(2, time.Minute, time.Minute),
+	}
+
+	record := opencdc.Record{Payload: opencdc.Change{After: opencdc.RawData("hello")}}
+
+	is.True(errors.Is(w.write(ctx, record), nats.ErrNoResponders))
+	is.True(errors.Is(w.write(ctx, record), nats.ErrNoResponders))
+
+	// the breaker is open, so the record isn't published
+	err := w.write(ctx, record)
+	is.True(errors.Is(err, ErrCircuitOpen))
+	is.Equal(publisher.totalWrites, 2)
+
+	_, err = w.writeBatch(ctx, []opencdc.Record{record, record})
+	is.True(errors.Is(err, ErrCircuitOpen))
+	is.Equal(publisher.totalWrites, 2)
+
+	// the probe after the cooldown succeeds
+	w.breaker.openUntil = time.Now().Add(-time.Second)
+	is.NoErr(w.write(ctx, record))
+	is.NoErr(w.write(ctx, record))
+	is.Equal(w.Stats(), WriterStats{Published: 2, Failed: 2})
+}
+
+func TestWriter_maxPayload(t *testing.T) {
+	small := opencdc.Record{Payload: opencdc.Change{After: opencdc.RawData("foo")}}
+	large := opencdc.Record{Payload: opencdc.Change{After: opencdc.RawData(strings.Repeat("a", 200))}}
+
+	t.Run("max payload is taken from the connection", func(t *testing.T) {
+		is := is.New(t)
+
+		w, err := NewWriter(writerParams{nc: &natsMock{maxPayload: 1024}, subject: "foo", pubsub: true})
+		is.NoErr(err)
+		is.Equal(w.maxPayload, int64(1024))
+	})
+
+	t.Run("oversized record isn't published", func(t *testing.T) {
+		is := is.New(t)
+		ctx := context.Background()
+
+		publisher := &mockJetstreamPublisher{}
+		w := &Writer{subject: "foo", publisher: publisher, maxPayload: int64(len(small.Bytes()))}
+
+		is.NoErr(w.write(ctx, small))
+
+		err := w.write(ctx, large)
+		is.True(errors.Is(err, ErrPayloadTooLarge))
+		is.True(strings.Contains(err.Error(), fmt.Sprintf("of %d bytes exceeds the server's max payload of %d bytes",
+			len(large.Bytes()), len(small.Bytes()))))
+		is.Equal(len(publisher.published), 1)
+		is.Equal(w.Stats(), WriterStats{Published: 1, Failed: 1})
+	})
+
+	t.Run("headers count towards the size", func(t *testing.T) {
+		is := is.New(t)
+
+		w := &Writer{subject: "foo", maxPayload: int64(len(small.Bytes()))}
+
+		msg := &nats.Msg{Subject: "foo", Data: small.Bytes()}
+		is.NoErr(w.checkSize(msg))
+
+		msg.Header = nats.Header{"Trace-Id": []string{"abc"}}
+		is.True(errors.Is(w.checkSize(msg), ErrPayloadTooLarge))
+	})
+
+	t.Run("oversized record is dead-lettered without the payload", func(t *testing.T) {
+		is := is.New(t)
+		ctx := context.Background()
+
+		publisher := &mockJetstreamPublisher{}
+		w := &Writer{
+			subject:           "foo",
+			publisher:         publisher,
+			deadLetterSubject: "foo.dlq",
+			maxPayload:        int64(len(small.Bytes())),
+		}
+
+		written, err := w.writeBatch(ctx, []opencdc.Record{large, small})
+		is.NoErr(err)
+		is.Equal(written, 2)
+
+		dlMsg := publisher.published[0]
+		is.Equal(dlMsg.Subject, "foo.dlq")
+		is.Equal(len(dlMsg.Data), 0)
+		is.Equal(dlMsg.Header.Get(deadLetterSubjectHeader), "foo")
+		is.True(strings.Contains(dlMsg.Header.Get(deadLetterReasonHeader), "payload too large"))
+		is.Equal(w.Stats(), WriterStats{Published: 1, Failed: 1, DeadLettered: 1})
+	})
+}
+
+func TestWriter_deadLetter(t *testing.T) {
+	record := opencdc.Record{
+		Metadata: opencdc.Metadata{"nats.header.Trace-Id": "abc"},
+		Payload:  opencdc.Change{After: opencdc.RawData("foo")},
+	}
+
+	t.Run("failed message is dead-lettered", func(t *testing.T) {
+		is := is.New(t)
+		ctx := context.Background()
+
+		publisher := &mockJetstreamPublisher{failedWrites: 1, err: nats.ErrNoStreamResponse}
+		w := &Writer{
+			subject:           "foo",
+			metadataHeaders:   metadataHeadersPrefixed,
+			publisher:         publisher,
+			deadLetterSubject: "foo.dlq",
+		}
+
+		is.NoErr(w.write(ctx, record))
+		is.Equal(len(publisher.published), 2)
+
+		dlMsg := publisher.published[1]
+		is.Equal(dlMsg.Subject, "foo.dlq")
+		is.Equal(dlMsg.Data, record.Bytes())
+		is.Equal(dlMsg.Header.Get(deadLetterSubjectHeader), "foo")
+		is.True(strings.Contains(dlMsg.Header.Get(deadLetterReasonHeader), "publish retries exhausted"))
+		// the original headers are kept
+		is.Equal(dlMsg.Header["Trace-Id"], []string{"abc"})
+		is.Equal(w.Stats(), WriterStats{Failed: 1, DeadLettered: 1})
+	})
+
+	t.Run("failed batch message is dead-lettered", func(t *testing.T) {
+		is := is.New(t)
+		ctx := context.Background()
+
+		publisher := &mockJetstreamPublisher{failedWrites: 1, err: errors.New("an error")}
+		w := &Writer{
+			subject:           "foo",
+			publisher:         publisher,
+			deadLetterSubject: "foo.dlq",
+		}
+
+		written, err := w.writeBatch(ctx, []opencdc.Record{record, record})
+		is.NoErr(err)
+		is.Equal(written, 2)
+		is.Equal(w.Stats(), WriterStats{Published: 1, Failed: 1, DeadLettered: 1})
+	})
+
+	t.Run("dead-letter publish fails", func(t *testing.T) {
+		is := is.New(t)
+		ctx := context.Background()
+
+		publisher := &mockJetstreamPublisher{failedWrites: 2, err: nats.ErrNoStreamResponse}
+		w := &Writer{
+			subject:           "foo",
+			publisher:         publisher,
+			deadLetterSubject: "foo.dlq",
+		}
+
+		err := w.write(ctx, record)
+		is.True(errors.Is(err, ErrPublishRetriesExhausted))
+		is.True(strings.Contains(err.Error(), `publish to dead-letter subject "foo.dlq"`))
+		is.Equal(w.Stats(), WriterStats{Failed: 1})
+	})
+
+	t.Run("invalid dead-letter subject", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := NewWriter(writerParams{nc: &natsMock{}, subject: "foo", deadLetterSubject: "foo.>"})
+		is.True(errors.Is(err, internal.ErrInvalidSubject))
+	})
+}
+
+func TestWriter_write_canceled(t *testing.T) {
+	is := is.New(t)
+
+	w := &Writer{
+		subject:        "foo",
+		publisher:      &stalledPublisher{},
+		publishTimeout: time.Minute,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := w.write(ctx, opencdc.Record{Payload: opencdc.Change{After: opencdc.RawData("foo")}})
+	is.True(errors.Is(err, context.Canceled))
+	is.True(time.Since(start) < time.Second)
+	is.Equal(w.Stats(), WriterStats{Failed: 1})
+}
+
+func TestWriter_Close_timeout(t *testing.T) {
+	is := is.New(t)
+
+	w := &Writer{
+		async:        true,
+		publisher:    &stalledPublisher{},
+		closeTimeout: 50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	err := w.Close(context.Background())
+	is.True(errors.Is(err, context.DeadlineExceeded))
+	is.True(time.Since(start) < time.Second)
+}
+
+// stalledPublisher is a jetstreamPublisher whose synchronous publishes block
+// until the context passed in the publish options is done, and whose asynchronous
+// publishes are never acknowledged.
+type stalledPublisher struct {
+	mockJetstreamPublisher
+}
+
+func (p *stalledPublisher) PublishAsyncComplete() <-chan struct{} {
+	return make(chan struct{})
+}
+
+func (p *stalledPublisher) PublishMsg(_ *nats.Msg, opts ...nats.PubOpt) (*nats.PubAck, error) {
+	for _, opt := range opts {
+		if ctxOpt, ok := opt.(nats.ContextOpt); ok {
+			<-ctxOpt.Done()
+
+			return nil, ctxOpt.Err()
+		}
+	}
+
+	return nil, errors.New("publish without a context would block forever")
+}
+
+func TestWriter_writeKV(t *testing.T) {
+	records := []opencdc.Record{
+		{
+			Operation: opencdc.OperationCreate,
+			Key:       opencdc.RawData("a"),
+			Payload:   opencdc.Change{After: opencdc.RawData("1")},
+		},
+		{
+			Operation: opencdc.OperationUpdate,
+			Key:       opencdc.RawData("a"),
+			Payload:   opencdc.Change{After: opencdc.RawData("2")},
+		},
+		{Operation: opencdc.OperationDelete, Key: opencdc.RawData("a")},
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		is := is.New(t)
+
+		kv := &mockKeyValue{}
+		w := &Writer{kv: kv}
+
+		written, err := w.writeKV(context.Background(), records)
+		is.NoErr(err)
+		is.Equal(written, 3)
+		is.Equal(kv.ops, []string{"put a 1", "put a 2", "delete a"})
+		is.Equal(w.Stats(), WriterStats{Published: 3})
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		is := is.New(t)
+
+		kv := &mockKeyValue{}
+		w := &Writer{kv: kv, kvPurgeDeletes: true}
+
+		written, err := w.writeKV(context.Background(), records)
+		is.NoErr(err)
+		is.Equal(written, 3)
+		is.Equal(kv.ops, []string{"put a 1", "put a 2", "purge a"})
+	})
+
+	t.Run("empty key", func(t *testing.T) {
+		is := is.New(t)
+
+		kv := &mockKeyValue{}
+		w := &Writer{kv: kv}
+
+		written, err := w.writeKV(context.Background(), []opencdc.Record{
+			records[0],
+			{
+				Operation: opencdc.OperationCreate,
+				Key:       opencdc.RawData(""),
+				Payload:   opencdc.Change{After: opencdc.RawData("1")},
+			},
+		})
+		is.True(errors.Is(err, ErrEmptyKVKey))
+		is.Equal(written, 1)
+		is.Equal(kv.ops, []string{"put a 1"})
+		is.Equal(w.Stats(), WriterStats{Published: 1, Failed: 1})
+	})
+}
+
+func TestWriter_writeObjectStore(t *testing.T) {
+	is := is.New(t)
+
+	store := &mockObjectStore{deleteErr: nats.ErrObjectNotFound}
+	w := &Writer{objectStore: store}
+
+	written, err := w.writeObjectStore(context.Background(), []opencdc.Record{
+		{
+			Operation: opencdc.OperationCreate,
+			Key:       opencdc.RawData("a.bin"),
+			Payload:   opencdc.Change{After: opencdc.RawData("1")},
+		},
+		{
+			Operation: opencdc.OperationUpdate,
+			Key:       opencdc.RawData("a.bin"),
+			Payload:   opencdc.Change{After: opencdc.RawData("2")},
+		},
+		// deleting a missing object succeeds
+		{Operation: opencdc.OperationDelete, Key: opencdc.RawData("b.bin")},
+		{Operation: opencdc.OperationCreate, Payload: opencdc.Change{After: opencdc.RawData("3")}},
+	})
+	is.True(errors.Is(err, ErrEmptyObjectName))
+	is.Equal(written, 3)
+	is.Equal(store.ops, []string{"put a.bin 1", "put a.bin 2", "delete b.bin"})
+	is.Equal(w.Stats(), WriterStats{Published: 3, Failed: 1})
+}
+
+func TestObjectStore(t *testing.T) {
+	is := is.New(t)
+
+	js := &mockStoreJetStream{objectStoreErr: nats.ErrStreamNotFound}
+
+	_, err := objectStore(js, "bucket", false, nats.FileStorage)
+	is.True(errors.Is(err, nats.ErrStreamNotFound))
+	is.Equal(js.createdObjectStore, nil)
+
+	store, err := objectStore(js, "bucket", true, nats.MemoryStorage)
+	is.NoErr(err)
+	is.True(store != nil)
+	is.Equal(js.createdObjectStore, &nats.ObjectStoreConfig{Bucket: "bucket", Storage: nats.MemoryStorage})
+}
+
+// mockObjectStore records the operations in the form of "<operation> <name> [<contents>]".
+type mockObjectStore struct {
+	nats.ObjectStore
+
+	ops       []string
+	deleteErr error
+}
+
+func (m *mockObjectStore) Put(meta *nats.ObjectMeta, reader io.Reader, _ ...nats.ObjectOpt) (*nats.ObjectInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	m.ops = append(m.ops, "put "+meta.Name+" "+string(data))
+
+	return &nats.ObjectInfo{ObjectMeta: *meta}, nil
+}
+
+func (m *mockObjectStore) Delete(name string) error {
+	m.ops = append(m.ops, "delete "+name)
+
+	return m.deleteErr
+}
+
+func TestKeyValue(t *testing.T) {
+	t.Run("bucket exists", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockStoreJetStream{kv: &mockKeyValue{}}
+
+		kv, err := keyValue(js, "bucket", true, nats.FileStorage)
+		is.NoErr(err)
+		is.Equal(kv, js.kv)
+		is.Equal(js.created, nil)
+	})
+
+	t.Run("bucket doesn't exist", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockStoreJetStream{kvErr: nats.ErrBucketNotFound}
+
+		_, err := keyValue(js, "bucket", false, nats.FileStorage)
+		is.True(errors.Is(err, nats.ErrBucketNotFound))
+		is.Equal(js.created, nil)
+
+		kv, err := keyValue(js, "bucket", true, nats.FileStorage)
+		is.NoErr(err)
+		is.True(kv != nil)
+		is.Equal(js.created, &nats.KeyValueConfig{Bucket: "bucket"})
+	})
+
+	t.Run("memory storage", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockStoreJetStream{kvErr: nats.ErrBucketNotFound}
+
+		_, err := keyValue(js, "bucket", true, nats.MemoryStorage)
+		is.NoErr(err)
+		is.Equal(js.created, &nats.KeyValueConfig{Bucket: "bucket", Storage: nats.MemoryStorage})
+	})
+}
+
+// mockStoreJetStream implements the KV and object store methods of the JetStream context
+// used by tests, calling any other method panics.
+type mockStoreJetStream struct {
+	nats.JetStreamContext
+
+	kv      nats.KeyValue
+	kvErr   error
+	created *nats.KeyValueConfig
+
+	objectStoreErr     error
+	createdObjectStore *nats.ObjectStoreConfig
+}
+
+func (m *mockStoreJetStream) ObjectStore(string) (nats.ObjectStore, error) {
+	return nil, m.objectStoreErr
+}
+
+func (m *mockStoreJetStream) CreateObjectStore(cfg *nats.ObjectStoreConfig) (nats.ObjectStore, error) {
+	m.createdObjectStore = cfg
+
+	return &mockObjectStore{}, nil
+}
+
+func (m *mockStoreJetStream) KeyValue(string) (nats.KeyValue, error) {
+	return m.kv, m.kvErr
+}
+
+func (m *mockStoreJetStream) CreateKeyValue(cfg *nats.KeyValueConfig) (nats.KeyValue, error) {
+	m.created = cfg
+
+	return &mockKeyValue{}, nil
+}
+
+// mockKeyValue records the operations in the form of "<operation> <key> [<value>]".
+type mockKeyValue struct {
+	nats.KeyValue
+
+	ops []string
+}
+
+func (m *mockKeyValue) Put(key string, value []byte) (uint64, error) {
+	m.ops = append(m.ops, "put "+key+" "+string(value))
+
+	return uint64(len(m.ops)), nil
+}
+
+func (m *mockKeyValue) Delete(key string, _ ...nats.DeleteOpt) error {
+	m.ops = append(m.ops, "delete "+key)
+
+	return nil
+}
+
+func (m *mockKeyValue) Purge(key string, _ ...nats.DeleteOpt) error {
+	m.ops = append(m.ops, "purge "+key)
+
+	return nil
+}
+
+func TestWriter_writeAsync(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	w := &Writer{
+		publisher:       &mockJetstreamPublisher{},
+		async:           true,
+		maxPendingAsync: 1,
+	}
+
+	records := []opencdc.Record{
+		{Payload: opencdc.Change{After: opencdc.RawData("foo")}},
+		{Payload: opencdc.Change{After: opencdc.RawData("bar")}},
+	}
+
+	written, err := w.writeAsync(ctx, records)
+	is.NoErr(err)
+	is.Equal(written, 2)
+
+	// a failed publish is reported by the subsequent write
+	w.asyncErrHandler(nil, &nats.Msg{Subject: "foo"}, errors.New("an error"))
+
+	written, err = w.writeAsync(ctx, records)
+	is.True(err != nil)
+	is.Equal(written, 0)
+
+	// and only once
+	written, err = w.writeAsync(ctx, records)
+	is.NoErr(err)
+	is.Equal(written, 2)
+}
+
+func TestWriter_writeAsync_stalled(t *testing.T) {
+	t.Run("pending acknowledgements", func(t *testing.T) {
+		is := is.New(t)
+
+		w := &Writer{
+			publisher:             &stalledAsyncPublisher{},
+			async:                 true,
+			maxPendingAsync:       1,
+			publishAsyncStallWait: 10 * time.Millisecond,
+		}
+
+		written, err := w.writeAsync(context.Background(), []opencdc.Record{
+			{Payload: opencdc.Change{After: opencdc.RawData("foo")}},
+		})
+		is.True(errors.Is(err, ErrPublishAsyncStalled))
+		is.Equal(written, 0)
+	})
+
+	t.Run("stalled client", func(t *testing.T) {
+		is := is.New(t)
+
+		w := &Writer{
+			publisher:       &stalledClientPublisher{},
+			async:           true,
+			maxPendingAsync: 10,
+		}
+
+		written, err := w.writeAsync(context.Background(), []opencdc.Record{
+			{Payload: opencdc.Change{After: opencdc.RawData("foo")}},
+		})
+		is.True(errors.Is(err, ErrPublishAsyncStalled))
+		is.True(errors.Is(err, nats.ErrTooManyStalledMsgs))
+		is.Equal(written, 0)
+	})
+}
+
+// stalledAsyncPublisher is a publisher with a pending acknowledgement which is never received.
+type stalledAsyncPublisher struct {
+	pendingPublisher
+}
+
+func (p *stalledAsyncPublisher) PublishAsyncPending() int {
+	return 1
+}
+
+// stalledClientPublisher is a publisher whose asynchronous publishes fail like the ones
+// of a NATS client which stalled with too many pending acknowledgements.
+type stalledClientPublisher struct {
+	mockJetstreamPublisher
+}
+
+func (p *stalledClientPublisher) PublishMsgAsync(*nats.Msg, ...nats.PubOpt) (nats.PubAckFuture, error) {
+	return nil, nats.ErrTooManyStalledMsgs
+}
+
+func TestWriterParams_jetStreamOptions(t *testing.T) {
+	is := is.New(t)
+
+	// the error handler is always set
+	is.Equal(len(writerParams{}.jetStreamOptions(nil)), 1)
+	is.Equal(len(writerParams{maxPendingAsync: 10}.jetStreamOptions(nil)), 2)
+	is.Equal(len(writerParams{maxPendingAsync: 10, publishAsyncMaxPending: 20}.jetStreamOptions(nil)), 2)
+}
+
+func TestWriter_Flush(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	w := &Writer{
+		publisher: &mockJetstreamPublisher{},
+		async:     true,
+	}
+
+	is.NoErr(w.Flush(ctx))
+
+	// failed publishes are reported once
+	w.asyncErrHandler(nil, &nats.Msg{Subject: "foo"}, errors.New("an error"))
+	is.True(w.Flush(ctx) != nil)
+	is.NoErr(w.Flush(ctx))
+
+	// the ctx limits waiting for pending acknowledgements
+	w.publisher = &pendingPublisher{}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	err := w.Flush(ctx)
+	is.True(errors.Is(err, context.DeadlineExceeded))
+}
+
+// pendingPublisher is a publisher whose asynchronously published messages are never acknowledged.
+type pendingPublisher struct {
+	mockJetstreamPublisher
+}
+
+func (p *pendingPublisher) PublishAsyncComplete() <-chan struct{} {
+	return make(chan struct{})
+}
+
+func TestWriter_Close(t *testing.T) {
+	is := is.New(t)
+
+	w := &Writer{
+		publisher: &mockJetstreamPublisher{},
+		async:     true,
+	}
+
+	is.NoErr(w.Close(context.Background()))
+
+	w.asyncErrHandler(nil, &nats.Msg{Subject: "foo"}, errors.New("an error"))
+	is.True(w.Close(context.Background()) != nil)
+}
+
+func TestWriter_msgID(t *testing.T) {
+	record := opencdc.Record{
+		Key:      opencdc.RawData("record-key"),
+		Metadata: opencdc.Metadata{"id": "metadata-id"},
+		Payload:  opencdc.Change{After: opencdc.RawData("hello")},
+	}
+
+	tests := []struct {
+		name       string
+		msgIDField string
+		record     opencdc.Record
+		want       string
+	}{
+		{
+			name:       "not configured",
+			msgIDField: "",
+			record:     record,
+			want:       "",
+		},
+		{
+			name:       "key",
+			msgIDField: msgIDFieldKey,
+			record:     record,
+			want:       "record-key",
+		},
+		{
+			name:       "missing key",
+			msgIDField: msgIDFieldKey,
+			record:     opencdc.Record{},
+			want:       "",
+		},
+		{
+			name:       "payload",
+			msgIDField: msgIDFieldPayload,
+			record:     record,
+			want:       "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		},
+		{
+			name:       "metadata",
+			msgIDField: "metadata.id",
+			record:     record,
+			want:       "metadata-id",
+		},
+		{
+			name:       "missing metadata",
+			msgIDField: "metadata.missing",
+			record:     record,
+			want:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			w := &Writer{msgIDField: tt.msgIDField}
+			is.Equal(w.msgID(tt.record), tt.want)
+
+			msg, err := w.newMessage(context.Background(), tt.record)
+			is.NoErr(err)
+			is.Equal(msg.Header.Get(nats.MsgIdHdr), tt.want)
+		})
+	}
+}
+
+func TestWriter_write_wrongLastSequence(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	apiErr := &nats.APIError{
+		Code:        400,
+		ErrorCode:   nats.JSErrCodeStreamWrongLastSequence,
+		Description: "wrong last sequence: 41",
+	}
+	record := opencdc.Record{Payload: opencdc.Change{After: opencdc.RawData("foo")}}
+
+	w := &Writer{
+		subject:   "foo",
+		publisher: &mockJetstreamPublisher{failedWrites: 1, err: apiErr},
+	}
+
+	err := w.write(ctx, record)
+	is.True(errors.Is(err, ErrWrongLastSequence))
+	is.True(errors.Is(err, apiErr))
+
+	w.publisher = &mockJetstreamPublisher{failedWrites: 2, err: apiErr}
+
+	written, err := w.writeBatch(ctx, []opencdc.Record{record, record})
+	is.Equal(written, 0)
+	is.True(errors.Is(err, ErrWrongLastSequence))
+
+	// other errors aren't reported as a sequence mismatch
+	w.publisher = &mockJetstreamPublisher{failedWrites: 1, err: nats.ErrConnectionClosed}
+
+	err = w.write(ctx, record)
+	is.True(!errors.Is(err, ErrWrongLastSequence))
+}
+
+func TestWriter_asyncErrHandler_batch(t *testing.T) {
+	is := is.New(t)
+
+	w := &Writer{publisher: &mockJetstreamPublisher{}}
+
+	// errors of batches are already returned by writeBatch
+	w.asyncErrHandler(nil, &nats.Msg{Subject: "foo"}, errors.New("an error"))
+	is.NoErr(w.Close(context.Background()))
+}
+
+func TestWriter_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		writer      *Writer
+		connected   bool
+		js          *mockValidateJetStream
+		testPublish bool
+		wantErr     string
+		published   int
+	}{
+		{
+			name:      "not connected",
+			writer:    &Writer{subject: "foo"},
+			js:        &mockValidateJetStream{stream: "bar"},
+			connected: false,
+			wantErr:   "validate: not connected to the NATS server",
+		},
+		{
+			name:      "stream captures the subject",
+			writer:    &Writer{subject: "foo"},
+			js:        &mockValidateJetStream{stream: "bar"},
+			connected: true,
+		},
+		{
+			name:      "no stream captures the subject",
+			writer:    &Writer{subject: "foo"},
+			js:        &mockValidateJetStream{streamErr: nats.ErrNoMatchingStream},
+			connected: true,
+			wantErr:   `validate: no stream captures the subject "foo": nats: no stream matches subject`,
+		},
+		{
+			name:      "different stream captures the subject",
+			writer:    &Writer{subject: "foo", stream: "baz"},
+			js:        &mockValidateJetStream{stream: "bar"},
+			connected: true,
+			wantErr:   `validate: subject "foo" is captured by stream "bar" instead of "baz"`,
+		},
+		{
+			name:        "test publish",
+			writer:      &Writer{subject: "foo"},
+			js:          &mockValidateJetStream{stream: "bar"},
+			connected:   true,
+			testPublish: true,
+			published:   1,
+		},
+		{
+			name:      "subject template without a stream",
+			writer:    &Writer{subjectTemplate: template.Must(template.New("subject").Parse("foo"))},
+			js:        &mockValidateJetStream{streamErr: nats.ErrNoMatchingStream},
+			connected: true,
+		},
+		{
+			name: "subject template with a missing stream",
+			writer: &Writer{
+				subjectTemplate: template.Must(template.New("subject").Parse("foo")),
+				stream:          "baz",
+			},
+			js:        &mockValidateJetStream{streamInfoErr: nats.ErrStreamNotFound},
+			connected: true,
+			wantErr:   `validate: get stream "baz": nats: stream not found`,
+		},
+		{
+			name:        "partitions",
+			writer:      &Writer{subject: "foo", partitions: 2},
+			js:          &mockValidateJetStream{stream: "bar"},
+			connected:   true,
+			testPublish: true,
+			published:   1,
+		},
+		{
+			name:      "pubsub",
+			writer:    &Writer{subject: "foo", pubsub: true},
+			connected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			publisher := &mockJetstreamPublisher{}
+			tt.writer.publisher = publisher
+
+			nc := &natsMock{connected: tt.connected}
+			if tt.js != nil {
+				nc.js = tt.js
+			}
+			tt.writer.nc = nc
+
+			err := tt.writer.Validate(context.Background(), tt.testPublish)
+			if tt.wantErr == "" {
+				is.NoErr(err)
+			} else {
+				is.True(err != nil)
+				is.Equal(err.Error(), tt.wantErr)
+			}
+
+			is.Equal(len(publisher.published), tt.published)
+			if tt.published > 0 {
+				is.Equal(publisher.published[0].Subject, tt.writer.subjects()[0])
+				is.Equal(publisher.published[0].Header.Get("Conduit-Validate"), "true")
+			}
+		})
+	}
+}
+
+// mockValidateJetStream implements the stream lookups of the JetStream context used by Validate.
+type mockValidateJetStream struct {
+	nats.JetStreamContext
+
+	stream        string
+	streamErr     error
+	streamInfoErr error
+}
+
+func (m *mockValidateJetStream) StreamNameBySubject(string, ...nats.JSOpt) (string, error) {
+	return m.stream, m.streamErr
+}
+
+func (m *mockValidateJetStream) StreamInfo(stream string, _ ...nats.JSOpt) (*nats.StreamInfo, error) {
+	if m.streamInfoErr != nil {
+		return nil, m.streamInfoErr
+	}
+
+	return &nats.StreamInfo{Config: nats.StreamConfig{Name: stream}}, nil
+}
+
+func TestWriter_Connected(t *testing.T) {
+	is := is.New(t)
+
+	nc := &natsMock{}
+	w := &Writer{nc: nc}
+	is.True(!w.Connected())
+
+	nc.connected = true
+	is.True(w.Connected())
+}
+
+func TestWriter_Stats(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	w := &Writer{
+		publisher: &mockJetstreamPublisher{
+			failedWrites: 1,
+			err:          errors.New("an error"),
+		},
+	}
+
+	record := opencdc.Record{Payload: opencdc.Change{After: opencdc.RawData("foo")}}
+
+	is.True(w.write(ctx, record) != nil)
+	is.NoErr(w.write(ctx, record))
+
+	written, err := w.writeBatch(ctx, []opencdc.Record{record, record})
+	is.NoErr(err)
+	is.Equal(written, 2)
+
+	is.Equal(w.Stats(), WriterStats{Published: 3, Failed: 1})
+
+	// a failed async publish is moved from the published to the failed ones
+	w.async = true
+	w.maxPendingAsync = 10
+
+	written, err = w.writeAsync(ctx, []opencdc.Record{record})
+	is.NoErr(err)
+	is.Equal(written, 1)
+	w.asyncErrHandler(nil, &nats.Msg{Subject: "foo"}, errors.New("an error"))
+
+	is.Equal(w.Stats(), WriterStats{Published: 3, Failed: 2})
+}
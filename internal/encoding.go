@@ -0,0 +1,125 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+const (
+	// PayloadEncodingNone leaves payloads as they are.
+	PayloadEncodingNone = "none"
+	// PayloadEncodingBase64 encodes payloads using the standard base64 encoding.
+	PayloadEncodingBase64 = "base64"
+	// PayloadEncodingGzip compresses payloads using gzip.
+	PayloadEncodingGzip = "gzip"
+)
+
+// ContentEncodingGzip is the content encoding of payloads compressed using gzip.
+const ContentEncodingGzip = "gzip"
+
+// CompressPayload compresses the data using gzip if it's at least threshold bytes long.
+// The data is returned as it is if it's shorter, or if the compression doesn't make it smaller.
+// It reports whether the returned data is compressed.
+func CompressPayload(data []byte, threshold int) ([]byte, bool, error) {
+	if threshold <= 0 || len(data) < threshold {
+		return data, false, nil
+	}
+
+	compressed, err := EncodePayload(PayloadEncodingGzip, data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(compressed) >= len(data) {
+		return data, false, nil
+	}
+
+	return compressed, true, nil
+}
+
+// DecompressPayload decompresses the data with the content encoding.
+// The data is returned as it is if the content encoding is empty or unknown.
+// It reports whether the data was decompressed.
+func DecompressPayload(contentEncoding string, data []byte) ([]byte, bool, error) {
+	if contentEncoding != ContentEncodingGzip {
+		return data, false, nil
+	}
+
+	decompressed, err := DecodePayload(PayloadEncodingGzip, data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return decompressed, true, nil
+}
+
+// EncodePayload encodes the data using the encoding.
+func EncodePayload(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case PayloadEncodingNone, "":
+		return data, nil
+	case PayloadEncodingBase64:
+		return base64.StdEncoding.AppendEncode(nil, data), nil
+	case PayloadEncodingGzip:
+		var buf bytes.Buffer
+
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, fmt.Errorf("gzip payload: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("gzip payload: %w", err)
+		}
+
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("invalid payload encoding %q", encoding)
+	}
+}
+
+// DecodePayload decodes the data encoded using the encoding.
+func DecodePayload(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case PayloadEncodingNone, "":
+		return data, nil
+	case PayloadEncodingBase64:
+		decoded, err := base64.StdEncoding.AppendDecode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("base64 decode payload: %w", err)
+		}
+
+		return decoded, nil
+	case PayloadEncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gunzip payload: %w", err)
+		}
+		defer zr.Close()
+
+		decoded, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("gunzip payload: %w", err)
+		}
+
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("invalid payload encoding %q", encoding)
+	}
+}
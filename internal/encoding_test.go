@@ -0,0 +1,113 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestPayloadEncoding(t *testing.T) {
+	data := []byte(`{"id":1,"name":"foo"}`)
+
+	for _, encoding := range []string{PayloadEncodingNone, PayloadEncodingBase64, PayloadEncodingGzip} {
+		t.Run(encoding, func(t *testing.T) {
+			is := is.New(t)
+
+			encoded, err := EncodePayload(encoding, data)
+			is.NoErr(err)
+
+			decoded, err := DecodePayload(encoding, encoded)
+			is.NoErr(err)
+			is.Equal(decoded, data)
+		})
+	}
+
+	t.Run("base64 encoded", func(t *testing.T) {
+		is := is.New(t)
+
+		encoded, err := EncodePayload(PayloadEncodingBase64, []byte("hello"))
+		is.NoErr(err)
+		is.Equal(string(encoded), "aGVsbG8=")
+	})
+
+	t.Run("invalid base64", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := DecodePayload(PayloadEncodingBase64, []byte("not base64!"))
+		is.True(err != nil)
+	})
+
+	t.Run("invalid gzip", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := DecodePayload(PayloadEncodingGzip, data)
+		is.True(err != nil)
+	})
+}
+
+func TestCompressPayload(t *testing.T) {
+	large := bytes.Repeat([]byte(`{"id":1,"name":"foo"}`), 10)
+
+	t.Run("round trip", func(t *testing.T) {
+		is := is.New(t)
+
+		compressed, ok, err := CompressPayload(large, 100)
+		is.NoErr(err)
+		is.True(ok)
+		is.True(len(compressed) < len(large))
+
+		decompressed, ok, err := DecompressPayload(ContentEncodingGzip, compressed)
+		is.NoErr(err)
+		is.True(ok)
+		is.Equal(decompressed, large)
+	})
+
+	t.Run("below the threshold", func(t *testing.T) {
+		is := is.New(t)
+
+		data, ok, err := CompressPayload(large, len(large)+1)
+		is.NoErr(err)
+		is.True(!ok)
+		is.Equal(data, large)
+	})
+
+	t.Run("incompressible", func(t *testing.T) {
+		is := is.New(t)
+
+		data, ok, err := CompressPayload([]byte("abc"), 1)
+		is.NoErr(err)
+		is.True(!ok)
+		is.Equal(data, []byte("abc"))
+	})
+
+	t.Run("unknown content encoding", func(t *testing.T) {
+		is := is.New(t)
+
+		data, ok, err := DecompressPayload("br", []byte("abc"))
+		is.NoErr(err)
+		is.True(!ok)
+		is.Equal(data, []byte("abc"))
+	})
+
+	t.Run("invalid gzip", func(t *testing.T) {
+		is := is.New(t)
+
+		_, _, err := DecompressPayload(ContentEncodingGzip, large)
+		is.True(err != nil)
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+// MetadataHeaderPrefix is the prefix of record metadata keys holding NATS message headers.
+const MetadataHeaderPrefix = "nats.header."
+
+// MetadataNumDelivered is the record metadata key holding the number of times
+// a message has been delivered. A value greater than 1 means the message is redelivered.
+const MetadataNumDelivered = "nats.numDelivered"
+
+// MetadataStream is the record metadata key holding the name of the stream a message was read from.
+const MetadataStream = "nats.stream"
+
+const (
+	// MetadataPurgeFilter is the record metadata key holding the subject filter of a stream purge.
+	MetadataPurgeFilter = "nats.purge.filter"
+	// MetadataPurgeSeq is the record metadata key holding the stream sequence up to which a stream was purged.
+	MetadataPurgeSeq = "nats.purge.seq"
+	// MetadataPurgeKeep is the record metadata key holding the number of messages kept by a stream purge.
+	MetadataPurgeKeep = "nats.purge.keep"
+	// MetadataPurged is the record metadata key holding the number of messages removed by a stream purge.
+	MetadataPurged = "nats.purged"
+)
+
+// MetadataMsgSize is the record metadata key holding the size of the original message payload
+// of a message delivered by a headers only consumer.
+const MetadataMsgSize = "nats.msgSize"
+
+// MetadataPositionGap is the record metadata key holding the number of stream sequences
+// between the stored position and the first record read after it, whose messages were
+// removed from the stream before they could be read, e.g. because they expired.
+const MetadataPositionGap = "nats.positionGap"
+
+// SourcePositionHeader is the name of the NATS message header holding the base64 encoded
+// position of the record a message was published from.
+const SourcePositionHeader = "Conduit-Source-Position"
+
+// MetadataSourcePosition is the record metadata key holding the base64 encoded position
+// of the record a message was published from, as read from the SourcePositionHeader.
+const MetadataSourcePosition = "conduit.source.position"
+
+// BeforeHeader is the name of the NATS message header holding the base64 encoded payload
+// before the change of the update record a message was published from.
+const BeforeHeader = "Conduit-Before"
+
+const (
+	// ContentTypeHeader is the name of the NATS message header holding the media type of the payload.
+	ContentTypeHeader = "Content-Type"
+	// MetadataContentType is the record metadata key holding the media type of the payload,
+	// as read from or written to the ContentTypeHeader.
+	MetadataContentType = "nats.contentType"
+	// DefaultContentType is the media type of payloads without a ContentTypeHeader.
+	DefaultContentType = "application/octet-stream"
+	// ContentEncodingHeader is the name of the NATS message header holding the compression of the payload.
+	ContentEncodingHeader = "Content-Encoding"
+)
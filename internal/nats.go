@@ -14,11 +14,75 @@
 
 package internal
 
-import "github.com/nats-io/nats.go"
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// drainPollInterval is the interval of checking whether a draining connection is closed.
+const drainPollInterval = 10 * time.Millisecond
 
 type NATSClient interface {
 	JetStream(...nats.JSOpt) (nats.JetStreamContext, error)
+	PublishMsg(m *nats.Msg) error
+	Subscribe(subj string, cb nats.MsgHandler) (*nats.Subscription, error)
+	QueueSubscribe(subj, queue string, cb nats.MsgHandler) (*nats.Subscription, error)
+	FlushWithContext(ctx context.Context) error
 	IsConnected() bool
+	IsClosed() bool
+	MaxPayload() int64
 	Drain() error
 	Close()
 }
+
+// jetStreamClient is a NATSClient creating the JetStream contexts with additional options.
+type jetStreamClient struct {
+	NATSClient
+	opts []nats.JSOpt
+}
+
+// JetStream creates a JetStream context with the client's options followed by the opts.
+func (c jetStreamClient) JetStream(opts ...nats.JSOpt) (nats.JetStreamContext, error) {
+	return c.NATSClient.JetStream(append(slices.Clone(c.opts), opts...)...)
+}
+
+// WithJetStreamOptions returns a NATSClient whose JetStream contexts are created with the opts,
+// e.g. the ones returned by JetStreamOptions, so the JetStream callers don't have to pass them.
+func WithJetStreamOptions(nc NATSClient, opts ...nats.JSOpt) NATSClient {
+	if len(opts) == 0 {
+		return nc
+	}
+
+	return jetStreamClient{NATSClient: nc, opts: opts}
+}
+
+// DrainConn drains the connection, so that the subscriptions stop receiving new messages,
+// pending publishes and acknowledgements are flushed and the connection is closed.
+// It waits until the connection is closed, which happens at the latest after the drain timeout
+// of the connection. If the ctx is done before that, the connection is closed right away.
+func DrainConn(ctx context.Context, nc NATSClient) error {
+	if err := nc.Drain(); err != nil {
+		nc.Close()
+
+		return fmt.Errorf("drain connection: %w", err)
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for !nc.IsClosed() {
+		select {
+		case <-ctx.Done():
+			nc.Close()
+
+			return fmt.Errorf("wait for connection to drain: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
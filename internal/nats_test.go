@@ -0,0 +1,125 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+)
+
+func TestDrainConn(t *testing.T) {
+	t.Run("waits until the connection is drained", func(t *testing.T) {
+		is := is.New(t)
+
+		nc := &drainMock{drainFor: 50 * time.Millisecond}
+
+		is.NoErr(DrainConn(context.Background(), nc))
+		is.True(nc.IsClosed())
+		is.True(!nc.closeCalled.Load())
+	})
+
+	t.Run("closes the connection when the context is done", func(t *testing.T) {
+		is := is.New(t)
+
+		nc := &drainMock{drainFor: time.Hour}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := DrainConn(ctx, nc)
+		is.True(errors.Is(err, context.DeadlineExceeded))
+		is.True(nc.closeCalled.Load())
+	})
+
+	t.Run("closes the connection when draining fails", func(t *testing.T) {
+		is := is.New(t)
+
+		nc := &drainMock{drainErr: errors.New("connection closed")}
+
+		err := DrainConn(context.Background(), nc)
+		is.True(err != nil)
+		is.True(nc.closeCalled.Load())
+	})
+}
+
+func TestWithJetStreamOptions(t *testing.T) {
+	is := is.New(t)
+
+	nc := &jetStreamMock{}
+
+	// without options the client is returned as it is
+	is.Equal(WithJetStreamOptions(nc), NATSClient(nc))
+
+	client := WithJetStreamOptions(nc, nats.Domain("hub"))
+
+	_, err := client.JetStream(nats.PublishAsyncMaxPending(10))
+	is.NoErr(err)
+	is.Equal(len(nc.opts), 2)
+
+	// the options aren't accumulated across the calls
+	_, err = client.JetStream()
+	is.NoErr(err)
+	is.Equal(len(nc.opts), 1)
+}
+
+// jetStreamMock is a NATSClient which records the options of the last JetStream call.
+type jetStreamMock struct {
+	NATSClient
+
+	opts []nats.JSOpt
+}
+
+func (m *jetStreamMock) JetStream(opts ...nats.JSOpt) (nats.JetStreamContext, error) {
+	m.opts = opts
+
+	return nil, nil
+}
+
+// drainMock is a NATSClient which closes the connection drainFor after Drain is called.
+type drainMock struct {
+	NATSClient
+
+	drainFor    time.Duration
+	drainErr    error
+	drainedAt   atomic.Pointer[time.Time]
+	closeCalled atomic.Bool
+}
+
+func (m *drainMock) Drain() error {
+	if m.drainErr != nil {
+		return m.drainErr
+	}
+
+	drainedAt := time.Now().Add(m.drainFor)
+	m.drainedAt.Store(&drainedAt)
+
+	return nil
+}
+
+func (m *drainMock) IsClosed() bool {
+	drainedAt := m.drainedAt.Load()
+
+	return m.closeCalled.Load() || (drainedAt != nil && time.Now().After(*drainedAt))
+}
+
+func (m *drainMock) Close() {
+	m.closeCalled.Store(true)
+}
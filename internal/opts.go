@@ -15,10 +15,25 @@
 package internal
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"strings"
 
 	"github.com/conduitio-labs/conduit-connector-nats-jetstream/config"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+var (
+	// ErrCredentialsFileNotFound is returned when the configured credentials file doesn't exist.
+	ErrCredentialsFileNotFound = errors.New("credentials file not found")
+	// ErrInvalidCredentials is returned when the configured credentials file
+	// doesn't contain a user JWT and a user NKey seed.
+	ErrInvalidCredentials = errors.New("invalid credentials")
 )
 
 // GetConnectionOptions returns connection options based on the provided config.
@@ -29,6 +44,18 @@ func GetConnectionOptions(config config.Config) ([]nats.Option, error) {
 		opts = append(opts, nats.Name(config.ConnectionName))
 	}
 
+	if config.DontRandomize {
+		opts = append(opts, nats.DontRandomize())
+	}
+
+	if config.Token != "" {
+		opts = append(opts, nats.Token(config.Token))
+	}
+
+	if config.Username != "" && config.Password != "" {
+		opts = append(opts, nats.UserInfo(config.Username, config.Password))
+	}
+
 	if config.NKeyPath != "" {
 		opt, err := nats.NkeyOptionFromSeed(config.NKeyPath)
 		if err != nil {
@@ -38,10 +65,33 @@ func GetConnectionOptions(config config.Config) ([]nats.Option, error) {
 		opts = append(opts, opt)
 	}
 
+	if config.NKeySeed != "" {
+		opt, err := nkeyOptionFromSeed(config.NKeySeed)
+		if err != nil {
+			return nil, fmt.Errorf("load NKey seed: %w", err)
+		}
+
+		opts = append(opts, opt)
+	}
+
 	if config.CredentialsFilePath != "" {
+		if err := validateCredentialsFile(config.CredentialsFilePath); err != nil {
+			return nil, err
+		}
+
 		opts = append(opts, nats.UserCredentials(config.CredentialsFilePath))
 	}
 
+	if config.TLSRootCACertPath != "" || config.TLSServerName != "" || config.TLSInsecureSkipVerify {
+		tlsConfig, err := getTLSConfig(config.ConfigTLS)
+		if err != nil {
+			return nil, fmt.Errorf("get TLS config: %w", err)
+		}
+
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+
+	// the client certificate is added to the TLS config set by nats.Secure, so it must follow it
 	if config.TLSClientCertPath != "" && config.TLSClientPrivateKeyPath != "" {
 		opts = append(opts, nats.ClientCert(
 			config.TLSClientCertPath,
@@ -49,12 +99,160 @@ func GetConnectionOptions(config config.Config) ([]nats.Option, error) {
 		))
 	}
 
-	if config.TLSRootCACertPath != "" {
-		opts = append(opts, nats.RootCAs(config.TLSRootCACertPath))
-	}
-
 	opts = append(opts, nats.MaxReconnects(config.MaxReconnects))
 	opts = append(opts, nats.ReconnectWait(config.ReconnectWait))
 
+	if config.ReconnectBufSize != 0 {
+		opts = append(opts, nats.ReconnectBufSize(config.ReconnectBufSize))
+	}
+
+	if config.DrainTimeout != 0 {
+		opts = append(opts, nats.DrainTimeout(config.DrainTimeout))
+	}
+
+	if config.ConnectionTimeout != 0 {
+		opts = append(opts, nats.Timeout(config.ConnectionTimeout))
+	}
+
+	if config.PingInterval != 0 {
+		opts = append(opts, nats.PingInterval(config.PingInterval))
+	}
+
+	if config.MaxPingsOutstanding != 0 {
+		opts = append(opts, nats.MaxPingsOutstanding(config.MaxPingsOutstanding))
+	}
+
+	if config.InboxPrefix != "" {
+		opts = append(opts, nats.CustomInboxPrefix(config.InboxPrefix))
+	}
+
 	return opts, nil
 }
+
+// DefaultJetStreamAPIPrefix is the prefix of the API subjects of the JetStream of the account.
+const DefaultJetStreamAPIPrefix = "$JS.API."
+
+// JetStreamAPIPrefix returns the prefix of the JetStream API subjects, ending with a dot,
+// which the NATS client derives from the JetStreamDomain or the JetStreamAPIPrefix.
+func JetStreamAPIPrefix(config config.Config) string {
+	switch {
+	case config.JetStreamDomain != "":
+		return "$JS." + config.JetStreamDomain + ".API."
+	case config.JetStreamAPIPrefix != "":
+		return strings.TrimSuffix(config.JetStreamAPIPrefix, ".") + "."
+	default:
+		return DefaultJetStreamAPIPrefix
+	}
+}
+
+// JetStreamOptions returns the options of the JetStream contexts based on the config,
+// which select the JetStream domain or API prefix.
+func JetStreamOptions(config config.Config) []nats.JSOpt {
+	switch {
+	case config.JetStreamDomain != "":
+		return []nats.JSOpt{nats.Domain(config.JetStreamDomain)}
+	case config.JetStreamAPIPrefix != "":
+		return []nats.JSOpt{nats.APIPrefix(config.JetStreamAPIPrefix)}
+	default:
+		return nil
+	}
+}
+
+// nkeyOptionFromSeed returns an NKey option based on the provided inline seed.
+// It makes sure the seed is a valid user seed before connecting.
+// Like nats.NkeyOptionFromSeed does for seed files, the seed is decoded only when
+// it's needed, and the decoded key pair is wiped right after that.
+func nkeyOptionFromSeed(seed string) (nats.Option, error) {
+	kp, err := nkeyPairFromSeed(seed)
+	if err != nil {
+		return nil, err
+	}
+	defer kp.Wipe()
+
+	publicKey, err := kp.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("get public key: %w", err)
+	}
+
+	if !nkeys.IsValidPublicUserKey(publicKey) {
+		return nil, errors.New("not a valid NKey user seed")
+	}
+
+	sigCB := func(nonce []byte) ([]byte, error) {
+		kp, err := nkeyPairFromSeed(seed)
+		if err != nil {
+			return nil, err
+		}
+		defer kp.Wipe()
+
+		return kp.Sign(nonce)
+	}
+
+	return nats.Nkey(publicKey, sigCB), nil
+}
+
+// nkeyPairFromSeed decodes the seed into a key pair.
+func nkeyPairFromSeed(seed string) (nkeys.KeyPair, error) {
+	kp, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return nil, fmt.Errorf("parse seed: %w", err)
+	}
+
+	return kp, nil
+}
+
+// validateCredentialsFile makes sure the credentials file exists, is readable
+// and contains a user JWT and a valid user NKey seed.
+func validateCredentialsFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %q", ErrCredentialsFileNotFound, path)
+		}
+
+		return fmt.Errorf("read credentials file: %w", err)
+	}
+	defer func() {
+		for i := range contents {
+			contents[i] = 'x'
+		}
+	}()
+
+	userJWT, err := nkeys.ParseDecoratedJWT(contents)
+	if err != nil || strings.TrimSpace(userJWT) == "" {
+		return fmt.Errorf("%w: %q doesn't contain a user JWT", ErrInvalidCredentials, path)
+	}
+
+	kp, err := nkeys.ParseDecoratedUserNKey(contents)
+	if err != nil {
+		return fmt.Errorf("%w: %q: parse user NKey seed: %w", ErrInvalidCredentials, path, err)
+	}
+	kp.Wipe()
+
+	return nil
+}
+
+// getTLSConfig returns a TLS config based on the provided config.
+// It makes sure the root CA certificate exists and is a valid PEM.
+func getTLSConfig(config config.ConfigTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.TLSServerName,
+		InsecureSkipVerify: config.TLSInsecureSkipVerify, //nolint:gosec // explicitly enabled by the user
+	}
+
+	if config.TLSRootCACertPath != "" {
+		rootCAs, err := os.ReadFile(config.TLSRootCACertPath)
+		if err != nil {
+			return nil, fmt.Errorf("read root CA certificate: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(rootCAs) {
+			return nil, fmt.Errorf("parse root CA certificate %q: no valid PEM certificates found",
+				config.TLSRootCACertPath)
+		}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,492 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/config"
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+func TestGetTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	validCAPath := filepath.Join(dir, "ca.pem")
+	writeTestCACert(t, validCAPath)
+
+	invalidCAPath := filepath.Join(dir, "invalid.pem")
+	if err := os.WriteFile(invalidCAPath, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write invalid CA: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.ConfigTLS
+		wantErr bool
+	}{
+		{
+			name: "success, valid root CA",
+			cfg: config.ConfigTLS{
+				TLSRootCACertPath: validCAPath,
+				TLSServerName:     "nats.example.com",
+			},
+		},
+		{
+			name: "success, insecure skip verify without root CA",
+			cfg: config.ConfigTLS{
+				TLSInsecureSkipVerify: true,
+			},
+		},
+		{
+			name: "fail, missing root CA",
+			cfg: config.ConfigTLS{
+				TLSRootCACertPath: filepath.Join(dir, "missing.pem"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail, invalid root CA",
+			cfg: config.ConfigTLS{
+				TLSRootCACertPath: invalidCAPath,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			tlsConfig, err := getTLSConfig(tt.cfg)
+			if tt.wantErr {
+				is.True(err != nil)
+
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(tlsConfig.ServerName, tt.cfg.TLSServerName)
+			is.Equal(tlsConfig.InsecureSkipVerify, tt.cfg.TLSInsecureSkipVerify)
+			is.Equal(tlsConfig.RootCAs != nil, tt.cfg.TLSRootCACertPath != "")
+		})
+	}
+}
+
+func TestGetConnectionOptions_NKey(t *testing.T) {
+	dir := t.TempDir()
+
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	seed, err := user.Seed()
+	if err != nil {
+		t.Fatalf("get seed: %v", err)
+	}
+
+	seedPath := filepath.Join(dir, "user.nk")
+	if err := os.WriteFile(seedPath, seed, 0o600); err != nil {
+		t.Fatalf("write seed: %v", err)
+	}
+
+	account, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	accountSeed, err := account.Seed()
+	if err != nil {
+		t.Fatalf("get account seed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantErr bool
+	}{
+		{
+			name: "success, seed file",
+			cfg: config.Config{
+				NKeyPath: seedPath,
+			},
+		},
+		{
+			name: "success, inline seed",
+			cfg: config.Config{
+				NKeySeed: string(seed),
+			},
+		},
+		{
+			name: "fail, missing seed file",
+			cfg: config.Config{
+				NKeyPath: filepath.Join(dir, "missing.nk"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail, invalid inline seed",
+			cfg: config.Config{
+				NKeySeed: "not a seed",
+			},
+			wantErr: true,
+		},
+		{
+			name: "fail, inline account seed",
+			cfg: config.Config{
+				NKeySeed: string(accountSeed),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			_, err := GetConnectionOptions(tt.cfg)
+			if tt.wantErr {
+				is.True(err != nil)
+
+				return
+			}
+
+			is.NoErr(err)
+		})
+	}
+}
+
+func TestNkeyOptionFromSeed_sign(t *testing.T) {
+	is := is.New(t)
+
+	user, err := nkeys.CreateUser()
+	is.NoErr(err)
+	seed, err := user.Seed()
+	is.NoErr(err)
+	publicKey, err := user.PublicKey()
+	is.NoErr(err)
+
+	opt, err := nkeyOptionFromSeed(string(seed))
+	is.NoErr(err)
+
+	var opts nats.Options
+	is.NoErr(opt(&opts))
+	is.Equal(opts.Nkey, publicKey)
+
+	nonce := []byte("nonce")
+	sig, err := opts.SignatureCB(nonce)
+	is.NoErr(err)
+	is.NoErr(user.Verify(nonce, sig))
+}
+
+func TestGetConnectionOptions_reconnect(t *testing.T) {
+	is := is.New(t)
+
+	opts, err := GetConnectionOptions(config.Config{
+		MaxReconnects:    -1,
+		ReconnectWait:    time.Second,
+		ReconnectBufSize: -1,
+	})
+	is.NoErr(err)
+
+	natsOpts := nats.GetDefaultOptions()
+	for _, opt := range opts {
+		is.NoErr(opt(&natsOpts))
+	}
+
+	is.Equal(natsOpts.MaxReconnect, -1)
+	is.Equal(natsOpts.ReconnectWait, time.Second)
+	is.Equal(natsOpts.ReconnectBufSize, -1)
+}
+
+func TestGetConnectionOptions_timeoutAndPings(t *testing.T) {
+	is := is.New(t)
+
+	defaults := nats.GetDefaultOptions()
+
+	opts, err := GetConnectionOptions(config.Config{})
+	is.NoErr(err)
+
+	natsOpts := nats.GetDefaultOptions()
+	for _, opt := range opts {
+		is.NoErr(opt(&natsOpts))
+	}
+
+	is.Equal(natsOpts.Timeout, defaults.Timeout)
+	is.Equal(natsOpts.PingInterval, defaults.PingInterval)
+	is.Equal(natsOpts.MaxPingsOut, defaults.MaxPingsOut)
+
+	opts, err = GetConnectionOptions(config.Config{
+		ConnectionTimeout:   10 * time.Second,
+		PingInterval:        time.Minute,
+		MaxPingsOutstanding: 5,
+	})
+	is.NoErr(err)
+
+	natsOpts = nats.GetDefaultOptions()
+	for _, opt := range opts {
+		is.NoErr(opt(&natsOpts))
+	}
+
+	is.Equal(natsOpts.Timeout, 10*time.Second)
+	is.Equal(natsOpts.PingInterval, time.Minute)
+	is.Equal(natsOpts.MaxPingsOut, 5)
+}
+
+func TestGetConnectionOptions_inboxPrefix(t *testing.T) {
+	is := is.New(t)
+
+	opts, err := GetConnectionOptions(config.Config{InboxPrefix: "_INBOX_conduit"})
+	is.NoErr(err)
+
+	natsOpts := nats.GetDefaultOptions()
+	for _, opt := range opts {
+		is.NoErr(opt(&natsOpts))
+	}
+
+	is.Equal(natsOpts.InboxPrefix, "_INBOX_conduit")
+
+	conn, err := nats.Connect("nats://"+startTestServer(t), opts...)
+	is.NoErr(err)
+	defer conn.Close()
+
+	is.True(strings.HasPrefix(conn.NewRespInbox(), "_INBOX_conduit."))
+}
+
+func TestJetStreamOptions(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(len(JetStreamOptions(config.Config{})), 0)
+	is.Equal(len(JetStreamOptions(config.Config{JetStreamDomain: "hub"})), 1)
+	is.Equal(len(JetStreamOptions(config.Config{JetStreamAPIPrefix: "$JS.hub.API"})), 1)
+
+	conn, err := nats.Connect("nats://"+startTestServer(t), nats.NoReconnect())
+	is.NoErr(err)
+	defer conn.Close()
+
+	// the options are accepted by the client
+	_, err = conn.JetStream(JetStreamOptions(config.Config{JetStreamDomain: "hub"})...)
+	is.NoErr(err)
+}
+
+func TestJetStreamAPIPrefix(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(JetStreamAPIPrefix(config.Config{}), "$JS.API.")
+	is.Equal(JetStreamAPIPrefix(config.Config{JetStreamDomain: "hub"}), "$JS.hub.API.")
+	is.Equal(JetStreamAPIPrefix(config.Config{JetStreamAPIPrefix: "$JS.hub.API"}), "$JS.hub.API.")
+	is.Equal(JetStreamAPIPrefix(config.Config{JetStreamAPIPrefix: "$JS.hub.API."}), "$JS.hub.API.")
+}
+
+func TestGetConnectionOptions_failover(t *testing.T) {
+	is := is.New(t)
+
+	// reserve a port and release it right away, so nothing listens on it
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err)
+	deadURL := "nats://" + dead.Addr().String()
+	is.NoErr(dead.Close())
+
+	aliveURL := "nats://" + startTestServer(t)
+
+	opts, err := GetConnectionOptions(config.Config{
+		URLs:          []string{deadURL, aliveURL},
+		DontRandomize: true,
+	})
+	is.NoErr(err)
+
+	conn, err := nats.Connect(strings.Join([]string{deadURL, aliveURL}, ","), opts...)
+	is.NoErr(err)
+	defer conn.Close()
+
+	is.Equal(conn.ConnectedUrl(), aliveURL)
+	is.Equal(conn.Servers(), []string{deadURL, aliveURL})
+}
+
+// startTestServer starts a server which speaks just enough of the NATS protocol
+// to let a client connect and returns its address.
+func startTestServer(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				_, _ = conn.Write([]byte(`INFO {"server_id":"test","version":"2.10.0","max_payload":1048576}` + "\r\n"))
+
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if strings.HasPrefix(scanner.Text(), "PING") {
+						_, _ = conn.Write([]byte("PONG\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestGetConnectionOptions_passwordNotInError(t *testing.T) {
+	is := is.New(t)
+
+	const password = "very-s3cr3t-password"
+
+	opts, err := GetConnectionOptions(config.Config{
+		Username: "user",
+		Password: password,
+	})
+	is.NoErr(err)
+
+	// nothing listens on the port, so connecting fails right away
+	_, err = nats.Connect("nats://127.0.0.1:1", opts...)
+	is.True(err != nil)
+	is.True(!strings.Contains(err.Error(), password))
+}
+
+func TestValidateCredentialsFile(t *testing.T) {
+	dir := t.TempDir()
+
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	seed, err := user.Seed()
+	if err != nil {
+		t.Fatalf("get seed: %v", err)
+	}
+
+	validPath := filepath.Join(dir, "valid.creds")
+	writeTestCredentials(t, validPath, "eyJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5LW5rZXkifQ.e30.c2lnbmF0dXJl", string(seed))
+
+	noSeedPath := filepath.Join(dir, "no_seed.creds")
+	writeTestCredentials(t, noSeedPath, "eyJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5LW5rZXkifQ.e30.c2lnbmF0dXJl", "")
+
+	emptyPath := filepath.Join(dir, "empty.creds")
+	if err := os.WriteFile(emptyPath, nil, 0o600); err != nil {
+		t.Fatalf("write empty credentials: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{
+			name: "success",
+			path: validPath,
+		},
+		{
+			name:    "fail, file not found",
+			path:    filepath.Join(dir, "missing.creds"),
+			wantErr: ErrCredentialsFileNotFound,
+		},
+		{
+			name:    "fail, no seed",
+			path:    noSeedPath,
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "fail, empty file",
+			path:    emptyPath,
+			wantErr: ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			err := validateCredentialsFile(tt.path)
+			if tt.wantErr != nil {
+				is.True(errors.Is(err, tt.wantErr))
+
+				return
+			}
+
+			is.NoErr(err)
+		})
+	}
+}
+
+// writeTestCredentials writes a decorated credentials file with the user JWT and seed to the path.
+func writeTestCredentials(t *testing.T, path, userJWT, seed string) {
+	t.Helper()
+
+	contents := "-----BEGIN NATS USER JWT-----\n" + userJWT + "\n------END NATS USER JWT------\n\n"
+	if seed != "" {
+		contents += "-----BEGIN USER NKEY SEED-----\n" + seed + "\n------END USER NKEY SEED------\n"
+	}
+
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("write credentials: %v", err)
+	}
+}
+
+// writeTestCACert writes a self-signed CA certificate in the PEM format to the path.
+func writeTestCACert(t *testing.T, path string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, certPEM, 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+}
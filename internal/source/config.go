@@ -18,9 +18,14 @@ package source
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/conduitio-labs/conduit-connector-nats-jetstream/config"
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
 	commonscfg "github.com/conduitio/conduit-commons/config"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/google/uuid"
@@ -30,27 +35,245 @@ import (
 const (
 	// defaultDeliverSubjectSuffix is the default deliver subject suffix.
 	defaultDeliverSubjectSuffix = "conduit"
+	// modePubSub subscribes to core NATS instead of consuming a JetStream stream.
+	modePubSub = "pubsub"
+)
+
+var (
+	errInvalidKeySource = errors.New(`KeySource must be one of "subject", "subject.<index>" or "header.<name>"`)
+	errBindOnlyDurable  = errors.New("BindOnly requires the Durable to be set")
+	errBindOnlyOrdered  = errors.New("BindOnly can't be combined with Ordered")
+	errResetBindOnly    = errors.New("ResetOnStart can't be combined with BindOnly")
+
+	errFetchMaxWait                  = errors.New("FetchMaxWait must be a positive value")
+	errNegativeStreamDuplicateWindow = errors.New("StreamDuplicateWindow can't be a negative value")
+	errNegativeStreamMaxMsgs         = errors.New("StreamMaxMsgsPerSubject can't be a negative value")
+	errNegativeStreamMaxBytes        = errors.New("StreamMaxBytes can't be a negative value")
+	errStartSequenceRequired         = errors.New(`StartSequence is required by the "by-start-sequence" DeliverPolicy`)
+	errStartSequencePolicy           = errors.New(`StartSequence requires the "by-start-sequence" DeliverPolicy`)
+	errStartTimeRequired             = errors.New(`StartTime is required by the "by-start-time" DeliverPolicy`)
+	errInvalidMatchHeader            = errors.New(`MatchHeader must be in the form of "<name>=<value>" or "<name>"`)
+	errNegativeMaxMessageAge         = errors.New("MaxMessageAge can't be a negative value")
+	errStreamRequired                = errors.New(
+		"Stream is required unless the Streams or the KVBucket are set or the Mode is pubsub",
+	)
+	errStreamsStream         = errors.New("Streams can't be combined with the Stream")
+	errStreamsMode           = errors.New("Streams can't be combined with the KVBucket or the pubsub mode")
+	errStreamsFilterSubjects = errors.New("Streams can't be combined with the FilterSubjects")
+	errKVBucketPubSub        = errors.New("KVBucket can't be used in the pubsub mode")
+	errDurabilityJetStream   = errors.New("Durability can only be used in the pubsub mode")
+	errWALPathRequired       = errors.New("WALPath is required if Durability is enabled")
+	errQueueGroupJetStream   = errors.New("QueueGroup can only be used in the pubsub mode")
 )
 
 // Config holds source specific configurable values.
 type Config struct {
 	config.Config
 
+	// Mode defines whether the connector consumes a JetStream stream ("jetstream")
+	// or subscribes to the Subject on core NATS ("pubsub"). Core NATS doesn't store
+	// messages, so only the ones published while the connector is subscribed are read,
+	// and they aren't redelivered, unless the Durability is enabled.
+	// The stream and consumer options don't apply to the pubsub mode.
+	Mode string `json:"mode" validate:"inclusion=jetstream|pubsub" default:"jetstream"`
+	// Durability makes the connector write the messages read in the pubsub mode to the
+	// WALPath, and keep them there until they're acknowledged. The messages which weren't
+	// acknowledged before the connector stopped are read again once it restarts.
+	Durability bool `json:"durability" default:"false"`
+	// WALPath is the path of the file the messages are written to if the Durability is enabled.
+	WALPath string `json:"walPath"`
+	// QueueGroup is the queue group of the subscription in the pubsub mode. Connectors
+	// sharing the same Subject and QueueGroup split the messages between each other,
+	// so each message is delivered to only one of them.
+	QueueGroup string `json:"queueGroup"`
 	// BufferSize is a buffer size for consumed messages.
 	// It must be set to avoid the problem with slow consumers.
 	// See details about slow consumers here https://docs.nats.io/using-nats/developer/connecting/events/slow.
 	BufferSize int `json:"bufferSize" validate:"greater-than=64" default:"1024"`
-	// Stream is the name of the Stream to be consumed.
-	Stream string `json:"stream" validate:"required"`
+	// Stream is the name of the Stream to be consumed. It's required unless the KVBucket is set
+	// or the Mode is pubsub.
+	Stream string `json:"stream"`
+	// Streams is a list of streams consumed instead of the Stream, each in the form of
+	// "<stream>[:<subject>[:<durable>]]". The subject defaults to the Subject and the durable
+	// to "<Durable>-<stream>", the subject must be captured by the stream. Each stream is consumed
+	// by a consumer of its own, created with the rest of the consumer settings, and the records
+	// of all the streams are read in turns.
+	// The DeliverSubject of a push consumer is "<durable>.conduit".
+	Streams []string `json:"streams"`
 	// Durable is the name of the Consumer, if set will make a consumer durable,
 	// allowing resuming consumption where left off.
 	Durable string `json:"durable"`
 	// DeliverSubject specifies the JetStream consumer deliver subject.
 	DeliverSubject string `json:"deliverSubject"`
 	// DeliverPolicy defines where in the stream the connector should start receiving messages.
-	DeliverPolicy string `json:"deliverPolicy" validate:"inclusion=all|new" default:"all"`
+	// "last" starts with the last message of the stream, "last-per-subject" delivers only the last
+	// message of each subject matching the Subject, so it requires the Subject to contain a wildcard.
+	// "by-start-sequence" requires the StartSequence and "by-start-time" requires the StartTime.
+	// A stored position takes precedence over it.
+	DeliverPolicy string `json:"deliverPolicy" validate:"inclusion=all|new|last|last-per-subject|by-start-sequence|by-start-time" default:"all"` //nolint:lll // struct tags can't be wrapped
+	// StartSequence is the stream sequence from which the connector starts receiving messages
+	// with the "by-start-sequence" DeliverPolicy.
+	StartSequence uint64 `json:"startSequence"`
 	// AckPolicy defines how messages should be acknowledged.
 	AckPolicy string `json:"ackPolicy" validate:"inclusion=explicit|none|all" default:"explicit"`
+	// AckSync makes the connector wait for the server to confirm every acknowledgement,
+	// so acknowledgements lost when the connection drops are reported as errors.
+	AckSync bool `json:"ackSync" default:"false"`
+	// AckMode defines the order in which records can be acknowledged. "fifo" accepts acknowledgements
+	// only in the order the records were read, so an acknowledgement of a record before the older ones
+	// fails, and "any" in any order, e.g. when the records are processed in parallel.
+	AckMode string `json:"ackMode" validate:"inclusion=any|fifo" default:"fifo"`
+	// StartTime is an RFC 3339 timestamp, e.g. "2024-01-02T15:04:05Z", from which the connector
+	// starts receiving messages. It can only be combined with the "by-start-time" or the "all"
+	// DeliverPolicy, and a stored position takes precedence over it.
+	StartTime string `json:"startTime"`
+	// ReplayPolicy defines whether messages are delivered as fast as possible ("instant")
+	// or at the pace they were published to the stream ("original").
+	ReplayPolicy string `json:"replayPolicy" validate:"inclusion=instant|original" default:"instant"`
+	// ConsumerType defines whether the connector fetches messages using a pull consumer
+	// or receives them on the DeliverSubject using a push consumer.
+	ConsumerType string `json:"consumerType" validate:"inclusion=pull|push" default:"pull"`
+	// Ordered makes the connector use an ordered consumer, which delivers messages strictly
+	// in order and doesn't require acknowledgements. The consumer is ephemeral and managed
+	// by the NATS client, so the ConsumerType, Durable, DeliverSubject and AckPolicy are ignored.
+	Ordered bool `json:"ordered" default:"false"`
+	// RateLimit is the maximum delivery rate of a push consumer in bits per second.
+	// It's not supported by pull consumers. If it's not set the delivery isn't limited.
+	RateLimit uint64 `json:"rateLimit"`
+	// Heartbeat is the idle heartbeat interval of a push consumer.
+	// It must be less than the ack wait of the consumer.
+	Heartbeat time.Duration `json:"heartbeat" default:"2s"`
+	// AckWait is the duration the server waits for an acknowledgement before
+	// redelivering a message. If it's not set the server default (30s) is used.
+	// It must be greater than the Heartbeat, and messages delivered, but not
+	// acknowledged within it count towards the consumer's max ack pending limit.
+	AckWait time.Duration `json:"ackWait"`
+	// MaxDeliver is the maximum number of delivery attempts of a message.
+	// If it's not set messages are redelivered until they are acknowledged.
+	MaxDeliver int `json:"maxDeliver"`
+	// BackOff is a comma separated list of redelivery intervals, e.g. "1s,5s,30s".
+	// The last interval is used for all the subsequent redeliveries.
+	// It requires the MaxDeliver to be set and can't contain more intervals than MaxDeliver.
+	BackOff []time.Duration `json:"backOff"`
+	// FilterSubjects is a comma separated list of subjects the consumer receives messages from
+	// instead of the Subject, which is then used only to look up the stream.
+	// All of them must be captured by the stream.
+	FilterSubjects []string `json:"filterSubjects"`
+	// MatchSubject is a subject, which may contain wildcards, the messages must match to become records,
+	// e.g. "orders.*.created". Unlike the FilterSubjects it's evaluated by the connector, so the messages
+	// which don't match are still delivered to it, and they're skipped and acknowledged.
+	MatchSubject string `json:"matchSubject"`
+	// MatchHeader is a header the messages must have to become records, in the form of "<name>=<value>",
+	// or "<name>" to match any value. The name is case-sensitive. The messages which don't match
+	// are skipped and acknowledged.
+	MatchHeader string `json:"matchHeader"`
+	// MaxMessageAge is the maximum age of the messages, based on the time they were stored in the stream,
+	// to become records. Older messages are skipped and acknowledged when they're delivered, unlike
+	// the StreamMaxAge, which makes the server remove them. If it's not set the age isn't checked.
+	// It doesn't apply to the KVBucket and the pubsub mode.
+	MaxMessageAge time.Duration `json:"maxMessageAge"`
+	// MaxAckPending is the maximum number of messages delivered to the connector, but not
+	// acknowledged yet. Once it's reached the server stops delivering messages until some
+	// of them are acknowledged. It must not be less than the BufferSize, as every buffered
+	// message is awaiting an acknowledgement.
+	// If it's not set the server default (1000) is used.
+	MaxAckPending int `json:"maxAckPending"`
+	// FetchBatchSize is the maximum number of messages a pull consumer requests at once.
+	// It doesn't apply to push consumers.
+	FetchBatchSize int `json:"fetchBatchSize" validate:"greater-than=0" default:"128"`
+	// FetchMaxWait is the maximum amount of time a pull consumer waits for a batch of messages.
+	// A fetch which receives no messages within it isn't an error, the connector fetches again.
+	// It doesn't apply to push consumers.
+	FetchMaxWait time.Duration `json:"fetchMaxWait" default:"1s"`
+	// PropagateHeaders defines whether NATS message headers are copied into the record metadata
+	// under the "nats.header." prefix. Multiple values of a header are joined with a comma.
+	PropagateHeaders bool `json:"propagateHeaders" default:"true"`
+	// SourcePositionMetadata makes the connector copy the Conduit-Source-Position header,
+	// written by the destination's SourcePositionHeader option, into the "conduit.source.position"
+	// record metadata field, regardless of the PropagateHeaders.
+	SourcePositionMetadata bool `json:"sourcePositionMetadata" default:"false"`
+	// BeforeHeader makes the connector read the base64 encoded Conduit-Before header, written by
+	// the destination's BeforeHeader option, into the payload before the change, so messages
+	// with the header become update records. Messages without it stay create records.
+	BeforeHeader bool `json:"beforeHeader" default:"false"`
+	// KeySource defines where the record key is taken from. "subject" takes the whole
+	// message subject, "subject.<index>" the token of the subject at the zero-based index,
+	// e.g. "subject.2" takes "123" from "orders.eu.123", and "header.<name>" the message
+	// header <name>. If it's not set, or the message doesn't contain the key, records have no key.
+	KeySource string `json:"keySource"`
+	// LegacyRecordFormat omits the "opencdc.collection" metadata, holding the message subject,
+	// and the "nats.stream" metadata, holding the stream name, from records, so they have
+	// the same shape as in previous versions of the connector.
+	LegacyRecordFormat bool `json:"legacyRecordFormat" default:"false"`
+	// PayloadEncoding defines how message payloads are encoded. They are decoded
+	// before records are created. A message which fails to be decoded fails the read.
+	PayloadEncoding string `json:"payloadEncoding" validate:"inclusion=none|base64|gzip" default:"none"`
+	// TrackDeletes makes the connector produce delete records for messages deleted from the stream,
+	// keyed by their stream sequence, and for purges of the stream. It subscribes to the JetStream
+	// API audit advisories, so it requires the permission to subscribe to "$JS.EVENT.ADVISORY.API".
+	TrackDeletes bool `json:"trackDeletes" default:"false"`
+	// BindOnly makes the connector bind to an existing consumer named Durable, without creating,
+	// updating or deleting it, e.g. if consumers are provisioned separately. The consumer's own
+	// config is used, so the settings of the consumer, including the DeliverPolicy, StartTime
+	// and the stored position, are ignored. The ConsumerType must match the consumer.
+	BindOnly bool `json:"bindOnly" default:"false"`
+	// HeadersOnly makes the consumer deliver only the message headers, without the payload.
+	// Records are created from the headers, regardless of the PropagateHeaders, have an empty
+	// payload and the size of the original payload in the "nats.msgSize" metadata.
+	HeadersOnly bool `json:"headersOnly" default:"false"`
+	// KVBucket makes the connector watch the keys of the KV bucket matching the Subject,
+	// e.g. ">" for all the keys, instead of consuming the Stream. Puts become create records,
+	// or update records if the key is known to exist, and deletes and purges become delete records.
+	// The consumer options don't apply to the watcher.
+	KVBucket string `json:"kvBucket"`
+	// KVUpdatesOnly makes the connector read only the changes made to the KVBucket after it starts,
+	// without the current values of the keys.
+	KVUpdatesOnly bool `json:"kvUpdatesOnly" default:"false"`
+	// KVIgnoreDeletes makes the connector skip the keys deleted or purged from the KVBucket.
+	KVIgnoreDeletes bool `json:"kvIgnoreDeletes" default:"false"`
+	// DeleteConsumerOnStop defines whether the consumer is deleted when the connector stops.
+	// Deleting the consumer loses its delivery and acknowledgement state.
+	// By default, consumers with a configured Durable name are kept, so the connector resumes
+	// where it left off after a restart, and consumers with a generated name are deleted.
+	DeleteConsumerOnStop bool `json:"deleteConsumerOnStop"`
+	// IgnoreStopErrors makes the connector log the errors of stopping the consumer, e.g. a failure
+	// to negatively acknowledge the buffered messages or to delete the consumer, as warnings
+	// instead of failing to stop. A consumer which was already deleted never fails the stop.
+	IgnoreStopErrors bool `json:"ignoreStopErrors" default:"false"`
+	// ResetOnStart makes the connector delete the consumer named Durable, if it exists, and re-create it
+	// every time it starts, so all the messages of the stream are read again, e.g. to reprocess them.
+	// The stored position, the DeliverPolicy, the StartSequence and the StartTime are ignored.
+	// It should be disabled once the messages are reprocessed, otherwise they're read again on every restart.
+	ResetOnStart bool `json:"resetOnStart" default:"false"`
+	// ValidateOnOpen makes the connector check the stream and the consumer config before it starts
+	// reading, without creating anything, and fail to start with a precise error if the stream doesn't exist,
+	// doesn't capture the whole Subject, or an existing consumer has an incompatible config.
+	// It's ignored for the KVBucket and the pubsub mode.
+	ValidateOnOpen bool `json:"validateOnOpen" default:"false"`
+	// AutoCreateStream makes the connector create the Stream if it doesn't exist.
+	// The created stream captures the Subject and the StreamSubjects.
+	AutoCreateStream bool `json:"autoCreateStream" default:"false"`
+	// StreamSubjects is a list of subjects captured by the auto-created stream in addition to the Subject.
+	StreamSubjects []string `json:"streamSubjects"`
+	// StreamRetention is the retention policy of the auto-created stream.
+	StreamRetention string `json:"streamRetention" validate:"inclusion=limits|interest|workqueue" default:"limits"`
+	// StreamStorage is the storage type of the auto-created stream. Memory storage is faster,
+	// but the messages are lost once the server restarts, so it suits ephemeral pipelines.
+	StreamStorage string `json:"streamStorage" validate:"inclusion=file|memory" default:"file"`
+	// StreamMaxAge is the maximum age of messages in the auto-created stream.
+	// If it's not set the messages don't expire.
+	StreamMaxAge time.Duration `json:"streamMaxAge"`
+	// StreamDuplicateWindow is the window in which the auto-created stream deduplicates
+	// messages by their Nats-Msg-Id header. If it's not set the server default (2 minutes) is used.
+	StreamDuplicateWindow time.Duration `json:"streamDuplicateWindow"`
+	// StreamMaxMsgsPerSubject is the maximum number of messages per subject kept by the auto-created
+	// stream, the oldest messages of a subject are discarded once it's reached. It bounds the storage
+	// of a stream capturing a wildcard Subject with many distinct subjects. It applies to the limits
+	// and interest retention policies. If it's not set the number isn't limited.
+	StreamMaxMsgsPerSubject int64 `json:"streamMaxMsgsPerSubject"`
+	// StreamMaxBytes is the maximum size in bytes of the auto-created stream, the oldest messages
+	// are discarded once it's reached. If it's not set the size isn't limited.
+	StreamMaxBytes int64 `json:"streamMaxBytes"`
 }
 
 func ParseConfig(ctx context.Context, cfg commonscfg.Config, parameters commonscfg.Parameters) (Config, error) {
@@ -58,10 +281,12 @@ func ParseConfig(ctx context.Context, cfg commonscfg.Config, parameters commonsc
 	// set defaults
 	parsedCfg := Config{
 		Config: config.Config{
-			ConnectionName: sdk.ConnectorIDFromContext(ctx),
+			ConnectionName: config.DefaultConnectionName("source", sdk.ConnectorIDFromContext(ctx)),
 		},
 		Durable:        durable,
 		DeliverSubject: fmt.Sprintf("%s.%s", durable, defaultDeliverSubjectSuffix),
+		// only the consumers with a generated name are deleted by default
+		DeleteConsumerOnStop: cfg[ConfigDurable] == "",
 	}
 
 	err := sdk.Util.ParseConfig(ctx, cfg, &parsedCfg, parameters)
@@ -69,6 +294,11 @@ func ParseConfig(ctx context.Context, cfg commonscfg.Config, parameters commonsc
 		return Config{}, err
 	}
 
+	// a generated durable name can't refer to an existing consumer
+	if parsedCfg.BindOnly && cfg[ConfigDurable] == "" {
+		return Config{}, errBindOnlyDurable
+	}
+
 	err = parsedCfg.Validate()
 	if err != nil {
 		return Config{}, err
@@ -77,18 +307,251 @@ func ParseConfig(ctx context.Context, cfg commonscfg.Config, parameters commonsc
 	return parsedCfg, nil
 }
 
+func (c *Config) Validate() error {
+	var errs []error
+
+	if err := c.Config.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := c.NATSStartTime(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateDeliverPolicy(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if !isValidKeySource(c.KeySource) {
+		errs = append(errs, errInvalidKeySource)
+	}
+
+	if c.MatchSubject != "" {
+		if err := internal.ValidateSubject(c.MatchSubject, true); err != nil {
+			errs = append(errs, fmt.Errorf("match subject: %w", err))
+		}
+	}
+
+	if name, _, _ := strings.Cut(c.MatchHeader, "="); c.MatchHeader != "" && name == "" {
+		errs = append(errs, errInvalidMatchHeader)
+	}
+
+	if c.MaxMessageAge < 0 {
+		errs = append(errs, errNegativeMaxMessageAge)
+	}
+
+	if c.BindOnly && c.Ordered {
+		errs = append(errs, errBindOnlyOrdered)
+	}
+
+	if c.ResetOnStart && c.BindOnly {
+		errs = append(errs, errResetBindOnly)
+	}
+
+	if c.Stream == "" && len(c.Streams) == 0 && c.KVBucket == "" && c.Mode != modePubSub {
+		errs = append(errs, errStreamRequired)
+	}
+
+	if len(c.Streams) > 0 {
+		errs = append(errs, c.validateStreams()...)
+	}
+
+	if c.KVBucket != "" && c.Mode == modePubSub {
+		errs = append(errs, errKVBucketPubSub)
+	}
+
+	if c.Durability && c.Mode != modePubSub {
+		errs = append(errs, errDurabilityJetStream)
+	}
+
+	if c.QueueGroup != "" && c.Mode != modePubSub {
+		errs = append(errs, errQueueGroupJetStream)
+	}
+
+	if c.Durability && c.WALPath == "" {
+		errs = append(errs, errWALPathRequired)
+	}
+
+	if c.FetchMaxWait <= 0 {
+		errs = append(errs, errFetchMaxWait)
+	}
+
+	if c.StreamDuplicateWindow < 0 {
+		errs = append(errs, errNegativeStreamDuplicateWindow)
+	}
+
+	if c.StreamMaxMsgsPerSubject < 0 {
+		errs = append(errs, errNegativeStreamMaxMsgs)
+	}
+
+	if c.StreamMaxBytes < 0 {
+		errs = append(errs, errNegativeStreamMaxBytes)
+	}
+
+	return errors.Join(errs...)
+}
+
+// isValidKeySource checks if the keySource is empty or refers to a supported message field.
+func isValidKeySource(keySource string) bool {
+	if keySource == "" || keySource == keySourceSubject {
+		return true
+	}
+
+	if index, ok := strings.CutPrefix(keySource, keySourceSubjectTokenPrefix); ok {
+		i, err := strconv.Atoi(index)
+
+		return err == nil && i >= 0
+	}
+
+	name, ok := strings.CutPrefix(keySource, keySourceHeaderPrefix)
+
+	return ok && name != ""
+}
+
+// validateStreams checks that the Streams are valid, unique and not combined with the settings
+// of a single stream.
+func (c Config) validateStreams() []error {
+	var errs []error
+
+	if c.Stream != "" {
+		errs = append(errs, errStreamsStream)
+	}
+
+	if c.KVBucket != "" || c.Mode == modePubSub {
+		errs = append(errs, errStreamsMode)
+	}
+
+	if len(c.FilterSubjects) > 0 {
+		errs = append(errs, errStreamsFilterSubjects)
+	}
+
+	seen := make(map[string]bool, len(c.Streams))
+	for _, stream := range c.NATSStreams() {
+		switch {
+		case stream.Stream == "":
+			errs = append(errs, errors.New("streams: stream name can't be empty"))
+		case seen[stream.Stream]:
+			errs = append(errs, fmt.Errorf("streams: stream %q is listed more than once", stream.Stream))
+		}
+		seen[stream.Stream] = true
+
+		if err := internal.ValidateSubject(stream.Subject, true); err != nil {
+			errs = append(errs, fmt.Errorf("streams: subject of stream %q: %w", stream.Stream, err))
+		}
+
+		if stream.Durable == "" {
+			errs = append(errs, fmt.Errorf("streams: durable of stream %q can't be empty", stream.Stream))
+		}
+	}
+
+	return errs
+}
+
+// validateDeliverPolicy checks that the DeliverPolicy has the start it requires.
+func (c Config) validateDeliverPolicy() error {
+	switch {
+	case c.DeliverPolicy == "by-start-sequence" && c.StartSequence == 0:
+		return errStartSequenceRequired
+	case c.DeliverPolicy != "by-start-sequence" && c.StartSequence != 0:
+		return errStartSequencePolicy
+	case c.DeliverPolicy == "by-start-time" && c.StartTime == "":
+		return errStartTimeRequired
+	}
+
+	return nil
+}
+
+// NATSStreams returns the parsed Streams, the missing subjects and durables are set to their defaults.
+func (c Config) NATSStreams() []StreamParams {
+	if len(c.Streams) == 0 {
+		return nil
+	}
+
+	streams := make([]StreamParams, len(c.Streams))
+	for i, entry := range c.Streams {
+		parts := strings.SplitN(entry, ":", 3)
+
+		stream := StreamParams{
+			Stream:  parts[0],
+			Subject: c.Subject,
+			Durable: c.Durable + "-" + parts[0],
+		}
+
+		if len(parts) > 1 && parts[1] != "" {
+			stream.Subject = parts[1]
+		}
+
+		if len(parts) > 2 {
+			stream.Durable = parts[2]
+		}
+
+		stream.DeliverSubject = fmt.Sprintf("%s.%s", stream.Durable, defaultDeliverSubjectSuffix)
+		streams[i] = stream
+	}
+
+	return streams
+}
+
+// NATSStartTime returns the parsed StartTime or a zero time if it's not set.
+func (c Config) NATSStartTime() (time.Time, error) {
+	if c.StartTime == "" {
+		return time.Time{}, nil
+	}
+
+	startTime, err := time.Parse(time.RFC3339, c.StartTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse start time: %w", err)
+	}
+
+	return startTime, nil
+}
+
 func (c Config) NATSDeliverPolicy() nats.DeliverPolicy {
 	switch c.DeliverPolicy {
 	case "all", "":
 		return nats.DeliverAllPolicy
 	case "new":
 		return nats.DeliverNewPolicy
+	case "last":
+		return nats.DeliverLastPolicy
+	case "last-per-subject":
+		return nats.DeliverLastPerSubjectPolicy
+	case "by-start-sequence":
+		return nats.DeliverByStartSequencePolicy
+	case "by-start-time":
+		return nats.DeliverByStartTimePolicy
 	default:
 		// shouldn't happen, because the SDK should limit the options to only the valid ones
 		panic(fmt.Errorf("invalid deliver policy %q", c.DeliverPolicy))
 	}
 }
 
+func (c Config) NATSRetentionPolicy() nats.RetentionPolicy {
+	switch c.StreamRetention {
+	case "limits", "":
+		return nats.LimitsPolicy
+	case "interest":
+		return nats.InterestPolicy
+	case "workqueue":
+		return nats.WorkQueuePolicy
+	default:
+		// shouldn't happen, because the SDK should limit the options to only the valid ones
+		panic(fmt.Errorf("invalid stream retention %q", c.StreamRetention))
+	}
+}
+
+func (c Config) NATSStorageType() nats.StorageType {
+	switch c.StreamStorage {
+	case "file", "":
+		return nats.FileStorage
+	case "memory":
+		return nats.MemoryStorage
+	default:
+		// shouldn't happen, because the SDK should limit the options to only the valid ones
+		panic(fmt.Errorf("invalid stream storage %q", c.StreamStorage))
+	}
+}
+
 func (c Config) NATSAckPolicy() nats.AckPolicy {
 	switch c.AckPolicy {
 	case "explicit":
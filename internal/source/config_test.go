@@ -16,10 +16,14 @@ package source
 
 import (
 	"context"
+	"errors"
+	"maps"
 	"testing"
+	"time"
 
 	"github.com/nats-io/nats.go"
 
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
 	commonscfg "github.com/conduitio/conduit-commons/config"
 	"github.com/matryer/is"
 )
@@ -53,6 +57,103 @@ func TestParse_Durable_Custom(t *testing.T) {
 	is.Equal(rawCfg["durable"], parsed.Durable)
 }
 
+func TestParse_ConnectionName(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      commonscfg.Config
+		expected string
+	}{
+		{
+			name: "default",
+			cfg: commonscfg.Config{
+				"urls":    "nats://127.0.0.1:1222",
+				"subject": "test-subject",
+				"stream":  "test-stream",
+			},
+			expected: "conduit-nats-source",
+		},
+		{
+			name: "custom",
+			cfg: commonscfg.Config{
+				"urls":           "nats://127.0.0.1:1222",
+				"subject":        "test-subject",
+				"stream":         "test-stream",
+				"connectionName": "foobar",
+			},
+			expected: "foobar",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			parsed, err := ParseConfig(context.Background(), tt.cfg, NewSource().Parameters())
+			is.NoErr(err)
+			is.Equal(parsed.ConnectionName, tt.expected)
+		})
+	}
+}
+
+func TestParse_DeleteConsumerOnStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      commonscfg.Config
+		expected bool
+	}{
+		{
+			name: "generated durable",
+			cfg: commonscfg.Config{
+				"urls":    "nats://127.0.0.1:1222",
+				"subject": "test-subject",
+				"stream":  "test-stream",
+			},
+			expected: true,
+		},
+		{
+			name: "custom durable",
+			cfg: commonscfg.Config{
+				"urls":    "nats://127.0.0.1:1222",
+				"subject": "test-subject",
+				"stream":  "test-stream",
+				"durable": "foobar",
+			},
+			expected: false,
+		},
+		{
+			name: "custom durable, explicitly deleted",
+			cfg: commonscfg.Config{
+				"urls":                 "nats://127.0.0.1:1222",
+				"subject":              "test-subject",
+				"stream":               "test-stream",
+				"durable":              "foobar",
+				"deleteConsumerOnStop": "true",
+			},
+			expected: true,
+		},
+		{
+			name: "generated durable, explicitly kept",
+			cfg: commonscfg.Config{
+				"urls":                 "nats://127.0.0.1:1222",
+				"subject":              "test-subject",
+				"stream":               "test-stream",
+				"deleteConsumerOnStop": "false",
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			parsed, err := ParseConfig(context.Background(), tt.cfg, NewSource().Parameters())
+			is.NoErr(err)
+			is.Equal(parsed.DeleteConsumerOnStop, tt.expected)
+		})
+	}
+}
+
 func TestParse_DeliverSubject_Default(t *testing.T) {
 	is := is.New(t)
 	ctx := context.Background()
@@ -131,6 +232,7 @@ func TestParse_DeliverPolicy(t *testing.T) {
 	testCases := []struct {
 		name  string
 		input string
+		extra commonscfg.Config
 		want  nats.DeliverPolicy
 	}{
 		{
@@ -147,6 +249,28 @@ func TestParse_DeliverPolicy(t *testing.T) {
 			input: "new",
 			want:  nats.DeliverNewPolicy,
 		},
+		{
+			name:  "last",
+			input: "last",
+			want:  nats.DeliverLastPolicy,
+		},
+		{
+			name:  "last-per-subject",
+			input: "last-per-subject",
+			want:  nats.DeliverLastPerSubjectPolicy,
+		},
+		{
+			name:  "by-start-sequence",
+			input: "by-start-sequence",
+			extra: commonscfg.Config{"startSequence": "42"},
+			want:  nats.DeliverByStartSequencePolicy,
+		},
+		{
+			name:  "by-start-time",
+			input: "by-start-time",
+			extra: commonscfg.Config{"startTime": "2024-01-02T15:04:05Z"},
+			want:  nats.DeliverByStartTimePolicy,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -159,6 +283,7 @@ func TestParse_DeliverPolicy(t *testing.T) {
 				"stream":        "test-stream",
 				"deliverPolicy": tc.input,
 			}
+			maps.Copy(rawCfg, tc.extra)
 
 			parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
 			is.NoErr(err)
@@ -166,3 +291,443 @@ func TestParse_DeliverPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestParse_DeliverPolicyStart(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":          "nats://127.0.0.1:1222",
+		"subject":       "test-subject",
+		"stream":        "test-stream",
+		"deliverPolicy": "by-start-sequence",
+	}
+
+	_, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errStartSequenceRequired))
+
+	rawCfg["deliverPolicy"] = "by-start-time"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errStartTimeRequired))
+
+	rawCfg["deliverPolicy"] = "all"
+	rawCfg["startSequence"] = "42"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errStartSequencePolicy))
+
+	rawCfg["deliverPolicy"] = "invalid"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(err != nil)
+}
+
+func TestParse_ConsumerType(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "default (pull)",
+			want: "pull",
+		},
+		{
+			name:  "pull",
+			input: "pull",
+			want:  "pull",
+		},
+		{
+			name:  "push",
+			input: "push",
+			want:  "push",
+		},
+		{
+			name:    "invalid",
+			input:   "poll",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+			rawCfg := commonscfg.Config{
+				"urls":         "nats://127.0.0.1:1222",
+				"subject":      "test-subject",
+				"stream":       "test-stream",
+				"consumerType": tc.input,
+			}
+
+			parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+			if tc.wantErr {
+				is.True(err != nil)
+
+				return
+			}
+			is.NoErr(err)
+			is.Equal(tc.want, parsed.ConsumerType)
+		})
+	}
+}
+
+func TestParse_BackOff(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":       "nats://127.0.0.1:1222",
+		"subject":    "test-subject",
+		"stream":     "test-stream",
+		"maxDeliver": "5",
+		"backOff":    "1s,5s,30s",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.MaxDeliver, 5)
+	is.Equal(parsed.BackOff, []time.Duration{time.Second, 5 * time.Second, 30 * time.Second})
+}
+
+func TestParse_StartTime(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":      "nats://127.0.0.1:1222",
+		"subject":   "test-subject",
+		"stream":    "test-stream",
+		"startTime": "2024-01-02T15:04:05Z",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+
+	startTime, err := parsed.NATSStartTime()
+	is.NoErr(err)
+	is.Equal(startTime, time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC))
+
+	rawCfg["startTime"] = "yesterday"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(err != nil)
+}
+
+func TestParse_RateLimit(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":         "nats://127.0.0.1:1222",
+		"subject":      "test-subject",
+		"stream":       "test-stream",
+		"consumerType": "push",
+		"rateLimit":    "1048576",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.RateLimit, uint64(1048576))
+}
+
+func TestParse_KeySource(t *testing.T) {
+	testCases := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: ""},
+		{input: "subject"},
+		{input: "subject.0"},
+		{input: "header.Order-Id"},
+		{input: "subject.-1", wantErr: true},
+		{input: "subject.first", wantErr: true},
+		{input: "header.", wantErr: true},
+		{input: "payload", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+			rawCfg := commonscfg.Config{
+				"urls":      "nats://127.0.0.1:1222",
+				"subject":   "test-subject",
+				"stream":    "test-stream",
+				"keySource": tc.input,
+			}
+
+			parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+			if tc.wantErr {
+				is.True(errors.Is(err, errInvalidKeySource))
+
+				return
+			}
+			is.NoErr(err)
+			is.Equal(tc.input, parsed.KeySource)
+		})
+	}
+}
+
+func TestParse_BindOnly(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":     "nats://127.0.0.1:1222",
+		"subject":  "test-subject",
+		"stream":   "test-stream",
+		"bindOnly": "true",
+	}
+
+	_, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errBindOnlyDurable))
+
+	rawCfg["durable"] = "foobar"
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.True(parsed.BindOnly)
+
+	rawCfg["ordered"] = "true"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errBindOnlyOrdered))
+}
+
+func TestParse_StreamDuplicateWindow(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":                  "nats://127.0.0.1:1222",
+		"subject":               "test-subject",
+		"stream":                "test-stream",
+		"autoCreateStream":      "true",
+		"streamDuplicateWindow": "5m",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.StreamDuplicateWindow, 5*time.Minute)
+
+	rawCfg["streamDuplicateWindow"] = "-1s"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errNegativeStreamDuplicateWindow))
+}
+
+func TestParse_StreamLimits(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":                    "nats://127.0.0.1:1222",
+		"subject":                 "orders.>",
+		"stream":                  "test-stream",
+		"autoCreateStream":        "true",
+		"streamMaxMsgsPerSubject": "10",
+		"streamMaxBytes":          "1048576",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.StreamMaxMsgsPerSubject, int64(10))
+	is.Equal(parsed.StreamMaxBytes, int64(1048576))
+
+	rawCfg["streamMaxMsgsPerSubject"] = "-1"
+	rawCfg["streamMaxBytes"] = "-1"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errNegativeStreamMaxMsgs))
+	is.True(errors.Is(err, errNegativeStreamMaxBytes))
+}
+
+func TestParse_ResetOnStart(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":         "nats://127.0.0.1:1222",
+		"subject":      "test-subject",
+		"stream":       "test-stream",
+		"durable":      "test-durable",
+		"resetOnStart": "true",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.True(parsed.ResetOnStart)
+
+	rawCfg["bindOnly"] = "true"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errResetBindOnly))
+}
+
+func TestParse_Fetch(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":    "nats://127.0.0.1:1222",
+		"subject": "test-subject",
+		"stream":  "test-stream",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.FetchBatchSize, 128)
+	is.Equal(parsed.FetchMaxWait, time.Second)
+
+	rawCfg["fetchBatchSize"] = "16"
+	rawCfg["fetchMaxWait"] = "250ms"
+	parsed, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.FetchBatchSize, 16)
+	is.Equal(parsed.FetchMaxWait, 250*time.Millisecond)
+
+	rawCfg["fetchMaxWait"] = "0s"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errFetchMaxWait))
+
+	rawCfg["fetchMaxWait"] = "1s"
+	rawCfg["fetchBatchSize"] = "0"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(err != nil)
+}
+
+func TestParse_KVBucket(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":    "nats://127.0.0.1:1222",
+		"subject": ">",
+	}
+
+	// the stream is required to consume a stream
+	_, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errStreamRequired))
+
+	rawCfg["kvBucket"] = "bucket"
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.KVBucket, "bucket")
+}
+
+func TestParse_PubSub(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":    "nats://127.0.0.1:1222",
+		"subject": "foo",
+		"mode":    "pubsub",
+	}
+
+	// no stream is consumed in the pubsub mode
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.Mode, modePubSub)
+
+	rawCfg["durability"] = "true"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errWALPathRequired))
+
+	rawCfg["walPath"] = "/tmp/wal"
+	parsed, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.True(parsed.Durability)
+
+	rawCfg["mode"] = "jetstream"
+	rawCfg["stream"] = "stream"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errDurabilityJetStream))
+
+	delete(rawCfg, "durability")
+	rawCfg["queueGroup"] = "workers"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errQueueGroupJetStream))
+
+	delete(rawCfg, "queueGroup")
+	rawCfg["mode"] = "pubsub"
+	rawCfg["kvBucket"] = "bucket"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errKVBucketPubSub))
+}
+
+func TestParse_Match(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":         "nats://127.0.0.1:1222",
+		"subject":      "orders.>",
+		"stream":       "stream",
+		"matchSubject": "orders.*.created",
+		"matchHeader":  "Type=order",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.MatchSubject, "orders.*.created")
+	is.Equal(parsed.MatchHeader, "Type=order")
+
+	rawCfg["matchSubject"] = "orders..created"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, internal.ErrInvalidSubject))
+
+	rawCfg["matchSubject"] = "orders.*.created"
+	rawCfg["matchHeader"] = "=order"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errInvalidMatchHeader))
+}
+
+func TestParse_MaxMessageAge(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":          "nats://127.0.0.1:1222",
+		"subject":       "orders.>",
+		"stream":        "stream",
+		"maxMessageAge": "1h",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.MaxMessageAge, time.Hour)
+
+	rawCfg["maxMessageAge"] = "-1s"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errNegativeMaxMessageAge))
+}
+
+func TestParse_Streams(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	rawCfg := commonscfg.Config{
+		"urls":    "nats://127.0.0.1:1222",
+		"subject": "orders.>",
+		"durable": "conduit",
+		"streams": "orders,returns:returns.>,archive::archive-consumer",
+	}
+
+	parsed, err := ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.NoErr(err)
+	is.Equal(parsed.NATSStreams(), []StreamParams{
+		{
+			Stream:         "orders",
+			Subject:        "orders.>",
+			Durable:        "conduit-orders",
+			DeliverSubject: "conduit-orders.conduit",
+		},
+		{
+			Stream:         "returns",
+			Subject:        "returns.>",
+			Durable:        "conduit-returns",
+			DeliverSubject: "conduit-returns.conduit",
+		},
+		{
+			Stream:         "archive",
+			Subject:        "orders.>",
+			Durable:        "archive-consumer",
+			DeliverSubject: "archive-consumer.conduit",
+		},
+	})
+
+	rawCfg["streams"] = "orders,orders:returns.>"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.Equal(err.Error(), `streams: stream "orders" is listed more than once`)
+
+	rawCfg["streams"] = "orders"
+	rawCfg["stream"] = "returns"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errStreamsStream))
+
+	delete(rawCfg, "stream")
+	rawCfg["filterSubjects"] = "orders.created"
+	_, err = ParseConfig(ctx, rawCfg, NewSource().Parameters())
+	is.True(errors.Is(err, errStreamsFilterSubjects))
+}
@@ -0,0 +1,220 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// apiAuditAdvisorySubject is the subject JetStream publishes an advisory to for every API call.
+	apiAuditAdvisorySubject = "$JS.EVENT.ADVISORY.API"
+	// msgDeleteAPISubject is the API subject, without the API prefix, deleting a message
+	// from the stream that follows it.
+	msgDeleteAPISubject = "STREAM.MSG.DELETE."
+	// purgeAPISubject is the API subject, without the API prefix, purging the stream that follows it.
+	purgeAPISubject = "STREAM.PURGE."
+)
+
+// apiAudit is the part of a JetStream API audit advisory needed to track deletes.
+type apiAudit struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Subject   string    `json:"subject"`
+	Request   string    `json:"request"`
+	Response  string    `json:"response"`
+}
+
+// deleteAdvisory describes a message deleted from the stream or a purge of the stream.
+type deleteAdvisory struct {
+	id        string
+	timestamp time.Time
+	// seq is the stream sequence of the deleted message. It's zero for purges.
+	seq uint64
+	// purge is set if the stream was purged, possibly only partially,
+	// as described by the filter, the purgeSeq and the keep.
+	purge    bool
+	filter   string
+	purgeSeq uint64
+	keep     uint64
+	purged   uint64
+}
+
+// parseDeleteAdvisory parses an API audit advisory and reports whether it describes
+// a successful delete of a message from the stream or a successful purge of the stream,
+// called on the API subjects with the apiPrefix. If the apiPrefix is empty the default one is used.
+func parseDeleteAdvisory(apiPrefix, stream string, data []byte) (deleteAdvisory, bool, error) {
+	var audit apiAudit
+	if err := json.Unmarshal(data, &audit); err != nil {
+		return deleteAdvisory{}, false, fmt.Errorf("unmarshal api audit advisory: %w", err)
+	}
+
+	advisory := deleteAdvisory{
+		id:        audit.ID,
+		timestamp: audit.Timestamp,
+	}
+
+	var response struct {
+		Success bool   `json:"success"`
+		Purged  uint64 `json:"purged"`
+	}
+
+	switch trimAPIPrefix(apiPrefix, audit.Subject) {
+	case msgDeleteAPISubject + stream:
+		var request struct {
+			Seq uint64 `json:"seq"`
+		}
+		if err := json.Unmarshal([]byte(audit.Request), &request); err != nil {
+			return deleteAdvisory{}, false, fmt.Errorf("unmarshal message delete request: %w", err)
+		}
+
+		advisory.seq = request.Seq
+	case purgeAPISubject + stream:
+		var request struct {
+			Filter string `json:"filter"`
+			Seq    uint64 `json:"seq"`
+			Keep   uint64 `json:"keep"`
+		}
+		// purging the whole stream doesn't require a request
+		if audit.Request != "" {
+			if err := json.Unmarshal([]byte(audit.Request), &request); err != nil {
+				return deleteAdvisory{}, false, fmt.Errorf("unmarshal purge request: %w", err)
+			}
+		}
+
+		advisory.purge = true
+		advisory.filter = request.Filter
+		advisory.purgeSeq = request.Seq
+		advisory.keep = request.Keep
+	default:
+		return deleteAdvisory{}, false, nil
+	}
+
+	if err := json.Unmarshal([]byte(audit.Response), &response); err != nil {
+		return deleteAdvisory{}, false, fmt.Errorf("unmarshal api response: %w", err)
+	}
+
+	if !response.Success {
+		return deleteAdvisory{}, false, nil
+	}
+	advisory.purged = response.Purged
+
+	return advisory, true, nil
+}
+
+// trimAPIPrefix removes the apiPrefix, or the default API prefix, from the API subject.
+// The default one is accepted too, as the server may report the subject mapped to its own API.
+func trimAPIPrefix(apiPrefix, subject string) string {
+	if apiPrefix != "" {
+		if trimmed, ok := strings.CutPrefix(subject, apiPrefix); ok {
+			return trimmed
+		}
+	}
+
+	if trimmed, ok := strings.CutPrefix(subject, internal.DefaultJetStreamAPIPrefix); ok {
+		return trimmed
+	}
+
+	return subject
+}
+
+// subscribeDeletes subscribes to the API audit advisories and passes the ones describing
+// deletes from the stream to the deletes channel.
+func (i *Iterator) subscribeDeletes(ctx context.Context) error {
+	i.deletes = make(chan deleteAdvisory, i.params.BufferSize)
+	i.deletesDone = make(chan struct{})
+
+	sub, err := i.nc.Subscribe(apiAuditAdvisorySubject, func(msg *nats.Msg) {
+		advisory, ok, err := parseDeleteAdvisory(i.params.APIPrefix, i.stream, msg.Data)
+		if err != nil {
+			sdk.Logger(ctx).Warn().Err(err).Msg("skipping api audit advisory")
+
+			return
+		}
+
+		if !ok {
+			return
+		}
+
+		select {
+		case i.deletes <- advisory:
+		case <-i.deletesDone:
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("subscribe to api audit advisories: %w", err)
+	}
+	i.deletesSubscription = sub
+
+	return nil
+}
+
+// nextDelete returns a delete advisory received, but not returned yet, if there is any.
+func (i *Iterator) nextDelete() (deleteAdvisory, bool) {
+	if len(i.pendingDeletes) > 0 {
+		advisory := i.pendingDeletes[0]
+		i.pendingDeletes = i.pendingDeletes[1:]
+
+		return advisory, true
+	}
+
+	select {
+	case advisory := <-i.deletes:
+		return advisory, true
+	default:
+		return deleteAdvisory{}, false
+	}
+}
+
+// deleteToRecord converts a delete advisory to a delete record keyed by the stream sequence
+// of the deleted message. Records of purges have no key and describe the purge in the metadata.
+// The position of the record holds the last position of a message, so resuming from it
+// neither skips nor repeats any messages.
+func (i *Iterator) deleteToRecord(advisory deleteAdvisory) (opencdc.Record, error) {
+	sdkPosition, err := position{
+		OptSeq:   i.lastSeq.Load(),
+		Advisory: advisory.id,
+	}.marshalSDKPosition()
+	if err != nil {
+		return opencdc.Record{}, fmt.Errorf("marshal sdk position: %w", err)
+	}
+
+	sdkMetadata := make(opencdc.Metadata)
+	sdkMetadata.SetCreatedAt(advisory.timestamp)
+	sdkMetadata.SetCollection(i.stream)
+	sdkMetadata[internal.MetadataStream] = i.stream
+
+	var key opencdc.Data
+	if advisory.purge {
+		sdkMetadata[internal.MetadataPurgeFilter] = advisory.filter
+		sdkMetadata[internal.MetadataPurgeSeq] = strconv.FormatUint(advisory.purgeSeq, 10)
+		sdkMetadata[internal.MetadataPurgeKeep] = strconv.FormatUint(advisory.keep, 10)
+		sdkMetadata[internal.MetadataPurged] = strconv.FormatUint(advisory.purged, 10)
+	} else {
+		key = opencdc.RawData(strconv.FormatUint(advisory.seq, 10))
+	}
+
+	return sdk.Util.Source.NewRecordDelete(sdkPosition, sdkMetadata, key, nil), nil
+}
@@ -0,0 +1,187 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+)
+
+func TestParseDeleteAdvisory(t *testing.T) {
+	tests := []struct {
+		name      string
+		apiPrefix string
+		data      string
+		want      deleteAdvisory
+		wantOK    bool
+	}{
+		{
+			name: "message delete",
+			data: `{"id":"a1","timestamp":"2024-01-02T15:04:05Z","subject":"$JS.API.STREAM.MSG.DELETE.orders",` +
+				`"request":"{\"seq\":42}","response":"{\"success\":true}"}`,
+			want: deleteAdvisory{
+				id:        "a1",
+				timestamp: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+				seq:       42,
+			},
+			wantOK: true,
+		},
+		{
+			name: "partial purge",
+			data: `{"id":"a2","timestamp":"2024-01-02T15:04:05Z","subject":"$JS.API.STREAM.PURGE.orders",` +
+				`"request":"{\"filter\":\"orders.eu\",\"keep\":5}","response":"{\"success\":true,\"purged\":10}"}`,
+			want: deleteAdvisory{
+				id:        "a2",
+				timestamp: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+				purge:     true,
+				filter:    "orders.eu",
+				keep:      5,
+				purged:    10,
+			},
+			wantOK: true,
+		},
+		{
+			name: "full purge",
+			data: `{"id":"a3","timestamp":"2024-01-02T15:04:05Z","subject":"$JS.API.STREAM.PURGE.orders",` +
+				`"response":"{\"success\":true,\"purged\":100}"}`,
+			want: deleteAdvisory{
+				id:        "a3",
+				timestamp: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+				purge:     true,
+				purged:    100,
+			},
+			wantOK: true,
+		},
+		{
+			name: "failed delete",
+			data: `{"id":"a4","subject":"$JS.API.STREAM.MSG.DELETE.orders",` +
+				`"request":"{\"seq\":42}","response":"{\"error\":{\"code\":400}}"}`,
+		},
+		{
+			name: "delete from another stream",
+			data: `{"id":"a5","subject":"$JS.API.STREAM.MSG.DELETE.payments",` +
+				`"request":"{\"seq\":42}","response":"{\"success\":true}"}`,
+		},
+		{
+			name:      "message delete through a domain",
+			apiPrefix: "$JS.hub.API.",
+			data: `{"id":"a7","timestamp":"2024-01-02T15:04:05Z","subject":"$JS.hub.API.STREAM.MSG.DELETE.orders",` +
+				`"request":"{\"seq\":42}","response":"{\"success\":true}"}`,
+			want: deleteAdvisory{
+				id:        "a7",
+				timestamp: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+				seq:       42,
+			},
+			wantOK: true,
+		},
+		{
+			name:      "purge mapped to the default api",
+			apiPrefix: "$JS.hub.API.",
+			data: `{"id":"a8","timestamp":"2024-01-02T15:04:05Z","subject":"$JS.API.STREAM.PURGE.orders",` +
+				`"response":"{\"success\":true,\"purged\":100}"}`,
+			want: deleteAdvisory{
+				id:        "a8",
+				timestamp: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+				purge:     true,
+				purged:    100,
+			},
+			wantOK: true,
+		},
+		{
+			name: "delete through another domain",
+			data: `{"id":"a9","subject":"$JS.leaf.API.STREAM.MSG.DELETE.orders",` +
+				`"request":"{\"seq\":42}","response":"{\"success\":true}"}`,
+		},
+		{
+			name: "another api call",
+			data: `{"id":"a6","subject":"$JS.API.STREAM.INFO.orders","response":"{}"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			got, ok, err := parseDeleteAdvisory(tt.apiPrefix, "orders", []byte(tt.data))
+			is.NoErr(err)
+			is.Equal(ok, tt.wantOK)
+			is.Equal(got, tt.want)
+		})
+	}
+
+	t.Run("invalid advisory", func(t *testing.T) {
+		is := is.New(t)
+
+		_, _, err := parseDeleteAdvisory("", "orders", []byte("{"))
+		is.True(err != nil)
+	})
+}
+
+func TestIterator_Next_deletes(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	i := &Iterator{
+		params: IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			AckPolicy:    nats.AckExplicitPolicy,
+			TrackDeletes: true,
+		},
+		stream:        "orders",
+		unackMessages: map[uint64]*nats.Msg{},
+		messages:      make(chan *nats.Msg, 1),
+		deletes:       make(chan deleteAdvisory, 2),
+	}
+
+	i.lastSeq.Store(7)
+
+	i.deletes <- deleteAdvisory{id: "a1", seq: 3}
+	i.deletes <- deleteAdvisory{id: "a2", purge: true, filter: "orders.eu", purged: 10}
+	is.True(i.HasNext(ctx))
+
+	// a message delete is keyed by the stream sequence
+	record, err := i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(record.Operation, opencdc.OperationDelete)
+	is.Equal(record.Key, opencdc.RawData("3"))
+	is.Equal(record.Metadata[internal.MetadataStream], "orders")
+
+	// the position doesn't move the resume point
+	pos, err := parsePosition(record.Position)
+	is.NoErr(err)
+	is.Equal(pos, position{OptSeq: 7, Advisory: "a1"})
+
+	// and isn't acknowledged
+	is.NoErr(i.Ack(context.Background(), record.Position))
+	is.NoErr(i.Nak(ctx, record.Position))
+
+	// a purge is described by the metadata
+	is.NoErr(i.WaitForNext(ctx))
+	record, err = i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(record.Operation, opencdc.OperationDelete)
+	is.Equal(record.Key, nil)
+	is.Equal(record.Metadata[internal.MetadataPurgeFilter], "orders.eu")
+	is.Equal(record.Metadata[internal.MetadataPurged], "10")
+
+	_, ok := i.nextDelete()
+	is.True(!ok)
+}
@@ -16,9 +16,15 @@ package source
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/conduitio/conduit-commons/opencdc"
@@ -28,11 +34,78 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
-// fetchSize is always 1 because conduit expects only one Record.
-const fetchSize = 1
+const (
+	// defaultFetchBatchSize is the default maximum number of messages a pull consumer requests at once.
+	defaultFetchBatchSize = 128
+	// defaultFetchMaxWait is the default maximum amount of time a pull consumer waits for a batch.
+	defaultFetchMaxWait = time.Second
+	// consumerCheckInterval is the interval of checking whether the consumer of an idle
+	// push consumer still exists, as its deletion isn't signaled to the subscription.
+	consumerCheckInterval = 30 * time.Second
+	// heartbeatTimeout is the default idle heartbeat interval of a push consumer.
+	heartbeatTimeout = 2 * time.Second
+	// serverAckWait is the default AckWait of the NATS server.
+	serverAckWait = 30 * time.Second
+	// lowMaxAckPending is the MaxAckPending below which delivery is likely
+	// to stall waiting for acknowledgements.
+	lowMaxAckPending = 256
+	// defaultBufferSize is the BufferSize used if it's not set.
+	defaultBufferSize = 512
+
+	// keySourceSubject takes the record key from the message subject.
+	keySourceSubject = "subject"
+	// keySourceSubjectTokenPrefix takes the record key from the token of the message subject
+	// at the zero-based index following the prefix.
+	keySourceSubjectTokenPrefix = "subject."
+	// keySourceHeaderPrefix takes the record key from the message header following the prefix.
+	keySourceHeaderPrefix = "header."
+)
+
+// ErrIteratorClosed is returned when the Iterator is used after it has been stopped.
+var ErrIteratorClosed = errors.New("iterator is closed")
+
+// ErrConsumerDeleted is returned when the consumer of the Iterator was deleted on the server.
+// The Iterator can't recover from it, so the connector has to be restarted.
+var ErrConsumerDeleted = errors.New("consumer was deleted")
+
+// ErrAckOutOfOrder is returned when a batch of acknowledgements isn't a contiguous prefix
+// of the pending messages, while the acknowledgements must be in the order of delivery.
+var ErrAckOutOfOrder = errors.New("acknowledgement out of order")
+
+// ErrStreamMismatch is returned when the Subject is captured by another stream than the Stream.
+var ErrStreamMismatch = errors.New("subject isn't captured by the stream")
+
+// ConsumerType defines how the Iterator receives messages from JetStream.
+type ConsumerType string
+
+const (
+	// ConsumerTypePull makes the Iterator explicitly fetch batches of messages.
+	ConsumerTypePull ConsumerType = "pull"
+	// ConsumerTypePush makes the server deliver messages to the DeliverSubject.
+	ConsumerTypePush ConsumerType = "push"
+)
+
+// AckMode defines the order in which the Iterator accepts acknowledgements.
+type AckMode string
+
+const (
+	// AckModeAny accepts acknowledgements of the pending messages in any order, e.g. when the records
+	// are processed in parallel.
+	AckModeAny AckMode = "any"
+	// AckModeFIFO accepts acknowledgements only in the order the messages were received, so an
+	// acknowledgement of a message before the older pending ones is rejected.
+	AckModeFIFO AckMode = "fifo"
+)
 
 type jetstreamSubscriber interface {
+	AddConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error)
+	DeleteConsumer(stream, consumer string, opts ...nats.JSOpt) error
+	ConsumerInfo(stream, name string, opts ...nats.JSOpt) (*nats.ConsumerInfo, error)
+	StreamInfo(stream string, opts ...nats.JSOpt) (*nats.StreamInfo, error)
+	AddStream(cfg *nats.StreamConfig, opts ...nats.JSOpt) (*nats.StreamInfo, error)
+	StreamNameBySubject(subj string, opts ...nats.JSOpt) (string, error)
 	PullSubscribe(subj, durable string, opts ...nats.SubOpt) (*nats.Subscription, error)
+	ChanSubscribe(subj string, ch chan *nats.Msg, opts ...nats.SubOpt) (*nats.Subscription, error)
 	UpdateConsumer(stream string, cfg *nats.ConsumerConfig, opts ...nats.JSOpt) (*nats.ConsumerInfo, error)
 }
 
@@ -46,10 +119,86 @@ type Iterator struct {
 	unackMessages map[uint64]*nats.Msg
 	subscription  *nats.Subscription
 	params        IteratorParams
+	// stream is the name of the stream the consumer belongs to.
+	stream string
+	// messages receives messages delivered to a push consumer.
+	messages chan *nats.Msg
+	// fetched holds messages fetched by a pull consumer, or received by WaitForNext
+	// from a push consumer, but not returned by Next yet.
+	fetched []*nats.Msg
+	// positionGap is the number of stream sequences missing after the stored position,
+	// it's reported by the first record returned by Next.
+	positionGap uint64
+	// lastSeq is the stream sequence of the last message returned by Next.
+	// It's read when the Iterator is re-created after a reconnect.
+	lastSeq atomic.Uint64
+	// deletes receives advisories of messages deleted from the stream if the TrackDeletes is set.
+	deletes             chan deleteAdvisory
+	deletesDone         chan struct{}
+	deletesSubscription *nats.Subscription
+	// pendingDeletes holds advisories received by WaitForNext, but not returned by Next yet.
+	pendingDeletes []deleteAdvisory
+	// closed is set once the Iterator is stopped or detached. It's guarded by the mu.
+	closed bool
+	// detached is closed once the Iterator is replaced after a reconnect, which releases WaitForNext.
+	detached chan struct{}
+	// readMu makes the detach wait for WaitForNext, Next and HasNext to return,
+	// as they run on another goroutine and own the received messages until then.
+	readMu sync.Mutex
+	// checkInterval is the interval of checking whether the consumer of a push consumer
+	// still exists while waiting for messages. If it's zero the consumer isn't checked.
+	checkInterval time.Duration
+
+	// counters reported by Stats
+	received    atomic.Uint64
+	produced    atomic.Uint64
+	redelivered atomic.Uint64
+	acked       atomic.Uint64
+	naked       atomic.Uint64
+	termed      atomic.Uint64
+	skipped     atomic.Uint64
+}
+
+// IteratorStats contains counters of the Iterator's activity since it was created.
+type IteratorStats struct {
+	// MessagesReceived is the number of messages received from the server.
+	MessagesReceived uint64
+	// RecordsProduced is the number of records returned by Next.
+	RecordsProduced uint64
+	// Redeliveries is the number of received messages which were delivered before.
+	Redeliveries uint64
+	// Acks is the number of acknowledged messages.
+	Acks uint64
+	// Naks is the number of negatively acknowledged messages.
+	Naks uint64
+	// Terms is the number of terminated messages.
+	Terms uint64
+	// Skipped is the number of received messages which didn't match the MatchSubject or the MatchHeader,
+	// or were older than the MaxMessageAge.
+	Skipped uint64
+	// Unacked is the number of messages currently awaiting an acknowledgement.
+	Unacked int
+}
+
+// ConsumerLag describes how far the consumer of the Iterator is behind the stream.
+type ConsumerLag struct {
+	// NumPending is the number of messages of the stream matching the consumer's subjects
+	// which weren't delivered yet.
+	NumPending uint64
+	// NumAckPending is the number of delivered messages awaiting an acknowledgement.
+	NumAckPending int
+	// DeliveredSeq is the stream sequence of the last delivered message.
+	DeliveredSeq uint64
+	// AckFloorSeq is the stream sequence up to which all the messages are acknowledged.
+	AckFloorSeq uint64
 }
 
 // IteratorParams contains incoming params for the NewIterator function.
 type IteratorParams struct {
+	// BufferSize is the capacity of the buffer holding the received messages until
+	// they are read. If it's zero the defaultBufferSize is used. Every buffered message
+	// is awaiting an acknowledgement, so a MaxAckPending lower than the BufferSize
+	// would stop the delivery before the buffer is full.
 	BufferSize     int
 	Stream         string
 	Durable        string
@@ -57,226 +206,1886 @@ type IteratorParams struct {
 	Subject        string
 	SDKPosition    opencdc.Position
 	DeliverPolicy  nats.DeliverPolicy
-	AckPolicy      nats.AckPolicy
+	// StartSeq is the stream sequence from which messages are delivered with the
+	// nats.DeliverByStartSequencePolicy. A stored position takes precedence over it.
+	StartSeq uint64
+	// StartTime is the time from which messages are delivered, if it's not zero.
+	// It requires the DeliverPolicy to be nats.DeliverByStartTimePolicy or nats.DeliverAllPolicy,
+	// and a stored position takes precedence over it.
+	StartTime time.Time
+	AckPolicy nats.AckPolicy
+	// AckSync makes the Iterator wait for the server to confirm acknowledgements.
+	AckSync bool
+	// AckMode defines the order in which acknowledgements are accepted. If it's empty AckModeFIFO is used.
+	AckMode AckMode
+	// ReplayPolicy is either "instant" or "original". If it's empty "instant" is used.
+	ReplayPolicy string
+	ConsumerType ConsumerType
+	// Ordered makes the Iterator use an ordered consumer, an ephemeral push consumer
+	// managed by the NATS client, which delivers messages in order and doesn't require
+	// acknowledgements. It overrides the ConsumerType and the AckPolicy.
+	Ordered bool
+	// Heartbeat is the idle heartbeat interval of a push consumer.
+	// If it's zero the heartbeatTimeout is used.
+	Heartbeat time.Duration
+	// AckWait is the duration the server waits for an acknowledgement
+	// before redelivering a message. If it's zero the server default is used.
+	AckWait time.Duration
+	// MaxDeliver is the maximum number of delivery attempts of a message.
+	// If it's zero the server default (unlimited) is used.
+	MaxDeliver int
+	// BackOff is a list of redelivery intervals, the last one is used for
+	// all the subsequent redeliveries.
+	BackOff []time.Duration
+	// RateLimit is the maximum delivery rate of a push consumer in bits per second.
+	// If it's zero the delivery isn't limited.
+	RateLimit uint64
+	// MaxAckPending is the maximum number of messages delivered, but not acknowledged yet.
+	// It must not be less than the BufferSize. If it's zero the server default (1000) is used.
+	MaxAckPending int
+	// FetchBatchSize is the maximum number of messages a pull consumer requests at once.
+	// If it's zero the defaultFetchBatchSize is used.
+	FetchBatchSize int
+	// FetchMaxWait is the maximum amount of time a pull consumer waits for a batch,
+	// after which the fetch ends with the messages received so far, if any.
+	// If it's zero the defaultFetchMaxWait is used.
+	FetchMaxWait time.Duration
+	// FilterSubjects are the subjects the consumer receives messages from instead of the Subject,
+	// which is then used only to look up the stream. They must be captured by the stream.
+	FilterSubjects []string
+	// MatchSubject is a subject, which may contain wildcards, the messages must match to become records.
+	// It's matched against the subject without the SubjectPrefix.
+	MatchSubject string
+	// MatchHeader is a header, either "<name>=<value>" or "<name>", the messages must have to become records.
+	MatchHeader string
+	// MaxMessageAge is the maximum age of the messages, based on their stream timestamp, to become records.
+	// If it's zero the age isn't checked.
+	MaxMessageAge time.Duration
+	// SubjectPrefix is the prefix the Subject and the FilterSubjects are prepended with.
+	// It's removed from the subjects records are created from, so they hold the logical subject.
+	SubjectPrefix string
+	// PropagateHeaders defines whether NATS message headers are copied into the record metadata.
+	PropagateHeaders bool
+	// EnableTracing makes the Iterator copy the trace context propagated in the message headers
+	// into the record metadata.
+	EnableTracing bool
+	// SourcePositionMetadata defines whether the internal.SourcePositionHeader is copied
+	// into the internal.MetadataSourcePosition record metadata field.
+	SourcePositionMetadata bool
+	// BeforeHeader defines whether messages with the internal.BeforeHeader become update records
+	// with the decoded header as the payload before the change.
+	BeforeHeader bool
+	// KeySource defines where the record key is taken from. It's either "subject",
+	// "subject.<index>" or "header.<name>". If it's empty records have no key.
+	KeySource string
+	// LegacyRecordFormat omits the collection and the stream from the record metadata.
+	LegacyRecordFormat bool
+	// PayloadEncoding is the encoding of message payloads, which are decoded before records are created.
+	PayloadEncoding string
+	// TrackDeletes makes the Iterator produce delete records for messages deleted from the stream
+	// and for purges of the stream, based on the JetStream API audit advisories.
+	TrackDeletes bool
+	// APIPrefix is the prefix of the JetStream API subjects the deletes tracked by the TrackDeletes
+	// are called on, e.g. the one of the JetStream domain. If it's empty the default one is used.
+	APIPrefix string
+	// BindOnly makes the Iterator bind to an existing consumer named Durable without creating,
+	// updating or deleting it. The consumer's config, including its start position, is used as is.
+	BindOnly bool
+	// HeadersOnly makes the consumer deliver only the message headers, without the payload.
+	// Records are created from the headers and have an empty payload.
+	HeadersOnly bool
+	// DeleteConsumerOnStop defines whether the consumer is deleted when the Iterator stops.
+	DeleteConsumerOnStop bool
+	// ResetOnStart makes the Iterator delete an existing consumer named Durable and re-create it,
+	// so all the messages of the stream are redelivered. The SDKPosition, the DeliverPolicy,
+	// the StartSeq and the StartTime are ignored. It can't be combined with the BindOnly.
+	ResetOnStart bool
+	// AutoCreateStream makes the Iterator create the Stream if no stream captures the Subject.
+	AutoCreateStream bool
+	// StreamSubjects are the subjects captured by the auto-created stream in addition to the Subject.
+	StreamSubjects []string
+	// StreamRetention is the retention policy of the auto-created stream.
+	StreamRetention nats.RetentionPolicy
+	// StreamStorage is the storage type of the auto-created stream.
+	StreamStorage nats.StorageType
+	// StreamMaxAge is the maximum age of messages in the auto-created stream.
+	StreamMaxAge time.Duration
+	// StreamDuplicateWindow is the deduplication window of the auto-created stream.
+	StreamDuplicateWindow time.Duration
+	// StreamMaxMsgsPerSubject is the maximum number of messages per subject kept by the auto-created stream.
+	// If it's zero the number isn't limited.
+	StreamMaxMsgsPerSubject int64
+	// StreamMaxBytes is the maximum size in bytes of the auto-created stream.
+	// If it's zero the size isn't limited.
+	StreamMaxBytes int64
+	// Streams are the streams consumed by a MultiIterator instead of the Stream, the Subject
+	// and the Durable, which the other params apply to. NewIterator doesn't accept them.
+	Streams []StreamParams
 }
 
-// getSubscriberOpts returns a NATS subscribe options based on the IteratorParams's fields.
-func (p IteratorParams) getSubscriberOpts(ctx context.Context) ([]nats.SubOpt, error) {
-	var opts []nats.SubOpt
+// getStreamConfig returns a NATS stream config of the auto-created stream
+// based on the IteratorParams's fields.
+func (p IteratorParams) getStreamConfig() *nats.StreamConfig {
+	subjects := []string{p.Subject}
+	for _, subject := range p.StreamSubjects {
+		if !slices.Contains(subjects, subject) {
+			subjects = append(subjects, subject)
+		}
+	}
+
+	return &nats.StreamConfig{
+		Name:              p.Stream,
+		Subjects:          subjects,
+		Retention:         p.StreamRetention,
+		Storage:           p.StreamStorage,
+		MaxAge:            p.StreamMaxAge,
+		Duplicates:        p.StreamDuplicateWindow,
+		MaxMsgsPerSubject: p.StreamMaxMsgsPerSubject,
+		MaxBytes:          p.StreamMaxBytes,
+	}
+}
 
+// getConsumerConfig returns a NATS consumer config based on the IteratorParams's fields.
+func (p IteratorParams) getConsumerConfig() (*nats.ConsumerConfig, error) {
 	position, err := parsePosition(p.SDKPosition)
 	if err != nil {
 		return nil, fmt.Errorf("parse position: %w", err)
 	}
 
+	replayPolicy, err := p.getReplayPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	consumerConfig := &nats.ConsumerConfig{
+		Durable:       p.Durable,
+		DeliverPolicy: p.DeliverPolicy,
+		AckPolicy:     p.AckPolicy,
+		ReplayPolicy:  replayPolicy,
+		FilterSubject: p.Subject,
+		AckWait:       p.AckWait,
+		HeadersOnly:   p.HeadersOnly,
+	}
+
+	// a consumer can have either a single filter subject or multiple ones
+	if len(p.FilterSubjects) > 0 {
+		consumerConfig.FilterSubject = ""
+		consumerConfig.FilterSubjects = p.FilterSubjects
+	}
+
+	if p.AckWait < 0 {
+		return nil, fmt.Errorf("ack wait %s can't be negative", p.AckWait)
+	}
+
+	if p.DeliverPolicy == nats.DeliverLastPerSubjectPolicy && !hasWildcard(p.Subject) {
+		return nil, fmt.Errorf("deliver policy last-per-subject requires a wildcard subject, got %q", p.Subject)
+	}
+
+	consumerConfig.MaxDeliver, consumerConfig.BackOff, err = p.getRedelivery()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.MaxAckPending != 0 && p.AckPolicy != nats.AckNonePolicy {
+		if p.MaxAckPending < p.BufferSize {
+			return nil, fmt.Errorf("max ack pending %d can't be less than the buffer size %d",
+				p.MaxAckPending, p.BufferSize)
+		}
+
+		consumerConfig.MaxAckPending = p.MaxAckPending
+	}
+
+	switch {
+	case p.DeliverPolicy == nats.DeliverByStartSequencePolicy:
+		if p.StartSeq == 0 {
+			return nil, errors.New("deliver policy by-start-sequence requires a start sequence")
+		}
+
+		consumerConfig.OptStartSeq = p.StartSeq
+	case p.DeliverPolicy == nats.DeliverByStartTimePolicy && p.StartTime.IsZero():
+		return nil, errors.New("deliver policy by-start-time requires a start time")
+	}
+
+	if !p.StartTime.IsZero() {
+		if p.DeliverPolicy != nats.DeliverAllPolicy && p.DeliverPolicy != nats.DeliverByStartTimePolicy {
+			return nil, errors.New("start time can only be combined with the deliver policy all or by-start-time, " +
+				"the precedence is: stored position, start time, deliver policy")
+		}
+
+		consumerConfig.DeliverPolicy = nats.DeliverByStartTimePolicy
+		consumerConfig.OptStartTime = &p.StartTime
+	}
+
 	// if the position has a non-zero OptSeq
-	// the connector will start consuming from that position
+	// the connector will start consuming from that position,
+	// which takes precedence over the start time and the deliver policy
 	if position.OptSeq != 0 {
 		// add 1 to the sequence in order to skip the consumed message at this position
 		// and start consuming new messages
-		// deliverPolicy in this case will become a DeliverByStartSequencePolicy.
-		opts = append(opts, nats.StartSequence(position.OptSeq+1))
-	} else {
-		switch p.DeliverPolicy {
-		case nats.DeliverAllPolicy:
-			opts = append(opts, nats.DeliverAll())
-		case nats.DeliverNewPolicy:
-			opts = append(opts, nats.DeliverNew())
+		consumerConfig.DeliverPolicy = nats.DeliverByStartSequencePolicy
+		consumerConfig.OptStartSeq = position.OptSeq + 1
+		consumerConfig.OptStartTime = nil
+	}
+
+	switch p.ConsumerType {
+	case ConsumerTypePush:
+		consumerConfig.DeliverSubject = p.DeliverSubject
+		consumerConfig.RateLimit = p.RateLimit
+		consumerConfig.FlowControl = true
+		consumerConfig.Heartbeat, err = p.getHeartbeat()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		// the server controls the delivery rate only when it pushes messages
+		if p.RateLimit != 0 {
+			return nil, errors.New(
+				"rate limit requires the push consumer type, pull consumers control the rate by fetching",
+			)
+		}
+
+		consumerConfig.MaxWaiting = p.BufferSize
+	}
+
+	return consumerConfig, nil
+}
+
+// hasWildcard checks if the subject contains a wildcard token.
+func hasWildcard(subject string) bool {
+	for _, token := range strings.Split(subject, ".") {
+		if token == "*" || token == ">" {
+			return true
 		}
 	}
 
-	switch p.AckPolicy {
-	case nats.AckAllPolicy:
-		opts = append(opts, nats.AckAll())
-	case nats.AckExplicitPolicy:
-		opts = append(opts, nats.AckExplicit())
-	case nats.AckNonePolicy:
-		opts = append(opts, nats.AckNone())
+	return false
+}
+
+// matchesFilter reports whether the concrete subject is matched by the FilterSubjects,
+// or by the Subject if there are no FilterSubjects.
+func (p IteratorParams) matchesFilter(subject string) bool {
+	filters := p.FilterSubjects
+	if len(filters) == 0 {
+		filters = []string{p.Subject}
 	}
 
-	opts = append(opts,
-		nats.Context(ctx),
-		nats.PullMaxWaiting(p.BufferSize),
-	)
+	return slices.ContainsFunc(filters, func(filter string) bool {
+		return subjectIsSubset(subject, filter)
+	})
+}
 
-	return opts, nil
+// matchesMessage reports whether the message matches the MatchSubject and the MatchHeader,
+// and isn't older than the MaxMessageAge.
+func (p IteratorParams) matchesMessage(msg *nats.Msg) bool {
+	subject := internal.TrimSubjectPrefix(p.SubjectPrefix, msg.Subject)
+	if p.MatchSubject != "" && !subjectIsSubset(subject, p.MatchSubject) {
+		return false
+	}
+
+	if p.MatchHeader != "" {
+		name, value, hasValue := strings.Cut(p.MatchHeader, "=")
+
+		values := msg.Header.Values(name)
+		if len(values) == 0 || (hasValue && !slices.Contains(values, value)) {
+			return false
+		}
+	}
+
+	if p.MaxMessageAge > 0 {
+		// messages without metadata aren't JetStream messages, so their age is unknown
+		metadata, err := msg.Metadata()
+		if err == nil && time.Since(metadata.Timestamp) > p.MaxMessageAge {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getReplayPolicy returns the replay policy of a consumer.
+func (p IteratorParams) getReplayPolicy() (nats.ReplayPolicy, error) {
+	switch p.ReplayPolicy {
+	case "instant", "":
+		return nats.ReplayInstantPolicy, nil
+	case "original":
+		return nats.ReplayOriginalPolicy, nil
+	default:
+		return 0, fmt.Errorf("invalid replay policy %q", p.ReplayPolicy)
+	}
+}
+
+// getRedelivery returns the max deliver and the back off of a consumer.
+// The back off can't contain more intervals than the number of delivery attempts.
+func (p IteratorParams) getRedelivery() (int, []time.Duration, error) {
+	if p.MaxDeliver < 0 {
+		return 0, nil, fmt.Errorf("max deliver %d can't be negative", p.MaxDeliver)
+	}
+
+	if len(p.BackOff) > 0 && p.MaxDeliver == 0 {
+		return 0, nil, errors.New("back off requires max deliver to be set")
+	}
+
+	if len(p.BackOff) > p.MaxDeliver {
+		return 0, nil, fmt.Errorf("back off contains %d intervals, but max deliver is %d, "+
+			"the number of intervals can't exceed the max deliver", len(p.BackOff), p.MaxDeliver)
+	}
+
+	for _, interval := range p.BackOff {
+		if interval <= 0 {
+			return 0, nil, fmt.Errorf("back off interval %s must be positive", interval)
+		}
+	}
+
+	return p.MaxDeliver, p.BackOff, nil
+}
+
+// getHeartbeat returns the idle heartbeat interval of a push consumer.
+// The heartbeat must be shorter than the AckWait, otherwise the flow control
+// would be disrupted by redeliveries.
+func (p IteratorParams) getHeartbeat() (time.Duration, error) {
+	ackWait := p.AckWait
+	if ackWait == 0 {
+		ackWait = serverAckWait
+	}
+
+	switch {
+	case p.Heartbeat < 0:
+		return 0, fmt.Errorf("heartbeat %s can't be negative", p.Heartbeat)
+	case p.Heartbeat == 0:
+		return heartbeatTimeout, nil
+	case p.Heartbeat >= ackWait:
+		return 0, fmt.Errorf("heartbeat %s must be less than the ack wait %s", p.Heartbeat, ackWait)
+	default:
+		return p.Heartbeat, nil
+	}
+}
+
+// withDefaults validates the IteratorParams's fields which don't depend on the server
+// and returns the params with the defaults applied.
+func (p IteratorParams) withDefaults() (IteratorParams, error) {
+	if len(p.Streams) > 0 {
+		return p, errors.New("multiple streams must be consumed by a MultiIterator")
+	}
+
+	for _, subject := range slices.Concat([]string{p.Subject}, p.FilterSubjects, p.StreamSubjects) {
+		if err := internal.ValidateSubject(subject, true); err != nil {
+			return p, err
+		}
+	}
+
+	switch {
+	case p.BufferSize < 0:
+		return p, fmt.Errorf("buffer size %d can't be negative", p.BufferSize)
+	case p.BufferSize == 0:
+		// an unbuffered channel would block the delivery of every single message
+		p.BufferSize = defaultBufferSize
+	}
+
+	switch {
+	case p.FetchBatchSize < 0:
+		return p, fmt.Errorf("fetch batch size %d can't be negative", p.FetchBatchSize)
+	case p.FetchBatchSize == 0:
+		p.FetchBatchSize = defaultFetchBatchSize
+	}
+
+	switch {
+	case p.FetchMaxWait < 0:
+		return p, fmt.Errorf("fetch max wait %s can't be negative", p.FetchMaxWait)
+	case p.FetchMaxWait == 0:
+		p.FetchMaxWait = defaultFetchMaxWait
+	}
+
+	if p.AckMode == "" {
+		p.AckMode = AckModeFIFO
+	}
+
+	if p.ResetOnStart {
+		if p.BindOnly {
+			return p, errors.New("reset on start can't be combined with bind only")
+		}
+
+		// the consumer is re-created from the start of the stream
+		p.SDKPosition = nil
+		p.DeliverPolicy = nats.DeliverAllPolicy
+		p.StartSeq = 0
+		p.StartTime = time.Time{}
+	}
+
+	if p.Ordered {
+		// ordered consumers are push consumers which don't accept acknowledgements
+		p.ConsumerType = ConsumerTypePush
+		p.AckPolicy = nats.AckNonePolicy
+	}
+
+	return p, nil
 }
 
 // NewIterator creates new instance of the Iterator.
 func NewIterator(ctx context.Context, nc internal.NATSClient, params IteratorParams) (*Iterator, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
 	i := &Iterator{
-		mu:     sync.RWMutex{},
-		params: params,
-		nc:     nc,
+		mu:       sync.RWMutex{},
+		params:   params,
+		nc:       nc,
+		detached: make(chan struct{}),
+	}
+
+	// ordered consumers are re-created by the NATS client on its own
+	if !params.Ordered {
+		i.checkInterval = consumerCheckInterval
 	}
 
-	var err error
 	i.unackMessages = make(map[uint64]*nats.Msg, i.params.BufferSize)
 	i.jetstream, err = nc.JetStream()
 	if err != nil {
 		return nil, fmt.Errorf("get jetstream context: %w", err)
 	}
 
-	subscriberOpts, err := i.params.getSubscriberOpts(ctx)
+	consumerConfig, err := i.params.getConsumerConfig()
 	if err != nil {
-		return nil, fmt.Errorf("get consumer options: %w", err)
+		return nil, fmt.Errorf("get consumer config: %w", err)
 	}
 
-	i.subscription, err = i.jetstream.PullSubscribe(i.params.Subject, i.params.Durable, subscriberOpts...)
-	if err != nil || i.subscription == nil {
-		return nil, fmt.Errorf("pull subscribe: %w", err)
+	// the position is checked when the consumer config is created
+	position, _ := parsePosition(i.params.SDKPosition)
+	i.lastSeq.Store(position.OptSeq)
+	if position.Subject != "" && !i.params.matchesFilter(position.Subject) {
+		sdk.Logger(ctx).Warn().
+			Str("position_subject", position.Subject).
+			Msg("the position was recorded for a subject which doesn't match the configured subjects, " +
+				"messages of the matching subjects published before the position are skipped")
 	}
 
-	return i, nil
-}
-
-// HasNext checks is the iterator has messages.
-func (i *Iterator) HasNext(ctx context.Context) bool {
-	if !i.nc.IsConnected() && !i.subscription.IsValid() {
-		return false
+	if consumerConfig.MaxAckPending != 0 && consumerConfig.MaxAckPending < lowMaxAckPending {
+		sdk.Logger(ctx).Warn().
+			Int("max_ack_pending", consumerConfig.MaxAckPending).
+			Msg("max ack pending is very low, delivery may stall waiting for acknowledgements")
 	}
 
-	ci, err := i.subscription.ConsumerInfo()
+	i.stream, err = i.jetstream.StreamNameBySubject(i.params.Subject, nats.Context(ctx))
+	if errors.Is(err, nats.ErrNoMatchingStream) && i.params.AutoCreateStream {
+		i.stream, err = i.createStream(ctx)
+	}
 	if err != nil {
-		sdk.Logger(ctx).
-			Error().
-			Err(err).
-			Interface("consumer_info", ci).
-			Send()
+		return nil, fmt.Errorf("get stream name by subject %q: %w", i.params.Subject, err)
+	}
 
-		return false
+	if err = i.checkStream(); err != nil {
+		return nil, err
 	}
 
-	return ci.NumPending > 0
-}
+	// the config of a bound consumer, including its start, is used as is
+	if position.OptSeq != 0 && !i.params.BindOnly {
+		i.checkPositionGap(ctx, position.OptSeq)
+	}
 
-// Next returns the next record from the underlying messages channel.
-// It also appends messages to a unackMessages slice if the AckPolicy is not equal to AckNonePolicy.
-func (i *Iterator) Next(ctx context.Context) (opencdc.Record, error) {
-	select {
-	case <-ctx.Done():
-		return opencdc.Record{}, ctx.Err()
-	default:
-		msgs, err := i.subscription.Fetch(fetchSize, nats.Context(ctx))
-		if err != nil {
-			return opencdc.Record{}, sdk.ErrBackoffRetry
+	if len(i.params.FilterSubjects) > 0 {
+		if err = i.validateFilterSubjects(ctx); err != nil {
+			return nil, err
 		}
+	}
 
-		if len(msgs) != fetchSize {
-			return opencdc.Record{}, sdk.ErrBackoffRetry
+	if i.params.TrackDeletes {
+		if err = i.subscribeDeletes(ctx); err != nil {
+			return nil, err
 		}
-		msg := msgs[0]
+	}
 
-		sdkRecord, err := i.messageToRecord(msg)
-		if err != nil {
-			return opencdc.Record{},
-				errors.Join(
-					opencdc.ErrMetadataFieldNotFound,
-					fmt.Errorf("convert message to record: %w", err),
-				)
+	if i.params.Ordered {
+		if err = i.subscribeOrdered(consumerConfig); err != nil {
+			return nil, err
 		}
 
-		position, err := parsePosition(sdkRecord.Position)
-		if err != nil {
-			return opencdc.Record{}, fmt.Errorf("convert record to position: %w", err)
-		}
+		return i, nil
+	}
 
-		if i.params.AckPolicy != nats.AckNonePolicy {
-			i.mu.Lock()
-			i.unackMessages[position.OptSeq] = msg
-			i.mu.Unlock()
-		}
+	if i.params.BindOnly {
+		err = i.checkConsumer(ctx)
+	} else {
+		err = i.ensureConsumer(ctx, consumerConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		return sdkRecord, nil
+	bindOpt := nats.Bind(i.stream, i.params.Durable)
+
+	switch i.params.ConsumerType {
+	case ConsumerTypePush:
+		i.messages = make(chan *nats.Msg, i.params.BufferSize)
+		i.subscription, err = i.jetstream.ChanSubscribe(i.params.Subject, i.messages, bindOpt)
+		if err != nil || i.subscription == nil {
+			return nil, fmt.Errorf("chan subscribe: %w", err)
+		}
+	default:
+		i.subscription, err = i.jetstream.PullSubscribe(i.params.Subject, i.params.Durable, bindOpt)
+		if err != nil || i.subscription == nil {
+			return nil, fmt.Errorf("pull subscribe: %w", err)
+		}
 	}
+
+	return i, nil
 }
 
-// Ack acknowledges a message at the given position.
-func (i *Iterator) Ack(sdkPosition opencdc.Position) error {
-	// if ack policy is 'none' just return nil here
-	if i.params.AckPolicy == nats.AckNonePolicy {
+// ValidateIterator checks that an Iterator can be created from the params without creating
+// anything on the server: the stream capturing the Subject must exist, unless it's auto-created,
+// the Subject and the FilterSubjects must be captured by it entirely, and an existing consumer
+// named Durable must be compatible with the requested config.
+func ValidateIterator(ctx context.Context, nc internal.NATSClient, params IteratorParams) error {
+	for _, stream := range params.Streams {
+		if err := ValidateIterator(ctx, nc, params.streamParams(stream, nil)); err != nil {
+			return fmt.Errorf("stream %q: %w", stream.Stream, err)
+		}
+	}
+
+	if len(params.Streams) > 0 {
 		return nil
 	}
 
-	i.mu.Lock()
-	defer i.mu.Unlock()
+	params, err := params.withDefaults()
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
 
-	position, err := parsePosition(sdkPosition)
+	consumerConfig, err := params.getConsumerConfig()
 	if err != nil {
-		return fmt.Errorf("could not find record at position: %w", err)
+		return fmt.Errorf("validate: get consumer config: %w", err)
 	}
 
-	msg, ok := i.unackMessages[position.OptSeq]
-	if !ok {
-		return fmt.Errorf("could not find message at position: %d not avaiable to ack", position)
+	i := &Iterator{params: params, nc: nc}
+	i.jetstream, err = nc.JetStream()
+	if err != nil {
+		return fmt.Errorf("validate: get jetstream context: %w", err)
 	}
 
-	if err := msg.Ack(); err != nil {
-		return fmt.Errorf("ack message: %w", err)
+	i.stream, err = i.jetstream.StreamNameBySubject(params.Subject, nats.Context(ctx))
+	switch {
+	case errors.Is(err, nats.ErrNoMatchingStream) && params.AutoCreateStream:
+		return i.validateAutoCreatedStream(ctx)
+	case errors.Is(err, nats.ErrNoMatchingStream):
+		return fmt.Errorf("validate: no stream captures the subject %q, "+
+			"create the stream or enable auto-creating it: %w", params.Subject, err)
+	case err != nil:
+		return fmt.Errorf("validate: get stream name by subject %q: %w", params.Subject, err)
 	}
 
-	// remove acknowledged message from the slice
-	delete(i.unackMessages, position.OptSeq)
+	if err := i.checkStream(); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
 
-	return nil
-}
+	info, err := i.jetstream.StreamInfo(i.stream, nats.Context(ctx))
+	if err != nil {
+		return fmt.Errorf("validate: get stream info of %q: %w", i.stream, err)
+	}
 
-func (i *Iterator) unAckAll() error {
-	// explicity not acking unackedMessages
-	for _, msg := range i.unackMessages {
-		if err := msg.Nak(); err != nil {
-			return fmt.Errorf("not ack (when stopping): %w", err)
+	// the stream only has to overlap the subject to be found by it
+	for _, subject := range slices.Concat([]string{params.Subject}, params.FilterSubjects) {
+		if !slices.ContainsFunc(info.Config.Subjects, func(pattern string) bool {
+			return subjectIsSubset(subject, pattern)
+		}) {
+			return fmt.Errorf("validate: subject %q is only partially captured by the stream %q with the subjects %q",
+				subject, i.stream, info.Config.Subjects)
+		}
+	}
+
+	// ordered consumers are ephemeral and created by the NATS client
+	if params.Ordered {
+		return nil
+	}
+
+	if params.BindOnly {
+		if err := i.checkConsumer(ctx); err != nil {
+			return fmt.Errorf("validate: %w", err)
 		}
+
+		return nil
+	}
+
+	existing, err := i.jetstream.ConsumerInfo(i.stream, params.Durable, nats.Context(ctx))
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+		return nil
+	case err != nil:
+		return fmt.Errorf("validate: get consumer info: %w", err)
+	case params.ResetOnStart:
+		// the existing consumer is re-created anyway
+		return nil
+	}
+
+	if diff := consumerConfigDiff(existing.Config, *consumerConfig); len(diff) > 0 {
+		return fmt.Errorf("validate: consumer %q already exists with a different config, mismatched fields: %s, "+
+			"delete the consumer or use another durable name", params.Durable, strings.Join(diff, ", "))
 	}
 
 	return nil
 }
 
-// Stop stops the Iterator, unsubscribes from a subject.
-func (i *Iterator) Stop() (err error) {
-	if i.subscription != nil {
-		// it will delete a consumer belonged to the subscription as well
-		if err = i.subscription.Unsubscribe(); err != nil {
-			return fmt.Errorf("unsubscribe: %w", err)
-		}
+// checkStream checks that the stream capturing the Subject is the Stream, if it's set,
+// so the Streams sharing a Subject don't consume the same stream.
+func (i *Iterator) checkStream() error {
+	if i.params.Stream != "" && i.stream != i.params.Stream {
+		return fmt.Errorf("subject %q is captured by the stream %q instead of the stream %q: %w",
+			i.params.Subject, i.stream, i.params.Stream, ErrStreamMismatch)
 	}
 
-	// explicity not acking unackedMessages
-	if err := i.unAckAll(); err != nil {
-		return fmt.Errorf("not ack (when stopping): %w", err)
+	return nil
+}
+
+// validateAutoCreatedStream checks that the stream to be auto-created doesn't exist already,
+// as an existing stream which doesn't capture the subject is not modified.
+func (i *Iterator) validateAutoCreatedStream(ctx context.Context) error {
+	_, err := i.jetstream.StreamInfo(i.params.Stream, nats.Context(ctx))
+	switch {
+	case err == nil:
+		return fmt.Errorf("validate: stream %q exists, but doesn't capture the subject %q",
+			i.params.Stream, i.params.Subject)
+	case !errors.Is(err, nats.ErrStreamNotFound):
+		return fmt.Errorf("validate: get stream info of %q: %w", i.params.Stream, err)
 	}
 
 	return nil
 }
 
-// messageToRecord converts a *nats.Msg to a opencdc.Record.
-func (i *Iterator) messageToRecord(msg *nats.Msg) (opencdc.Record, error) {
-	// retrieve a message metadata one more time to grab a metadata.Timestamp
-	// and use it for a opencdc.Record.Metadata
-	metadata, err := msg.Metadata()
+// checkPositionGap checks whether the messages following the stored position at the seq
+// are still in the stream. If some of them were removed, the consumer silently starts
+// at the first message of the stream, so the gap is logged and reported by the first record.
+func (i *Iterator) checkPositionGap(ctx context.Context, seq uint64) {
+	info, err := i.jetstream.StreamInfo(i.stream, nats.Context(ctx))
 	if err != nil {
-		return opencdc.Record{}, fmt.Errorf("get message metadata: %w", err)
+		sdk.Logger(ctx).Warn().Err(err).Msg("failed to check whether the messages after the position are in the stream")
+
+		return
 	}
 
-	position, err := i.getMessagePosition(metadata)
-	if err != nil {
-		return opencdc.Record{}, fmt.Errorf("get position: %w", err)
+	if info.State.FirstSeq <= seq+1 {
+		return
 	}
 
-	if metadata.Timestamp.IsZero() {
-		metadata.Timestamp = time.Now()
+	i.positionGap = info.State.FirstSeq - seq - 1
+
+	sdk.Logger(ctx).Warn().
+		Uint64("position_seq", seq).
+		Uint64("first_seq", info.State.FirstSeq).
+		Uint64("missing", i.positionGap).
+		Msg("the messages following the position were removed from the stream, " +
+			"e.g. because they expired or the stream was purged, reading continues at the first message of the stream")
+}
+
+// subscribeOrdered subscribes to the subject using an ordered consumer.
+// The consumer is created by the NATS client, which recreates it starting after
+// the last delivered message whenever it detects a gap or a missed heartbeat.
+func (i *Iterator) subscribeOrdered(consumerConfig *nats.ConsumerConfig) error {
+	if consumerConfig.MaxDeliver != 0 {
+		return errors.New("ordered consumer can't have max deliver")
 	}
 
-	sdkMetadata := make(opencdc.Metadata)
-	sdkMetadata.SetCreatedAt(metadata.Timestamp)
+	opts := []nats.SubOpt{
+		nats.OrderedConsumer(),
+		nats.BindStream(i.stream),
+	}
+
+	switch consumerConfig.DeliverPolicy {
+	case nats.DeliverNewPolicy:
+		opts = append(opts, nats.DeliverNew())
+	case nats.DeliverLastPolicy:
+		opts = append(opts, nats.DeliverLast())
+	case nats.DeliverLastPerSubjectPolicy:
+		opts = append(opts, nats.DeliverLastPerSubject())
+	case nats.DeliverByStartSequencePolicy:
+		opts = append(opts, nats.StartSequence(consumerConfig.OptStartSeq))
+	case nats.DeliverByStartTimePolicy:
+		opts = append(opts, nats.StartTime(*consumerConfig.OptStartTime))
+	default:
+		opts = append(opts, nats.DeliverAll())
+	}
+
+	if consumerConfig.ReplayPolicy == nats.ReplayOriginalPolicy {
+		opts = append(opts, nats.ReplayOriginal())
+	}
+
+	if len(consumerConfig.FilterSubjects) > 0 {
+		opts = append(opts, nats.ConsumerFilterSubjects(consumerConfig.FilterSubjects...))
+	}
+
+	if consumerConfig.Heartbeat != 0 {
+		opts = append(opts, nats.IdleHeartbeat(consumerConfig.Heartbeat))
+	}
+
+	if consumerConfig.RateLimit != 0 {
+		opts = append(opts, nats.RateLimit(consumerConfig.RateLimit))
+	}
+
+	if consumerConfig.HeadersOnly {
+		opts = append(opts, nats.HeadersOnly())
+	}
+
+	var err error
+	i.messages = make(chan *nats.Msg, i.params.BufferSize)
+	i.subscription, err = i.jetstream.ChanSubscribe(i.params.Subject, i.messages, opts...)
+	if err != nil || i.subscription == nil {
+		return fmt.Errorf("chan subscribe ordered: %w", err)
+	}
+
+	return nil
+}
+
+// validateFilterSubjects makes sure each of the filter subjects is captured by the stream.
+func (i *Iterator) validateFilterSubjects(ctx context.Context) error {
+	info, err := i.jetstream.StreamInfo(i.stream, nats.Context(ctx))
+	if err != nil {
+		return fmt.Errorf("get stream info: %w", err)
+	}
+
+	for _, filter := range i.params.FilterSubjects {
+		if !slices.ContainsFunc(info.Config.Subjects, func(subject string) bool {
+			return subjectIsSubset(filter, subject)
+		}) {
+			return fmt.Errorf("filter subject %q is not captured by the stream %q", filter, i.stream)
+		}
+	}
+
+	return nil
+}
+
+// subjectIsSubset checks if all the subjects matched by the subject are matched by the pattern as well.
+func subjectIsSubset(subject, pattern string) bool {
+	subjectTokens := strings.Split(subject, ".")
+	patternTokens := strings.Split(pattern, ".")
+
+	for n, patternToken := range patternTokens {
+		if n >= len(subjectTokens) {
+			return false
+		}
+
+		switch patternToken {
+		case ">":
+			return true
+		case "*":
+			if subjectTokens[n] == ">" {
+				return false
+			}
+		default:
+			if subjectTokens[n] != patternToken {
+				return false
+			}
+		}
+	}
+
+	return len(subjectTokens) == len(patternTokens)
+}
+
+// createStream creates the stream if it doesn't exist and returns its name.
+// An existing stream which doesn't capture the subject is not modified.
+func (i *Iterator) createStream(ctx context.Context) (string, error) {
+	_, err := i.jetstream.StreamInfo(i.params.Stream, nats.Context(ctx))
+	switch {
+	case err == nil:
+		return "", fmt.Errorf("stream %q exists, but doesn't capture the subject: %w",
+			i.params.Stream, nats.ErrNoMatchingStream)
+	case !errors.Is(err, nats.ErrStreamNotFound):
+		return "", fmt.Errorf("get stream info: %w", err)
+	}
+
+	info, err := i.jetstream.AddStream(i.params.getStreamConfig(), nats.Context(ctx))
+	if err != nil {
+		return "", fmt.Errorf("add stream: %w", err)
+	}
+
+	sdk.Logger(ctx).Info().
+		Str("stream", info.Config.Name).
+		Strs("subjects", info.Config.Subjects).
+		Msg("created stream")
+
+	return info.Config.Name, nil
+}
+
+// ensureConsumer reuses the consumer if it already exists and creates it otherwise.
+// An existing consumer must match the requested config, except for the start position,
+// which only matters when a consumer is created.
+func (i *Iterator) ensureConsumer(ctx context.Context, consumerConfig *nats.ConsumerConfig) error {
+	info, err := i.jetstream.ConsumerInfo(i.stream, consumerConfig.Durable, nats.Context(ctx))
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+		return i.addConsumer(ctx, consumerConfig)
+	case err != nil:
+		return fmt.Errorf("get consumer info: %w", err)
+	}
+
+	if i.params.ResetOnStart {
+		err = i.jetstream.DeleteConsumer(i.stream, consumerConfig.Durable, nats.Context(ctx))
+		if err != nil && !errors.Is(err, nats.ErrConsumerNotFound) {
+			return fmt.Errorf("delete consumer: %w", err)
+		}
+
+		sdk.Logger(ctx).Info().
+			Str("consumer", consumerConfig.Durable).
+			Msg("the consumer was deleted to redeliver all the messages of the stream")
+
+		return i.addConsumer(ctx, consumerConfig)
+	}
+
+	if diff := consumerConfigDiff(info.Config, *consumerConfig); len(diff) > 0 {
+		return fmt.Errorf("consumer %q already exists with a different config, mismatched fields: %s",
+			consumerConfig.Durable, strings.Join(diff, ", "))
+	}
+
+	return nil
+}
+
+// addConsumer creates the consumer on the server.
+func (i *Iterator) addConsumer(ctx context.Context, consumerConfig *nats.ConsumerConfig) error {
+	if _, err := i.jetstream.AddConsumer(i.stream, consumerConfig, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("add consumer: %w", err)
+	}
+
+	return nil
+}
+
+// consumerExists reports whether the consumer of the Iterator still exists on the server.
+// Ordered consumers are managed by the NATS client, so they're always reported as existing.
+func (i *Iterator) consumerExists(ctx context.Context) (bool, error) {
+	if i.params.Ordered {
+		return true, nil
+	}
+
+	_, err := i.jetstream.ConsumerInfo(i.stream, i.params.Durable, nats.Context(ctx))
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("get consumer info: %w", err)
+	}
+
+	return true, nil
+}
+
+// checkDeleted returns ErrConsumerDeleted if the consumer doesn't exist on the server anymore.
+// A failure to check it is only logged, as it's usually caused by a lost connection,
+// which the NATS client recovers from on its own.
+func (i *Iterator) checkDeleted(ctx context.Context) error {
+	exists, err := i.consumerExists(ctx)
+	if err != nil {
+		sdk.Logger(ctx).Warn().Err(err).Msg("failed to check whether the consumer exists")
+
+		return nil
+	}
+
+	if !exists {
+		return fmt.Errorf("%w: consumer %q of stream %q", ErrConsumerDeleted, i.params.Durable, i.stream)
+	}
+
+	return nil
+}
+
+// resumeParams returns the params of the Iterator with the position of the last message
+// returned by Next, so an Iterator created from them continues where this one left off,
+// even if its consumer has to be re-created.
+func (i *Iterator) resumeParams() IteratorParams {
+	params := i.params
+	// the consumer was already reset when the Iterator was created
+	params.ResetOnStart = false
+
+	if lastSeq := i.lastSeq.Load(); lastSeq > 0 {
+		// the position of a marshaled struct can't fail to be marshaled
+		params.SDKPosition, _ = position{OptSeq: lastSeq}.marshalSDKPosition()
+	}
+
+	return params
+}
+
+// detach unsubscribes the Iterator from its consumer without acknowledging, deleting
+// or stopping anything else, so it can be replaced by a new one. The Iterator is closed afterwards.
+// Messages received, but not returned by Next yet, are negatively acknowledged, so the server
+// redelivers them to the replacing Iterator right away. Detaching a closed Iterator is a no-op.
+func (i *Iterator) detach() error {
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+
+		return nil
+	}
+	i.closed = true
+	i.mu.Unlock()
+
+	if i.detached != nil {
+		close(i.detached)
+	}
+
+	var errs []error
+	if i.subscription != nil {
+		if err := i.subscription.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			errs = append(errs, fmt.Errorf("unsubscribe: %w", err))
+		}
+	}
+
+	i.readMu.Lock()
+	defer i.readMu.Unlock()
+
+	if err := i.nakBuffered(); err != nil {
+		errs = append(errs, fmt.Errorf("nak buffered messages: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkConsumer checks that the consumer to bind to exists and matches the ConsumerType.
+func (i *Iterator) checkConsumer(ctx context.Context) error {
+	info, err := i.jetstream.ConsumerInfo(i.stream, i.params.Durable, nats.Context(ctx))
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+		return fmt.Errorf("consumer %q doesn't exist in stream %q, it must be created before binding to it: %w",
+			i.params.Durable, i.stream, err)
+	case err != nil:
+		return fmt.Errorf("get consumer info: %w", err)
+	}
+
+	isPush := info.Config.DeliverSubject != ""
+	if isPush != (i.params.ConsumerType == ConsumerTypePush) {
+		return fmt.Errorf("consumer %q isn't a %s consumer", i.params.Durable, i.params.ConsumerType)
+	}
+
+	return nil
+}
+
+// consumerConfigDiff returns the names of the fields of the requested consumer config
+// which don't match the existing one. Fields left zero in the requested config are filled
+// with defaults by the server, so they aren't compared.
+func consumerConfigDiff(existing, requested nats.ConsumerConfig) []string {
+	var diff []string
+
+	compare := func(name string, equal bool) {
+		if !equal {
+			diff = append(diff, name)
+		}
+	}
+
+	compare("AckPolicy", existing.AckPolicy == requested.AckPolicy)
+	compare("ReplayPolicy", existing.ReplayPolicy == requested.ReplayPolicy)
+	compare("FilterSubject", existing.FilterSubject == requested.FilterSubject)
+	compare("FilterSubjects", slices.Equal(existing.FilterSubjects, requested.FilterSubjects))
+	compare("DeliverSubject", existing.DeliverSubject == requested.DeliverSubject)
+	compare("FlowControl", existing.FlowControl == requested.FlowControl)
+	compare("RateLimit", existing.RateLimit == requested.RateLimit)
+	compare("BackOff", slices.Equal(existing.BackOff, requested.BackOff))
+	compare("HeadersOnly", existing.HeadersOnly == requested.HeadersOnly)
+
+	if requested.AckWait != 0 {
+		compare("AckWait", existing.AckWait == requested.AckWait)
+	}
+
+	if requested.MaxDeliver != 0 {
+		compare("MaxDeliver", existing.MaxDeliver == requested.MaxDeliver)
+	}
+
+	if requested.Heartbeat != 0 {
+		compare("Heartbeat", existing.Heartbeat == requested.Heartbeat)
+	}
+
+	if requested.MaxAckPending != 0 {
+		compare("MaxAckPending", existing.MaxAckPending == requested.MaxAckPending)
+	}
+
+	if requested.MaxWaiting != 0 {
+		compare("MaxWaiting", existing.MaxWaiting == requested.MaxWaiting)
+	}
+
+	return diff
+}
+
+// HasNext checks is the iterator has messages.
+// A pull consumer fetches a new batch of messages if there are no fetched messages left.
+// It doesn't wait for messages, so WaitForNext should be preferred to avoid polling.
+func (i *Iterator) HasNext(ctx context.Context) bool {
+	i.readMu.Lock()
+	defer i.readMu.Unlock()
+
+	if i.isClosed() {
+		return false
+	}
+
+	if len(i.pendingDeletes) > 0 || len(i.deletes) > 0 {
+		return true
+	}
+
+	if !i.nc.IsConnected() && !i.subscription.IsValid() {
+		return false
+	}
+
+	if i.params.ConsumerType == ConsumerTypePush {
+		return len(i.fetched) > 0 || len(i.messages) > 0
+	}
+
+	if len(i.fetched) > 0 {
+		return true
+	}
+
+	if err := i.fetch(); err != nil {
+		sdk.Logger(ctx).
+			Error().
+			Err(err).
+			Msg("fetch messages")
+
+		return false
+	}
+
+	return len(i.fetched) > 0
+}
+
+// hasBuffered reports whether the iterator has a message or a delete advisory received,
+// but not returned by Next yet, so Next doesn't have to wait for it.
+func (i *Iterator) hasBuffered() bool {
+	i.readMu.Lock()
+	defer i.readMu.Unlock()
+
+	return len(i.fetched) > 0 || len(i.pendingDeletes) > 0 || len(i.messages) > 0 || len(i.deletes) > 0
+}
+
+// WaitForNext blocks until the iterator has a message or the ctx is done.
+// Messages received before the ctx is done are still available to Next afterwards.
+func (i *Iterator) WaitForNext(ctx context.Context) error {
+	i.readMu.Lock()
+	defer i.readMu.Unlock()
+
+	if i.isClosed() {
+		return ErrIteratorClosed
+	}
+
+	// a nil channel never receives, so the consumer isn't checked
+	var check <-chan time.Time
+	if i.checkInterval > 0 && i.params.ConsumerType == ConsumerTypePush {
+		ticker := time.NewTicker(i.checkInterval)
+		defer ticker.Stop()
+
+		check = ticker.C
+	}
+
+	for len(i.fetched) == 0 && len(i.pendingDeletes) == 0 {
+		if i.params.ConsumerType == ConsumerTypePush {
+			select {
+			case msg := <-i.messages:
+				i.fetched = append(i.fetched, msg)
+				if err := i.skipUnmatched(ctx); err != nil {
+					return err
+				}
+			case advisory := <-i.deletes:
+				i.pendingDeletes = append(i.pendingDeletes, advisory)
+			case <-check:
+				if err := i.checkDeleted(ctx); err != nil {
+					return err
+				}
+			case <-i.detached:
+				return ErrIteratorClosed
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if advisory, ok := i.nextDelete(); ok {
+			i.pendingDeletes = append(i.pendingDeletes, advisory)
+
+			continue
+		}
+
+		if !i.subscription.IsValid() {
+			return fmt.Errorf("fetch: %w", nats.ErrBadSubscription)
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, i.params.FetchMaxWait)
+		msgs, err := i.subscription.Fetch(i.params.FetchBatchSize, nats.Context(fetchCtx))
+		cancel()
+
+		// no messages were available within the FetchMaxWait
+		if isFetchTimeout(err) {
+			continue
+		}
+
+		if errors.Is(err, nats.ErrConsumerDeleted) || errors.Is(err, nats.ErrConsumerNotFound) {
+			return fmt.Errorf("fetch: %w: %w", ErrConsumerDeleted, err)
+		}
+
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("fetch: %w", err)
+		}
+
+		i.fetched = append(i.fetched, msgs...)
+		if err := i.skipUnmatched(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipUnmatched skips the fetched messages which don't match the MatchSubject or the MatchHeader,
+// or are older than the MaxMessageAge, so WaitForNext returns only once there's a message to turn into a record.
+func (i *Iterator) skipUnmatched(ctx context.Context) error {
+	matched := i.fetched[:0]
+	for n, msg := range i.fetched {
+		if i.params.matchesMessage(msg) {
+			matched = append(matched, msg)
+
+			continue
+		}
+
+		if err := i.skip(ctx, msg); err != nil {
+			// the messages which weren't checked yet are kept
+			i.fetched = append(matched, i.fetched[n+1:]...)
+
+			return err
+		}
+	}
+	i.fetched = matched
+
+	return nil
+}
+
+// skip drops the message which doesn't match the MatchSubject or the MatchHeader, or is older than
+// the MaxMessageAge. With the explicit ack policy it's acknowledged right away. With the all ack policy
+// acknowledging it would acknowledge the preceding messages, which may not be processed yet,
+// so it's acknowledged along with the next record.
+// The last sequence is advanced, so a re-created consumer doesn't deliver it again.
+func (i *Iterator) skip(ctx context.Context, msg *nats.Msg) error {
+	i.received.Add(1)
+	i.skipped.Add(1)
+
+	if metadata, err := msg.Metadata(); err == nil {
+		i.lastSeq.Store(metadata.Sequence.Stream)
+	}
+
+	if i.params.AckPolicy != nats.AckExplicitPolicy {
+		return nil
+	}
+
+	if err := i.ackMsg(ctx, msg); err != nil {
+		return fmt.Errorf("ack skipped message: %w", err)
+	}
+
+	return nil
+}
+
+// Next returns the next record from the underlying messages channel
+// or from the fetched messages of a pull consumer.
+// It also appends messages to a unackMessages slice if the AckPolicy is not equal to AckNonePolicy.
+func (i *Iterator) Next(ctx context.Context) (opencdc.Record, error) {
+	i.readMu.Lock()
+	defer i.readMu.Unlock()
+
+	if i.isClosed() {
+		return opencdc.Record{}, ErrIteratorClosed
+	}
+
+	select {
+	case <-ctx.Done():
+		return opencdc.Record{}, ctx.Err()
+	default:
+		if advisory, ok := i.nextDelete(); ok {
+			i.produced.Add(1)
+
+			return i.deleteToRecord(advisory)
+		}
+
+		msg, err := i.nextMatchingMessage(ctx)
+		if err != nil {
+			return opencdc.Record{}, err
+		}
+		i.received.Add(1)
+
+		sdkRecord, err := i.messageToRecord(msg)
+		if err != nil {
+			return opencdc.Record{},
+				errors.Join(
+					opencdc.ErrMetadataFieldNotFound,
+					fmt.Errorf("convert message to record: %w", err),
+				)
+		}
+
+		position, err := parsePosition(sdkRecord.Position)
+		if err != nil {
+			return opencdc.Record{}, fmt.Errorf("convert record to position: %w", err)
+		}
+
+		if i.params.AckPolicy != nats.AckNonePolicy {
+			i.mu.Lock()
+			i.unackMessages[position.OptSeq] = msg
+			i.mu.Unlock()
+		}
+
+		if i.positionGap > 0 {
+			sdkRecord.Metadata[internal.MetadataPositionGap] = strconv.FormatUint(i.positionGap, 10)
+			i.positionGap = 0
+		}
+
+		i.lastSeq.Store(position.OptSeq)
+		i.produced.Add(1)
+
+		return sdkRecord, nil
+	}
+}
+
+// nextMatchingMessage returns the next available message matching the MatchSubject,
+// the MatchHeader and the MaxMessageAge, skipping the ones which don't match.
+func (i *Iterator) nextMatchingMessage(ctx context.Context) (*nats.Msg, error) {
+	for {
+		msg, err := i.nextMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		if i.params.matchesMessage(msg) {
+			return msg, nil
+		}
+
+		if err := i.skip(ctx, msg); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// nextMessage returns the next available message, if there's none it returns sdk.ErrBackoffRetry.
+func (i *Iterator) nextMessage() (*nats.Msg, error) {
+	if i.params.ConsumerType == ConsumerTypePush && len(i.fetched) == 0 {
+		select {
+		case msg := <-i.messages:
+			return msg, nil
+		default:
+			return nil, sdk.ErrBackoffRetry
+		}
+	}
+
+	if len(i.fetched) == 0 {
+		if err := i.fetch(); err != nil {
+			return nil, err
+		}
+
+		if len(i.fetched) == 0 {
+			return nil, sdk.ErrBackoffRetry
+		}
+	}
+
+	msg := i.fetched[0]
+	i.fetched[0] = nil
+	i.fetched = i.fetched[1:]
+
+	return msg, nil
+}
+
+// fetch fetches a batch of messages from a pull consumer.
+// It's not an error if no messages were available within the FetchMaxWait.
+func (i *Iterator) fetch() error {
+	msgs, err := i.subscription.Fetch(i.params.FetchBatchSize, nats.MaxWait(i.params.FetchMaxWait))
+	switch {
+	case isFetchTimeout(err):
+		return nil
+	case errors.Is(err, nats.ErrConsumerDeleted) || errors.Is(err, nats.ErrConsumerNotFound):
+		return fmt.Errorf("fetch: %w: %w", ErrConsumerDeleted, err)
+	case err != nil:
+		return fmt.Errorf("fetch: %w", err)
+	}
+
+	i.fetched = append(i.fetched, msgs...)
+
+	return nil
+}
+
+// isFetchTimeout checks if the err means that no messages were available within the fetch max wait.
+func isFetchTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout)
+}
+
+// Ack acknowledges a message at the given position.
+func (i *Iterator) Ack(ctx context.Context, sdkPosition opencdc.Position) error {
+	return i.AckBatch(ctx, []opencdc.Position{sdkPosition})
+}
+
+// AckBatch acknowledges messages at the given positions in one go.
+// If any of the positions is not awaiting an acknowledgement, none of the messages are acknowledged.
+// With the AckAllPolicy, which acknowledges all the previous messages too, or the AckModeFIFO
+// the positions must be a contiguous prefix of the pending messages, otherwise ErrAckOutOfOrder
+// is returned. If acknowledging a message fails, the ones acknowledged before it aren't pending anymore.
+// If AckSync is set, the messages stay pending until the server confirms the acknowledgements.
+func (i *Iterator) AckBatch(ctx context.Context, sdkPositions []opencdc.Position) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return ErrIteratorClosed
+	}
+
+	// if ack policy is 'none' just return nil here
+	if i.params.AckPolicy == nats.AckNonePolicy || len(sdkPositions) == 0 {
+		return nil
+	}
+
+	batch := make(map[uint64]*nats.Msg, len(sdkPositions))
+	for _, sdkPosition := range sdkPositions {
+		if isAdvisoryPosition(sdkPosition) {
+			continue
+		}
+
+		seq, msg, err := i.pendingMessage(sdkPosition)
+		if err != nil {
+			return err
+		}
+
+		batch[seq] = msg
+	}
+
+	// delete records don't have messages to acknowledge
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if i.params.AckPolicy == nats.AckAllPolicy || i.params.AckMode != AckModeAny {
+		if err := i.checkAckOrder(batch); err != nil {
+			return err
+		}
+	}
+
+	acked, err := i.ackBatch(ctx, batch)
+
+	// remove acknowledged messages from the map, even if acknowledging the rest failed
+	for _, seq := range acked {
+		delete(i.unackMessages, seq)
+	}
+	i.acked.Add(uint64(len(acked)))
+
+	return err
+}
+
+// checkAckOrder returns ErrAckOutOfOrder unless the batch is a contiguous prefix of the pending messages,
+// so every pending message received before a message of the batch is in the batch too.
+func (i *Iterator) checkAckOrder(batch map[uint64]*nats.Msg) error {
+	last := slices.Max(slices.Collect(maps.Keys(batch)))
+
+	var missing []uint64
+	for seq := range i.unackMessages {
+		if _, ok := batch[seq]; !ok && seq < last {
+			missing = append(missing, seq)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: message %d is pending before message %d", ErrAckOutOfOrder, slices.Min(missing), last)
+	}
+
+	return nil
+}
+
+// ackBatch acknowledges the batch of messages in the order they were received and returns
+// the sequences of the acknowledged ones, which are only a part of the batch if an acknowledgement fails.
+// If the AckPolicy is AckAllPolicy only the last message is acknowledged,
+// as this implicitly acknowledges all the previous ones.
+func (i *Iterator) ackBatch(ctx context.Context, batch map[uint64]*nats.Msg) ([]uint64, error) {
+	seqs := slices.Sorted(maps.Keys(batch))
+
+	if i.params.AckPolicy == nats.AckAllPolicy {
+		if err := i.ackMsg(ctx, batch[seqs[len(seqs)-1]]); err != nil {
+			return nil, fmt.Errorf("ack message: %w", err)
+		}
+
+		return seqs, nil
+	}
+
+	for n, seq := range seqs {
+		if err := i.ackMsg(ctx, batch[seq]); err != nil {
+			return seqs[:n], fmt.Errorf("ack message %d: %w", seq, err)
+		}
+	}
+
+	return seqs, nil
+}
+
+// ackMsg acknowledges the message, waiting for the server's confirmation if AckSync is set.
+func (i *Iterator) ackMsg(ctx context.Context, msg *nats.Msg) error {
+	if i.params.AckSync {
+		return msg.AckSync(nats.Context(ctx))
+	}
+
+	return msg.Ack()
+}
+
+// Nak negatively acknowledges a message at the given position,
+// so that the server redelivers it.
+func (i *Iterator) Nak(ctx context.Context, sdkPosition opencdc.Position) error {
+	return i.release(ctx, sdkPosition, "nak", &i.naked, func(msg *nats.Msg) error {
+		return msg.Nak(i.ackOpts(ctx)...)
+	})
+}
+
+// NakWithDelay negatively acknowledges a message at the given position,
+// so that the server redelivers it after the given delay.
+// If the delay isn't positive, it's the same as Nak.
+func (i *Iterator) NakWithDelay(ctx context.Context, sdkPosition opencdc.Position, delay time.Duration) error {
+	if delay <= 0 {
+		return i.Nak(ctx, sdkPosition)
+	}
+
+	return i.release(ctx, sdkPosition, "nak", &i.naked, func(msg *nats.Msg) error {
+		return msg.NakWithDelay(delay, i.ackOpts(ctx)...)
+	})
+}
+
+// Term terminates a message at the given position, so that the server never redelivers it,
+// e.g. after it repeatedly failed to be processed. Unlike Ack, it doesn't mark the message
+// as successfully processed, and the server publishes a MSG_TERMINATED advisory for it,
+// which can be used to route it to a dead-letter stream.
+func (i *Iterator) Term(ctx context.Context, sdkPosition opencdc.Position) error {
+	return i.release(ctx, sdkPosition, "term", &i.termed, func(msg *nats.Msg) error {
+		return msg.Term(i.ackOpts(ctx)...)
+	})
+}
+
+// ackOpts returns the options making a negative acknowledgement or a termination
+// wait for the server's confirmation within the ctx if AckSync is set.
+func (i *Iterator) ackOpts(ctx context.Context) []nats.AckOpt {
+	if i.params.AckSync {
+		return []nats.AckOpt{nats.Context(ctx)}
+	}
+
+	return nil
+}
+
+// release negatively acknowledges or terminates a message at the given position using the releaseFn,
+// counts it in the counter and removes it from the unackMessages, as it's not pending
+// on the connector's side anymore. With the AckModeFIFO only the oldest pending message can be released.
+func (i *Iterator) release(
+	ctx context.Context,
+	sdkPosition opencdc.Position,
+	action string,
+	counter *atomic.Uint64,
+	releaseFn func(*nats.Msg) error,
+) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return ErrIteratorClosed
+	}
+
+	// if ack policy is 'none' there's nothing the server could redeliver,
+	// and delete records can't be redelivered at all
+	if i.params.AckPolicy == nats.AckNonePolicy || isAdvisoryPosition(sdkPosition) {
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	seq, msg, err := i.pendingMessage(sdkPosition)
+	if err != nil {
+		return err
+	}
+
+	if i.params.AckMode != AckModeAny {
+		if err := i.checkAckOrder(map[uint64]*nats.Msg{seq: msg}); err != nil {
+			return err
+		}
+	}
+
+	if err := releaseFn(msg); err != nil {
+		return fmt.Errorf("%s message: %w", action, err)
+	}
+
+	delete(i.unackMessages, seq)
+	counter.Add(1)
+
+	return nil
+}
+
+// Working tells the server that the message at the given position is still being processed,
+// which resets its AckWait timer, so it isn't redelivered while it awaits an acknowledgement.
+// The message stays pending and can be sent any number of times.
+func (i *Iterator) Working(ctx context.Context, sdkPosition opencdc.Position) error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.closed {
+		return ErrIteratorClosed
+	}
+
+	// without acknowledgements nothing is redelivered
+	if i.params.AckPolicy == nats.AckNonePolicy || isAdvisoryPosition(sdkPosition) {
+		return nil
+	}
+
+	_, msg, err := i.pendingMessage(sdkPosition)
+	if err != nil {
+		return err
+	}
+
+	if i.params.AckSync {
+		err = msg.InProgress(nats.Context(ctx))
+	} else {
+		err = msg.InProgress()
+	}
+	if err != nil {
+		return fmt.Errorf("mark message in progress: %w", err)
+	}
+
+	return nil
+}
+
+// isAdvisoryPosition reports whether the position belongs to a delete record created from an advisory.
+func isAdvisoryPosition(sdkPosition opencdc.Position) bool {
+	position, err := parsePosition(sdkPosition)
+
+	return err == nil && position.Advisory != ""
+}
+
+// pendingMessage returns a message awaiting an acknowledgement at the given position
+// along with its sequence. The caller must hold the lock.
+func (i *Iterator) pendingMessage(sdkPosition opencdc.Position) (uint64, *nats.Msg, error) {
+	position, err := parsePosition(sdkPosition)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not find record at position: %w", err)
+	}
+
+	msg, ok := i.unackMessages[position.OptSeq]
+	if !ok {
+		return 0, nil, fmt.Errorf("could not find message at position: %d not avaiable to ack", position.OptSeq)
+	}
+
+	return position.OptSeq, msg, nil
+}
+
+// adoptPending takes over the messages awaiting an acknowledgement from the replaced Iterator,
+// so the records read from it can still be acknowledged.
+func (i *Iterator) adoptPending(replaced *Iterator) {
+	replaced.mu.Lock()
+	defer replaced.mu.Unlock()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for seq, msg := range replaced.unackMessages {
+		i.unackMessages[seq] = msg
+		delete(replaced.unackMessages, seq)
+	}
+}
+
+func (i *Iterator) unAckAll() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// explicity not acking unackedMessages
+	for seq, msg := range i.unackMessages {
+		if err := msg.Nak(); err != nil {
+			return fmt.Errorf("not ack (when stopping): %w", err)
+		}
+		delete(i.unackMessages, seq)
+		i.naked.Add(1)
+	}
+
+	return nil
+}
+
+// Stats returns the counters of the Iterator's activity.
+func (i *Iterator) Stats() IteratorStats {
+	i.mu.RLock()
+	unacked := len(i.unackMessages)
+	i.mu.RUnlock()
+
+	return IteratorStats{
+		MessagesReceived: i.received.Load(),
+		RecordsProduced:  i.produced.Load(),
+		Redeliveries:     i.redelivered.Load(),
+		Acks:             i.acked.Load(),
+		Naks:             i.naked.Load(),
+		Terms:            i.termed.Load(),
+		Skipped:          i.skipped.Load(),
+		Unacked:          unacked,
+	}
+}
+
+// Lag fetches the state of the consumer from the server and returns how far it's behind the stream.
+func (i *Iterator) Lag(ctx context.Context) (ConsumerLag, error) {
+	var (
+		info *nats.ConsumerInfo
+		err  error
+	)
+
+	if i.params.Ordered {
+		// the name of an ordered consumer is generated by the NATS client and changes on every reset
+		info, err = i.subscription.ConsumerInfo()
+	} else {
+		info, err = i.jetstream.ConsumerInfo(i.stream, i.params.Durable, nats.Context(ctx))
+	}
+	if err != nil {
+		return ConsumerLag{}, fmt.Errorf("get consumer info: %w", err)
+	}
+
+	return ConsumerLag{
+		NumPending:    info.NumPending,
+		NumAckPending: info.NumAckPending,
+		DeliveredSeq:  info.Delivered.Stream,
+		AckFloorSeq:   info.AckFloor.Stream,
+	}, nil
+}
+
+// Connected reports whether the underlying NATS connection is currently established.
+func (i *Iterator) Connected() bool {
+	return i.nc.IsConnected()
+}
+
+// Stop stops the Iterator, unsubscribes from a subject.
+// Messages received, but not returned by Next yet, and messages awaiting
+// an acknowledgement are negatively acknowledged, so the server redelivers them
+// right away once the connector starts again.
+// The consumer is deleted only if the DeleteConsumerOnStop is set,
+// otherwise it's kept with its delivery and acknowledgement state.
+// Once stopped, the Iterator returns ErrIteratorClosed and stopping it again is a no-op.
+// Stop must not be called concurrently with Next.
+func (i *Iterator) Stop() error {
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+
+		return nil
+	}
+	i.closed = true
+	i.mu.Unlock()
+
+	// a failed step doesn't stop the following ones, so the messages are released anyway
+	var errs []error
+
+	if i.subscription != nil {
+		if err := i.subscription.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			errs = append(errs, fmt.Errorf("unsubscribe: %w", err))
+		}
+	}
+
+	if i.deletesSubscription != nil {
+		close(i.deletesDone)
+		err := i.deletesSubscription.Unsubscribe()
+		if err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			errs = append(errs, fmt.Errorf("unsubscribe from api audit advisories: %w", err))
+		}
+	}
+
+	// the messages must be negatively acknowledged before the consumer is deleted
+	if err := i.nakBuffered(); err != nil {
+		errs = append(errs, fmt.Errorf("nak buffered messages (when stopping): %w", err))
+	}
+
+	// explicity not acking unackedMessages
+	if err := i.unAckAll(); err != nil {
+		errs = append(errs, fmt.Errorf("not ack (when stopping): %w", err))
+	}
+
+	// the subscription is bound to the consumer, so it must be deleted explicitly,
+	// except for an ordered consumer, which is deleted by the NATS client on unsubscribe
+	if i.subscription != nil && i.params.DeleteConsumerOnStop && !i.params.Ordered && !i.params.BindOnly {
+		// the consumer may be shared, or already removed from the server, which is just as good
+		err := i.jetstream.DeleteConsumer(i.stream, i.params.Durable)
+		if err != nil && !errors.Is(err, nats.ErrConsumerNotFound) {
+			errs = append(errs, fmt.Errorf("delete consumer: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isClosed reports whether the Iterator has been stopped.
+func (i *Iterator) isClosed() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.closed
+}
+
+// nakBuffered negatively acknowledges the messages received, but not returned by Next yet.
+func (i *Iterator) nakBuffered() error {
+	buffered := i.fetched
+	i.fetched = nil
+
+	for len(i.messages) > 0 {
+		buffered = append(buffered, <-i.messages)
+	}
+
+	// if ack policy is 'none' there's nothing the server could redeliver
+	if i.params.AckPolicy == nats.AckNonePolicy {
+		return nil
+	}
+
+	var errs []error
+	for _, msg := range buffered {
+		if err := msg.Nak(); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+		i.naked.Add(1)
+	}
+
+	return errors.Join(errs...)
+}
+
+// messageToRecord converts a *nats.Msg to a opencdc.Record.
+func (i *Iterator) messageToRecord(msg *nats.Msg) (opencdc.Record, error) {
+	// retrieve a message metadata one more time to grab a metadata.Timestamp
+	// and use it for a opencdc.Record.Metadata
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return opencdc.Record{}, fmt.Errorf("get message metadata: %w", err)
+	}
+
+	position, err := i.getMessagePosition(msg.Subject, metadata)
+	if err != nil {
+		return opencdc.Record{}, fmt.Errorf("get position: %w", err)
+	}
+
+	var (
+		payload      []byte
+		decompressed bool
+	)
+	// messages of a headers only consumer have no payload to decode
+	if !i.params.HeadersOnly {
+		payload, decompressed, err = decodePayload(msg.Header, i.params.PayloadEncoding, msg.Data)
+		if err != nil {
+			return opencdc.Record{}, fmt.Errorf("message on subject %q at stream sequence %d: %w",
+				msg.Subject, metadata.Sequence.Stream, err)
+		}
+	}
+
+	if metadata.NumDelivered > 1 {
+		i.redelivered.Add(1)
+	}
+
+	if metadata.Timestamp.IsZero() {
+		metadata.Timestamp = time.Now()
+	}
+
+	sdkMetadata := make(opencdc.Metadata)
+	sdkMetadata.SetCreatedAt(metadata.Timestamp)
+	sdkMetadata[internal.MetadataContentType] = contentType(msg.Header)
+	sdkMetadata[internal.MetadataNumDelivered] = strconv.FormatUint(metadata.NumDelivered, 10)
+
+	if !i.params.LegacyRecordFormat {
+		sdkMetadata.SetCollection(internal.TrimSubjectPrefix(i.params.SubjectPrefix, msg.Subject))
+		sdkMetadata[internal.MetadataStream] = metadata.Stream
+	}
+
+	// the headers are all there is to a message of a headers only consumer
+	if i.params.PropagateHeaders || i.params.HeadersOnly {
+		for key, values := range msg.Header {
+			// the content encoding doesn't apply to the decompressed payload
+			if decompressed && key == internal.ContentEncodingHeader {
+				continue
+			}
+
+			sdkMetadata[internal.MetadataHeaderPrefix+key] = strings.Join(values, ",")
+		}
+	}
+
+	if i.params.HeadersOnly {
+		sdkMetadata[internal.MetadataMsgSize] = msg.Header.Get(nats.MsgSize)
+	}
+
+	if i.params.SourcePositionMetadata {
+		if sourcePosition := msg.Header.Get(internal.SourcePositionHeader); sourcePosition != "" {
+			sdkMetadata[internal.MetadataSourcePosition] = sourcePosition
+		}
+	}
+
+	if i.params.EnableTracing {
+		internal.ExtractTrace(msg.Header, sdkMetadata)
+	}
+
+	if i.params.BeforeHeader {
+		if before := msg.Header.Get(internal.BeforeHeader); before != "" {
+			decoded, err := base64.StdEncoding.DecodeString(before)
+			if err != nil {
+				return opencdc.Record{}, fmt.Errorf("message on subject %q at stream sequence %d: decode %s header: %w",
+					msg.Subject, metadata.Sequence.Stream, internal.BeforeHeader, err)
+			}
+
+			return sdk.Util.Source.NewRecordUpdate(position, sdkMetadata, i.messageKey(msg),
+				opencdc.RawData(decoded), opencdc.RawData(payload)), nil
+		}
+	}
+
+	return sdk.Util.Source.NewRecordCreate(position, sdkMetadata, i.messageKey(msg), opencdc.RawData(payload)), nil
+}
+
+// contentType returns the media type of the payload of a message with the header,
+// or the internal.DefaultContentType if the header doesn't specify it.
+func contentType(header nats.Header) string {
+	if value := header.Get(internal.ContentTypeHeader); value != "" {
+		return value
+	}
+
+	return internal.DefaultContentType
+}
+
+// decodePayload decompresses the data of a message with the header, if the internal.ContentEncodingHeader
+// says it's compressed, and decodes it using the encoding. It reports whether the data was decompressed.
+func decodePayload(header nats.Header, encoding string, data []byte) ([]byte, bool, error) {
+	data, decompressed, err := internal.DecompressPayload(header.Get(internal.ContentEncodingHeader), data)
+	if err != nil {
+		return nil, false, fmt.Errorf("decompress payload: %w", err)
+	}
+
+	data, err = internal.DecodePayload(encoding, data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return data, decompressed, nil
+}
+
+// messageKey returns a record key of a message based on the KeySource.
+// It returns nil if the KeySource is empty or the message doesn't contain the key.
+func (i *Iterator) messageKey(msg *nats.Msg) opencdc.Data {
+	var key string
+
+	subject := internal.TrimSubjectPrefix(i.params.SubjectPrefix, msg.Subject)
+
+	switch {
+	case i.params.KeySource == "":
+		return nil
+	case i.params.KeySource == keySourceSubject:
+		key = subject
+	case strings.HasPrefix(i.params.KeySource, keySourceSubjectTokenPrefix):
+		// the index is checked when the config is validated
+		index, _ := strconv.Atoi(strings.TrimPrefix(i.params.KeySource, keySourceSubjectTokenPrefix))
+
+		tokens := strings.Split(subject, ".")
+		if index >= len(tokens) {
+			return nil
+		}
+
+		key = tokens[index]
+	case strings.HasPrefix(i.params.KeySource, keySourceHeaderPrefix):
+		key = msg.Header.Get(strings.TrimPrefix(i.params.KeySource, keySourceHeaderPrefix))
+	}
+
+	if key == "" {
+		return nil
+	}
 
-	return sdk.Util.Source.NewRecordCreate(position, sdkMetadata, nil, opencdc.RawData(msg.Data)), nil
+	return opencdc.RawData(key)
 }
 
 // getMessagePosition returns a position of a message in the form of opencdc.Position.
-func (i *Iterator) getMessagePosition(metadata *nats.MsgMetadata) (opencdc.Position, error) {
+func (i *Iterator) getMessagePosition(subject string, metadata *nats.MsgMetadata) (opencdc.Position, error) {
+	// the stream sequence is used to resume consumption, because the consumer sequence
+	// starts over whenever the consumer is recreated and changes on every redelivery
 	position := position{
-		OptSeq: metadata.Sequence.Consumer,
+		OptSeq:       metadata.Sequence.Stream,
+		ConsumerSeq:  metadata.Sequence.Consumer,
+		NumDelivered: metadata.NumDelivered,
+		Subject:      subject,
 	}
 
 	sdkPosition, err := position.marshalSDKPosition()
@@ -13,3 +13,2469 @@
 // limitations under the License.
 
 package source
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+)
+
+func TestIteratorParams_getConsumerConfig(t *testing.T) {
+	t.Run("pull consumer", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			BufferSize:    1024,
+			Durable:       "durable",
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverAllPolicy,
+			AckPolicy:     nats.AckExplicitPolicy,
+			ConsumerType:  ConsumerTypePull,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.Durable, "durable")
+		is.Equal(cfg.FilterSubject, "foo")
+		is.Equal(cfg.DeliverPolicy, nats.DeliverAllPolicy)
+		is.Equal(cfg.AckPolicy, nats.AckExplicitPolicy)
+		is.Equal(cfg.MaxWaiting, 1024)
+		is.Equal(cfg.DeliverSubject, "")
+	})
+
+	t.Run("push consumer", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			Durable:        "durable",
+			DeliverSubject: "durable.conduit",
+			Subject:        "foo",
+			DeliverPolicy:  nats.DeliverNewPolicy,
+			AckPolicy:      nats.AckExplicitPolicy,
+			ConsumerType:   ConsumerTypePush,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.DeliverSubject, "durable.conduit")
+		is.True(cfg.FlowControl)
+		is.Equal(cfg.Heartbeat, heartbeatTimeout)
+		is.Equal(cfg.DeliverPolicy, nats.DeliverNewPolicy)
+	})
+
+	t.Run("push consumer, rate limit", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			Subject:      "foo",
+			ConsumerType: ConsumerTypePush,
+			RateLimit:    1 << 20,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.RateLimit, uint64(1<<20))
+	})
+
+	t.Run("pull consumer, rate limit", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			Subject:      "foo",
+			ConsumerType: ConsumerTypePull,
+			RateLimit:    1 << 20,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("push consumer, custom heartbeat", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			Heartbeat:    5 * time.Second,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.Heartbeat, 5*time.Second)
+	})
+
+	t.Run("push consumer, heartbeat exceeds ack wait", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			Heartbeat:    time.Minute,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("push consumer, negative heartbeat", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			Heartbeat:    -time.Second,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("push consumer, heartbeat exceeds custom ack wait", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			Heartbeat:    5 * time.Second,
+			AckWait:      5 * time.Second,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("custom ack wait", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			AckWait: time.Minute,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.AckWait, time.Minute)
+	})
+
+	t.Run("negative ack wait", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			AckWait: -time.Minute,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("max deliver with back off", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			MaxDeliver: 3,
+			BackOff:    []time.Duration{time.Second, 5 * time.Second},
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.MaxDeliver, 3)
+		is.Equal(cfg.BackOff, []time.Duration{time.Second, 5 * time.Second})
+	})
+
+	t.Run("back off exceeds max deliver", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			MaxDeliver: 1,
+			BackOff:    []time.Duration{time.Second, 5 * time.Second},
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("back off without max deliver", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			BackOff: []time.Duration{time.Second},
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("negative max deliver", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			MaxDeliver: -1,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("max ack pending", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			BufferSize:    1024,
+			AckPolicy:     nats.AckExplicitPolicy,
+			MaxAckPending: 2048,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.MaxAckPending, 2048)
+	})
+
+	t.Run("max ack pending less than buffer size", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			BufferSize:    1024,
+			AckPolicy:     nats.AckExplicitPolicy,
+			MaxAckPending: 512,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("max ack pending with ack policy none", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			BufferSize:    1024,
+			AckPolicy:     nats.AckNonePolicy,
+			MaxAckPending: 512,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.MaxAckPending, 0)
+	})
+
+	t.Run("default replay policy", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.ReplayPolicy, nats.ReplayInstantPolicy)
+	})
+
+	t.Run("original replay policy", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			ReplayPolicy: "original",
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.ReplayPolicy, nats.ReplayOriginalPolicy)
+	})
+
+	t.Run("invalid replay policy", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			ReplayPolicy: "fast",
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("last per subject with a wildcard subject", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			Subject:       "orders.*",
+			DeliverPolicy: nats.DeliverLastPerSubjectPolicy,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.DeliverPolicy, nats.DeliverLastPerSubjectPolicy)
+	})
+
+	t.Run("last per subject without a wildcard subject", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			Subject:       "orders.created",
+			DeliverPolicy: nats.DeliverLastPerSubjectPolicy,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("filter subjects", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			Subject:        "orders.created",
+			FilterSubjects: []string{"orders.created", "orders.updated"},
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.FilterSubject, "")
+		is.Equal(cfg.FilterSubjects, []string{"orders.created", "orders.updated"})
+	})
+
+	t.Run("deliver policy new on the first run", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverNewPolicy,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.DeliverPolicy, nats.DeliverNewPolicy)
+		is.Equal(cfg.OptStartSeq, uint64(0))
+		is.Equal(cfg.OptStartTime, nil)
+	})
+
+	t.Run("empty position on the first run", func(t *testing.T) {
+		is := is.New(t)
+
+		for _, sdkPosition := range []opencdc.Position{nil, {}} {
+			cfg, err := IteratorParams{
+				Subject:       "foo",
+				DeliverPolicy: nats.DeliverLastPolicy,
+				SDKPosition:   sdkPosition,
+			}.getConsumerConfig()
+			is.NoErr(err)
+			is.Equal(cfg.DeliverPolicy, nats.DeliverLastPolicy)
+			is.Equal(cfg.OptStartSeq, uint64(0))
+		}
+	})
+
+	t.Run("position overrides deliver policy", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverNewPolicy,
+			SDKPosition:   opencdc.Position(`{"opt_seq":32}`),
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.DeliverPolicy, nats.DeliverByStartSequencePolicy)
+		is.Equal(cfg.OptStartSeq, uint64(33))
+	})
+
+	t.Run("start time", func(t *testing.T) {
+		is := is.New(t)
+
+		startTime := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+		cfg, err := IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverAllPolicy,
+			StartTime:     startTime,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.DeliverPolicy, nats.DeliverByStartTimePolicy)
+		is.Equal(*cfg.OptStartTime, startTime)
+	})
+
+	t.Run("start sequence", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverByStartSequencePolicy,
+			StartSeq:      42,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.DeliverPolicy, nats.DeliverByStartSequencePolicy)
+		is.Equal(cfg.OptStartSeq, uint64(42))
+
+		// the position still takes precedence
+		cfg, err = IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverByStartSequencePolicy,
+			StartSeq:      42,
+			SDKPosition:   opencdc.Position(`{"opt_seq":50}`),
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.OptStartSeq, uint64(51))
+
+		_, err = IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverByStartSequencePolicy,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("start time with deliver policy by-start-time", func(t *testing.T) {
+		is := is.New(t)
+
+		startTime := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+		cfg, err := IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverByStartTimePolicy,
+			StartTime:     startTime,
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.DeliverPolicy, nats.DeliverByStartTimePolicy)
+		is.Equal(*cfg.OptStartTime, startTime)
+
+		_, err = IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverByStartTimePolicy,
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("position overrides start time", func(t *testing.T) {
+		is := is.New(t)
+
+		cfg, err := IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverAllPolicy,
+			StartTime:     time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+			SDKPosition:   opencdc.Position(`{"opt_seq":32}`),
+		}.getConsumerConfig()
+		is.NoErr(err)
+		is.Equal(cfg.DeliverPolicy, nats.DeliverByStartSequencePolicy)
+		is.Equal(cfg.OptStartSeq, uint64(33))
+		is.Equal(cfg.OptStartTime, nil)
+	})
+
+	t.Run("start time with deliver policy new", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			Subject:       "foo",
+			DeliverPolicy: nats.DeliverNewPolicy,
+			StartTime:     time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+
+	t.Run("invalid position", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := IteratorParams{
+			SDKPosition: opencdc.Position(`{"opt_seq":"32"}`),
+		}.getConsumerConfig()
+		is.True(err != nil)
+	})
+}
+
+func TestIterator_AckBatch(t *testing.T) {
+	t.Run("ack policy none is a no-op", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckNonePolicy},
+			unackMessages: map[uint64]*nats.Msg{},
+		}
+
+		err := i.AckBatch(context.Background(), []opencdc.Position{opencdc.Position(`{"opt_seq":1}`)})
+		is.NoErr(err)
+	})
+
+	t.Run("empty batch is a no-op", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckAllPolicy},
+			unackMessages: map[uint64]*nats.Msg{1: {}},
+		}
+
+		err := i.AckBatch(context.Background(), nil)
+		is.NoErr(err)
+		is.Equal(len(i.unackMessages), 1)
+	})
+
+	t.Run("position not awaiting an ack fails the whole batch", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckExplicitPolicy},
+			unackMessages: map[uint64]*nats.Msg{1: {}, 2: {}},
+		}
+
+		err := i.AckBatch(context.Background(), []opencdc.Position{
+			opencdc.Position(`{"opt_seq":1}`),
+			opencdc.Position(`{"opt_seq":3}`),
+		})
+		is.True(err != nil)
+		is.Equal(len(i.unackMessages), 2)
+	})
+
+	t.Run("invalid position", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckExplicitPolicy},
+			unackMessages: map[uint64]*nats.Msg{1: {}},
+		}
+
+		err := i.AckBatch(context.Background(), []opencdc.Position{opencdc.Position(`{"opt_seq":"1"}`)})
+		is.True(err != nil)
+		is.Equal(len(i.unackMessages), 1)
+	})
+
+	t.Run("fifo ack mode rejects out of order acks", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckExplicitPolicy, AckMode: AckModeFIFO},
+			unackMessages: map[uint64]*nats.Msg{1: {}, 2: {}},
+		}
+
+		err := i.AckBatch(context.Background(), []opencdc.Position{opencdc.Position(`{"opt_seq":2}`)})
+		is.True(errors.Is(err, ErrAckOutOfOrder))
+		is.Equal(len(i.unackMessages), 2)
+	})
+
+	t.Run("unset ack mode rejects out of order acks", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckExplicitPolicy},
+			unackMessages: map[uint64]*nats.Msg{1: {}, 2: {}},
+		}
+
+		err := i.AckBatch(context.Background(), []opencdc.Position{opencdc.Position(`{"opt_seq":2}`)})
+		is.True(errors.Is(err, ErrAckOutOfOrder))
+		is.Equal(len(i.unackMessages), 2)
+
+		params, err := IteratorParams{Subject: "foo"}.withDefaults()
+		is.NoErr(err)
+		is.Equal(params.AckMode, AckModeFIFO)
+	})
+
+	t.Run("ack all policy rejects a batch which isn't a prefix", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckAllPolicy, AckMode: AckModeAny},
+			unackMessages: map[uint64]*nats.Msg{1: {}, 2: {}, 3: {}},
+		}
+
+		// acknowledging the 3rd message would implicitly acknowledge the 2nd one as well
+		err := i.AckBatch(context.Background(), []opencdc.Position{
+			opencdc.Position(`{"opt_seq":1}`),
+			opencdc.Position(`{"opt_seq":3}`),
+		})
+		is.True(errors.Is(err, ErrAckOutOfOrder))
+		is.Equal(len(i.unackMessages), 3)
+	})
+}
+
+func TestIterator_AckBatch_sync(t *testing.T) {
+	newIterator := func(t *testing.T, server *testServer) *Iterator {
+		t.Helper()
+
+		nc, err := nats.Connect(server.addr)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		t.Cleanup(nc.Close)
+
+		sub, err := nc.SubscribeSync("foo")
+		if err != nil {
+			t.Fatalf("subscribe: %v", err)
+		}
+
+		return &Iterator{
+			params: IteratorParams{AckPolicy: nats.AckExplicitPolicy, AckSync: true},
+			unackMessages: map[uint64]*nats.Msg{1: {
+				Subject: "foo",
+				Reply:   "$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0",
+				Sub:     sub,
+			}},
+		}
+	}
+
+	t.Run("confirmed acknowledgement", func(t *testing.T) {
+		is := is.New(t)
+
+		server := startTestServer(t)
+		i := newIterator(t, server)
+
+		is.NoErr(i.AckBatch(context.Background(), []opencdc.Position{opencdc.Position(`{"opt_seq":1}`)}))
+		is.Equal(len(i.unackMessages), 0)
+		is.Equal(server.published(), []string{"$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 +ACK"})
+	})
+
+	t.Run("unconfirmed acknowledgement", func(t *testing.T) {
+		is := is.New(t)
+
+		server := startTestServer(t)
+		server.noReplies = true
+		i := newIterator(t, server)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := i.AckBatch(ctx, []opencdc.Position{opencdc.Position(`{"opt_seq":1}`)})
+		is.True(errors.Is(err, context.DeadlineExceeded))
+		// the message is still pending, as the server may not have received the acknowledgement
+		is.Equal(len(i.unackMessages), 1)
+	})
+
+	t.Run("failure in the middle of a batch", func(t *testing.T) {
+		is := is.New(t)
+
+		server := startTestServer(t)
+		i := newIterator(t, server)
+
+		third := *i.unackMessages[1]
+		third.Reply = "$JS.ACK.stream.consumer.1.3.3.1700000000000000000.0"
+		// a message without a subscription can't be acknowledged
+		i.unackMessages[2] = &nats.Msg{}
+		i.unackMessages[3] = &third
+
+		err := i.AckBatch(context.Background(), []opencdc.Position{
+			opencdc.Position(`{"opt_seq":1}`),
+			opencdc.Position(`{"opt_seq":2}`),
+			opencdc.Position(`{"opt_seq":3}`),
+		})
+		is.True(errors.Is(err, nats.ErrMsgNotBound))
+		// the first message was acknowledged, the failed one and the following one are still pending
+		is.Equal(server.published(), []string{"$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 +ACK"})
+		is.Equal(len(i.unackMessages), 2)
+		_, ok := i.unackMessages[1]
+		is.True(!ok)
+	})
+}
+
+func TestIterator_Working(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	server := startTestServer(t)
+
+	nc, err := nats.Connect(server.addr)
+	is.NoErr(err)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	is.NoErr(err)
+
+	i := &Iterator{
+		params: IteratorParams{AckPolicy: nats.AckExplicitPolicy},
+		unackMessages: map[uint64]*nats.Msg{1: {
+			Subject: "foo",
+			Reply:   "$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0",
+			Sub:     sub,
+		}},
+	}
+
+	// the message can be marked in progress repeatedly and stays pending
+	is.NoErr(i.Working(ctx, opencdc.Position(`{"opt_seq":1}`)))
+	is.NoErr(i.Working(ctx, opencdc.Position(`{"opt_seq":1}`)))
+	is.NoErr(nc.Flush())
+	is.Equal(len(i.unackMessages), 1)
+	is.Equal(server.published(), []string{
+		"$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 +WPI",
+		"$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 +WPI",
+	})
+
+	// a message that isn't pending can't be marked in progress
+	is.True(i.Working(ctx, opencdc.Position(`{"opt_seq":2}`)) != nil)
+}
+
+func TestIterator_Term(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	server := startTestServer(t)
+
+	nc, err := nats.Connect(server.addr)
+	is.NoErr(err)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	is.NoErr(err)
+
+	i := &Iterator{
+		params: IteratorParams{AckPolicy: nats.AckExplicitPolicy},
+		unackMessages: map[uint64]*nats.Msg{1: {
+			Subject: "foo",
+			Reply:   "$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0",
+			Sub:     sub,
+		}},
+	}
+
+	is.NoErr(i.Term(ctx, opencdc.Position(`{"opt_seq":1}`)))
+	is.NoErr(nc.Flush())
+	is.Equal(server.published(), []string{"$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 +TERM"})
+
+	// the message isn't pending anymore
+	is.Equal(len(i.unackMessages), 0)
+	is.Equal(i.Stats().Terms, uint64(1))
+	is.Equal(i.Stats().Naks, uint64(0))
+	is.True(i.Term(ctx, opencdc.Position(`{"opt_seq":1}`)) != nil)
+}
+
+func TestIterator_NakWithDelay(t *testing.T) {
+	tests := []struct {
+		name  string
+		delay time.Duration
+		want  string
+	}{
+		{
+			name:  "positive delay",
+			delay: time.Second,
+			want:  `$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 -NAK {"delay": 1000000000}`,
+		},
+		{
+			name:  "zero delay falls back to a plain nak",
+			delay: 0,
+			want:  "$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 -NAK",
+		},
+		{
+			name:  "negative delay falls back to a plain nak",
+			delay: -time.Second,
+			want:  "$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 -NAK",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+
+			server := startTestServer(t)
+
+			nc, err := nats.Connect(server.addr)
+			is.NoErr(err)
+			defer nc.Close()
+
+			sub, err := nc.SubscribeSync("foo")
+			is.NoErr(err)
+
+			i := &Iterator{
+				params: IteratorParams{AckPolicy: nats.AckExplicitPolicy},
+				unackMessages: map[uint64]*nats.Msg{1: {
+					Subject: "foo",
+					Reply:   "$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0",
+					Sub:     sub,
+				}},
+			}
+
+			is.NoErr(i.NakWithDelay(ctx, opencdc.Position(`{"opt_seq":1}`), tt.delay))
+			is.NoErr(nc.Flush())
+			is.Equal(server.published(), []string{tt.want})
+			is.Equal(len(i.unackMessages), 0)
+			is.Equal(i.Stats().Naks, uint64(1))
+		})
+	}
+}
+
+func TestIterator_Nak(t *testing.T) {
+	t.Run("ack policy none is a no-op", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckNonePolicy},
+			unackMessages: map[uint64]*nats.Msg{},
+		}
+
+		is.NoErr(i.Nak(context.Background(), opencdc.Position(`{"opt_seq":1}`)))
+		is.NoErr(i.NakWithDelay(context.Background(), opencdc.Position(`{"opt_seq":1}`), time.Second))
+	})
+
+	t.Run("position not awaiting an ack", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckExplicitPolicy},
+			unackMessages: map[uint64]*nats.Msg{1: {}},
+		}
+
+		is.True(i.Nak(context.Background(), opencdc.Position(`{"opt_seq":2}`)) != nil)
+		is.True(i.NakWithDelay(context.Background(), opencdc.Position(`{"opt_seq":2}`), time.Second) != nil)
+		is.Equal(len(i.unackMessages), 1)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckExplicitPolicy},
+			unackMessages: map[uint64]*nats.Msg{1: {}},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		is.True(errors.Is(i.Nak(ctx, opencdc.Position(`{"opt_seq":1}`)), context.Canceled))
+		is.True(errors.Is(i.NakWithDelay(ctx, opencdc.Position(`{"opt_seq":1}`), time.Second), context.Canceled))
+		is.Equal(len(i.unackMessages), 1)
+	})
+
+	t.Run("fifo ack mode rejects out of order naks", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{
+			params:        IteratorParams{AckPolicy: nats.AckExplicitPolicy, AckMode: AckModeFIFO},
+			unackMessages: map[uint64]*nats.Msg{1: {}, 2: {}},
+		}
+
+		is.True(errors.Is(i.Nak(context.Background(), opencdc.Position(`{"opt_seq":2}`)), ErrAckOutOfOrder))
+		is.True(errors.Is(
+			i.NakWithDelay(context.Background(), opencdc.Position(`{"opt_seq":2}`), time.Second),
+			ErrAckOutOfOrder,
+		))
+		is.Equal(len(i.unackMessages), 2)
+	})
+}
+
+func TestIterator_messageToRecord(t *testing.T) {
+	newMsg := func() *nats.Msg {
+		return &nats.Msg{
+			Subject: "foo",
+			Reply:   "$JS.ACK.stream.consumer.1.5.3.1700000000000000000.0",
+			Header: nats.Header{
+				"Trace-Id": []string{"abc"},
+				"Tags":     []string{"a", "b"},
+			},
+			Data: []byte("hello"),
+			Sub:  &nats.Subscription{},
+		}
+	}
+
+	t.Run("headers are propagated", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{params: IteratorParams{PropagateHeaders: true}}
+
+		record, err := i.messageToRecord(newMsg())
+		is.NoErr(err)
+		is.Equal(record.Payload.After, opencdc.RawData("hello"))
+		is.Equal(record.Metadata["nats.header.Trace-Id"], "abc")
+		is.Equal(record.Metadata["nats.header.Tags"], "a,b")
+	})
+
+	t.Run("headers are not propagated", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{params: IteratorParams{PropagateHeaders: false}}
+
+		record, err := i.messageToRecord(newMsg())
+		is.NoErr(err)
+		_, ok := record.Metadata["nats.header.Trace-Id"]
+		is.True(!ok)
+	})
+
+	t.Run("compressed payload", func(t *testing.T) {
+		is := is.New(t)
+
+		data := []byte(strings.Repeat("hello ", 100))
+		compressed, ok, err := internal.CompressPayload(data, 1)
+		is.NoErr(err)
+		is.True(ok)
+
+		msg := newMsg()
+		msg.Data = compressed
+		msg.Header.Set("Content-Encoding", "gzip")
+
+		i := &Iterator{params: IteratorParams{PropagateHeaders: true}}
+
+		record, err := i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Payload.After, opencdc.RawData(data))
+		// the header doesn't apply to the decompressed payload
+		_, ok = record.Metadata["nats.header.Content-Encoding"]
+		is.True(!ok)
+		is.Equal(record.Metadata["nats.header.Trace-Id"], "abc")
+
+		// unknown encodings are left to the consumer
+		msg = newMsg()
+		msg.Header.Set("Content-Encoding", "br")
+
+		record, err = i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Payload.After, opencdc.RawData("hello"))
+		is.Equal(record.Metadata["nats.header.Content-Encoding"], "br")
+	})
+
+	t.Run("source position", func(t *testing.T) {
+		is := is.New(t)
+
+		msg := newMsg()
+		msg.Header.Set("Conduit-Source-Position", "eyJvcHRfc2VxIjoxfQ==")
+
+		i := &Iterator{params: IteratorParams{SourcePositionMetadata: true}}
+
+		record, err := i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Metadata["conduit.source.position"], "eyJvcHRfc2VxIjoxfQ==")
+
+		// the source position is read only if requested
+		i = &Iterator{}
+
+		record, err = i.messageToRecord(msg)
+		is.NoErr(err)
+		_, ok := record.Metadata["conduit.source.position"]
+		is.True(!ok)
+	})
+
+	t.Run("before header", func(t *testing.T) {
+		is := is.New(t)
+
+		msg := newMsg()
+		msg.Header.Set("Conduit-Before", "aGk=")
+
+		i := &Iterator{params: IteratorParams{BeforeHeader: true}}
+
+		record, err := i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Operation, opencdc.OperationUpdate)
+		is.Equal(record.Payload.Before, opencdc.RawData("hi"))
+		is.Equal(record.Payload.After, opencdc.RawData("hello"))
+
+		// the header is read only if requested
+		i = &Iterator{}
+
+		record, err = i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Operation, opencdc.OperationCreate)
+		is.Equal(record.Payload.Before, nil)
+
+		// messages without the header stay create records
+		i = &Iterator{params: IteratorParams{BeforeHeader: true}}
+
+		record, err = i.messageToRecord(newMsg())
+		is.NoErr(err)
+		is.Equal(record.Operation, opencdc.OperationCreate)
+
+		msg.Header.Set("Conduit-Before", "not base64")
+		_, err = i.messageToRecord(msg)
+		is.True(err != nil)
+	})
+
+	t.Run("trace context", func(t *testing.T) {
+		is := is.New(t)
+
+		traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+		msg := newMsg()
+		msg.Header.Set("traceparent", traceparent)
+
+		i := &Iterator{params: IteratorParams{EnableTracing: true}}
+
+		record, err := i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Metadata["traceparent"], traceparent)
+
+		// the trace context is extracted only if requested
+		i = &Iterator{}
+
+		record, err = i.messageToRecord(msg)
+		is.NoErr(err)
+		_, ok := record.Metadata["traceparent"]
+		is.True(!ok)
+	})
+
+	t.Run("position contains the subject", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{}
+
+		record, err := i.messageToRecord(newMsg())
+		is.NoErr(err)
+
+		pos, err := parsePosition(record.Position)
+		is.NoErr(err)
+		is.Equal(pos, position{OptSeq: 5, ConsumerSeq: 3, NumDelivered: 1, Subject: "foo"})
+	})
+
+	t.Run("key", func(t *testing.T) {
+		tests := []struct {
+			keySource string
+			subject   string
+			want      opencdc.Data
+		}{
+			{keySource: "", subject: "orders.eu.123", want: nil},
+			{keySource: "subject", subject: "orders.eu.123", want: opencdc.RawData("orders.eu.123")},
+			{keySource: "subject.2", subject: "orders.eu.123", want: opencdc.RawData("123")},
+			{keySource: "subject.3", subject: "orders.eu.123", want: nil},
+			{keySource: "header.Trace-Id", subject: "foo", want: opencdc.RawData("abc")},
+			{keySource: "header.Missing", subject: "foo", want: nil},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.keySource, func(t *testing.T) {
+				is := is.New(t)
+
+				i := &Iterator{params: IteratorParams{KeySource: tt.keySource}}
+
+				msg := newMsg()
+				msg.Subject = tt.subject
+
+				record, err := i.messageToRecord(msg)
+				is.NoErr(err)
+				is.Equal(record.Key, tt.want)
+			})
+		}
+	})
+
+	t.Run("content type", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{}
+
+		// the payload is opaque if the message doesn't tell otherwise
+		record, err := i.messageToRecord(newMsg())
+		is.NoErr(err)
+		is.Equal(record.Metadata[internal.MetadataContentType], "application/octet-stream")
+
+		msg := newMsg()
+		msg.Header.Set("Content-Type", "application/json")
+
+		record, err = i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Metadata[internal.MetadataContentType], "application/json")
+	})
+
+	t.Run("record has the OpenCDC shape", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{}
+
+		record, err := i.messageToRecord(newMsg())
+		is.NoErr(err)
+		is.Equal(record.Operation, opencdc.OperationCreate)
+		is.Equal(record.Payload.After, opencdc.RawData("hello"))
+
+		collection, err := record.Metadata.GetCollection()
+		is.NoErr(err)
+		is.Equal(collection, "foo")
+		is.Equal(record.Metadata[internal.MetadataStream], "stream")
+	})
+
+	t.Run("subject prefix is removed", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{params: IteratorParams{SubjectPrefix: "tenant", KeySource: "subject.0"}}
+
+		msg := newMsg()
+		msg.Subject = "tenant.foo.bar"
+
+		record, err := i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Key, opencdc.RawData("foo"))
+
+		collection, err := record.Metadata.GetCollection()
+		is.NoErr(err)
+		is.Equal(collection, "foo.bar")
+		// the position holds the actual subject
+		is.True(strings.Contains(string(record.Position), `"subject":"tenant.foo.bar"`))
+	})
+
+	t.Run("legacy record format", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{params: IteratorParams{LegacyRecordFormat: true}}
+
+		record, err := i.messageToRecord(newMsg())
+		is.NoErr(err)
+		is.Equal(record.Payload.After, opencdc.RawData("hello"))
+
+		_, err = record.Metadata.GetCollection()
+		is.True(errors.Is(err, opencdc.ErrMetadataFieldNotFound))
+		_, ok := record.Metadata[internal.MetadataStream]
+		is.True(!ok)
+	})
+
+	t.Run("payload is decoded", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{params: IteratorParams{PayloadEncoding: internal.PayloadEncodingBase64}}
+
+		msg := newMsg()
+		msg.Data = []byte("aGVsbG8=")
+
+		record, err := i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Payload.After, opencdc.RawData("hello"))
+	})
+
+	t.Run("payload fails to be decoded", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{params: IteratorParams{PayloadEncoding: internal.PayloadEncodingGzip}}
+
+		_, err := i.messageToRecord(newMsg())
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), `message on subject "foo" at stream sequence 5`))
+	})
+
+	t.Run("headers only", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{params: IteratorParams{HeadersOnly: true, PayloadEncoding: internal.PayloadEncodingGzip}}
+
+		msg := newMsg()
+		msg.Data = nil
+		msg.Header.Set(nats.MsgSize, "1024")
+
+		record, err := i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Payload.After, opencdc.RawData(nil))
+		is.Equal(record.Metadata["nats.header.Trace-Id"], "abc")
+		is.Equal(record.Metadata[internal.MetadataMsgSize], "1024")
+	})
+
+	t.Run("number of deliveries is in the metadata", func(t *testing.T) {
+		is := is.New(t)
+
+		i := &Iterator{}
+
+		msg := newMsg()
+		msg.Reply = "$JS.ACK.stream.consumer.3.5.7.1700000000000000000.0"
+
+		record, err := i.messageToRecord(msg)
+		is.NoErr(err)
+		is.Equal(record.Metadata[internal.MetadataNumDelivered], "3")
+	})
+}
+
+func TestIterator_Stats(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	i := &Iterator{
+		params: IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			AckPolicy:    nats.AckExplicitPolicy,
+		},
+		unackMessages: map[uint64]*nats.Msg{},
+		messages:      make(chan *nats.Msg, 2),
+	}
+
+	i.messages <- &nats.Msg{
+		Subject: "foo",
+		Reply:   "$JS.ACK.stream.consumer.1.5.3.1700000000000000000.0",
+		Sub:     &nats.Subscription{},
+	}
+	i.messages <- &nats.Msg{
+		Subject: "foo",
+		Reply:   "$JS.ACK.stream.consumer.2.6.4.1700000000000000000.0",
+		Sub:     &nats.Subscription{},
+	}
+
+	for range 2 {
+		_, err := i.Next(ctx)
+		is.NoErr(err)
+	}
+
+	is.Equal(i.Stats(), IteratorStats{
+		MessagesReceived: 2,
+		RecordsProduced:  2,
+		Redeliveries:     1,
+		Unacked:          2,
+	})
+}
+
+func TestIterator_Lag(t *testing.T) {
+	is := is.New(t)
+
+	js := &mockJetStream{consumerInfo: &nats.ConsumerInfo{
+		NumPending:    12,
+		NumAckPending: 3,
+		Delivered:     nats.SequenceInfo{Consumer: 40, Stream: 45},
+		AckFloor:      nats.SequenceInfo{Consumer: 37, Stream: 42},
+	}}
+	i := &Iterator{jetstream: js, stream: "stream", params: IteratorParams{Durable: "durable"}}
+
+	lag, err := i.Lag(context.Background())
+	is.NoErr(err)
+	is.Equal(lag, ConsumerLag{NumPending: 12, NumAckPending: 3, DeliveredSeq: 45, AckFloorSeq: 42})
+
+	js.consumerInfo, js.consumerInfoErr = nil, nats.ErrConsumerNotFound
+
+	_, err = i.Lag(context.Background())
+	is.True(errors.Is(err, nats.ErrConsumerNotFound))
+}
+
+func TestIterator_wildcardSubject(t *testing.T) {
+	is := is.New(t)
+
+	i := &Iterator{params: IteratorParams{Subject: "orders.*"}}
+
+	// messages of several concrete subjects interleaved in the stream
+	msgs := []struct {
+		subject   string
+		streamSeq int
+	}{
+		{subject: "orders.eu", streamSeq: 10},
+		{subject: "orders.us", streamSeq: 11},
+		{subject: "orders.eu", streamSeq: 12},
+		{subject: "orders.asia", streamSeq: 14},
+	}
+
+	var last opencdc.Position
+	for n, m := range msgs {
+		record, err := i.messageToRecord(&nats.Msg{
+			Subject: m.subject,
+			Reply:   fmt.Sprintf("$JS.ACK.stream.consumer.1.%d.%d.1700000000000000000.0", m.streamSeq, n+1),
+			Sub:     &nats.Subscription{},
+		})
+		is.NoErr(err)
+
+		pos, err := parsePosition(record.Position)
+		is.NoErr(err)
+		is.Equal(pos.Subject, m.subject)
+		is.Equal(pos.OptSeq, uint64(m.streamSeq))
+		is.True(i.params.matchesFilter(pos.Subject))
+
+		last = record.Position
+	}
+
+	// stream sequences are shared by all the subjects of the stream,
+	// so resuming after the last one doesn't skip any of them
+	cfg, err := IteratorParams{
+		BufferSize:    1024,
+		Durable:       "durable",
+		Subject:       "orders.*",
+		SDKPosition:   last,
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		ConsumerType:  ConsumerTypePull,
+	}.getConsumerConfig()
+	is.NoErr(err)
+	is.Equal(cfg.DeliverPolicy, nats.DeliverByStartSequencePolicy)
+	is.Equal(cfg.OptStartSeq, uint64(15))
+	is.Equal(cfg.FilterSubject, "orders.*")
+
+	is.True(!i.params.matchesFilter("payments.eu"))
+	is.True(IteratorParams{Subject: "orders.*", FilterSubjects: []string{"orders.eu"}}.matchesFilter("orders.eu"))
+	is.True(!IteratorParams{Subject: "orders.*", FilterSubjects: []string{"orders.eu"}}.matchesFilter("orders.us"))
+}
+
+func TestIterator_WaitForNext_push(t *testing.T) {
+	is := is.New(t)
+
+	i := &Iterator{
+		params:   IteratorParams{ConsumerType: ConsumerTypePush},
+		messages: make(chan *nats.Msg, 1),
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		i.messages <- &nats.Msg{
+			Subject: "foo",
+			Reply:   "$JS.ACK.stream.consumer.1.5.3.1700000000000000000.0",
+			Sub:     &nats.Subscription{},
+		}
+	}()
+
+	// blocks until the message arrives
+	is.NoErr(i.WaitForNext(context.Background()))
+	is.Equal(len(i.messages), 0)
+
+	// the received message is still available once the ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	is.NoErr(i.WaitForNext(ctx))
+
+	record, err := i.Next(context.Background())
+	is.NoErr(err)
+	is.Equal(record.Metadata[internal.MetadataStream], "stream")
+
+	err = i.WaitForNext(ctx)
+	is.True(errors.Is(err, context.Canceled))
+}
+
+func TestIterator_WaitForNext_consumerDeleted(t *testing.T) {
+	newIterator := func(js *mockJetStream) *Iterator {
+		return &Iterator{
+			jetstream:     js,
+			stream:        "stream",
+			params:        IteratorParams{ConsumerType: ConsumerTypePush, Durable: "durable"},
+			messages:      make(chan *nats.Msg),
+			checkInterval: 10 * time.Millisecond,
+		}
+	}
+
+	t.Run("consumer exists", func(t *testing.T) {
+		is := is.New(t)
+
+		i := newIterator(&mockJetStream{consumerInfo: &nats.ConsumerInfo{}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		// keeps waiting for messages
+		is.True(errors.Is(i.WaitForNext(ctx), context.DeadlineExceeded))
+	})
+
+	t.Run("consumer is deleted", func(t *testing.T) {
+		is := is.New(t)
+
+		i := newIterator(&mockJetStream{consumerInfoErr: nats.ErrConsumerNotFound})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		err := i.WaitForNext(ctx)
+		is.True(errors.Is(err, ErrConsumerDeleted))
+		is.True(time.Since(start) < time.Second)
+
+		// the error isn't retried by the source
+		_, err = (&Source{iterator: i}).Read(ctx)
+		is.True(errors.Is(err, ErrConsumerDeleted))
+		is.True(!errors.Is(err, sdk.ErrBackoffRetry))
+	})
+}
+
+func TestIteratorParams_matchesMessage(t *testing.T) {
+	msg := &nats.Msg{
+		Subject: "tenant.orders.eu.created",
+		Header:  nats.Header{"Type": []string{"order", "v2"}},
+	}
+
+	tests := []struct {
+		name   string
+		params IteratorParams
+		want   bool
+	}{
+		{
+			name: "no predicate",
+			want: true,
+		},
+		{
+			name:   "subject",
+			params: IteratorParams{SubjectPrefix: "tenant", MatchSubject: "orders.*.created"},
+			want:   true,
+		},
+		{
+			name:   "subject doesn't match",
+			params: IteratorParams{SubjectPrefix: "tenant", MatchSubject: "orders.*.deleted"},
+		},
+		{
+			name:   "header value",
+			params: IteratorParams{MatchHeader: "Type=v2"},
+			want:   true,
+		},
+		{
+			name:   "header value doesn't match",
+			params: IteratorParams{MatchHeader: "Type=v1"},
+		},
+		{
+			name:   "header presence",
+			params: IteratorParams{MatchHeader: "Type"},
+			want:   true,
+		},
+		{
+			name:   "header is missing",
+			params: IteratorParams{MatchHeader: "type"},
+		},
+		{
+			name:   "subject and header",
+			params: IteratorParams{MatchSubject: "tenant.>", MatchHeader: "Type=order"},
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(tt.params.matchesMessage(msg), tt.want)
+		})
+	}
+}
+
+func TestIteratorParams_matchesMessage_maxMessageAge(t *testing.T) {
+	is := is.New(t)
+
+	// the reply subject of a JetStream message holds its timestamp in nanoseconds
+	jetStreamMsg := func(timestamp time.Time) *nats.Msg {
+		return &nats.Msg{
+			Subject: "foo",
+			Reply:   fmt.Sprintf("$JS.ACK.stream.consumer.1.1.1.%d.0", timestamp.UnixNano()),
+			Sub:     &nats.Subscription{},
+		}
+	}
+
+	params := IteratorParams{MaxMessageAge: time.Hour}
+	is.True(params.matchesMessage(jetStreamMsg(time.Now().Add(-time.Minute))))
+	is.True(!params.matchesMessage(jetStreamMsg(time.Now().Add(-2 * time.Hour))))
+
+	// the age of a message without metadata is unknown
+	is.True(params.matchesMessage(&nats.Msg{Subject: "foo"}))
+
+	// the age isn't checked if the MaxMessageAge is zero
+	is.True(IteratorParams{}.matchesMessage(jetStreamMsg(time.Now().Add(-2 * time.Hour))))
+}
+
+func TestIterator_skipsUnmatchedMessages(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	server := startTestServer(t)
+
+	nc, err := nats.Connect(server.addr)
+	is.NoErr(err)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	is.NoErr(err)
+
+	i := &Iterator{
+		params: IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			AckPolicy:    nats.AckExplicitPolicy,
+			MatchHeader:  "Type=order",
+		},
+		messages:      make(chan *nats.Msg, 2),
+		unackMessages: make(map[uint64]*nats.Msg),
+	}
+
+	i.messages <- &nats.Msg{
+		Subject: "foo",
+		Header:  nats.Header{"Type": []string{"invoice"}},
+		Reply:   "$JS.ACK.stream.consumer.1.1.1.1700000000000000000.1",
+		Sub:     sub,
+	}
+	i.messages <- &nats.Msg{
+		Subject: "foo",
+		Header:  nats.Header{"Type": []string{"order"}},
+		Reply:   "$JS.ACK.stream.consumer.1.2.2.1700000000000000000.0",
+		Sub:     sub,
+	}
+
+	is.NoErr(i.WaitForNext(ctx))
+
+	record, err := i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(record.Position, opencdc.Position(`{"opt_seq":2,"consumer_seq":2,"num_delivered":1,"subject":"foo"}`))
+
+	// the skipped message is acknowledged right away
+	is.NoErr(nc.Flush())
+	is.Equal(server.published(), []string{"$JS.ACK.stream.consumer.1.1.1.1700000000000000000.1 +ACK"})
+	is.Equal(i.Stats().Skipped, uint64(1))
+	is.Equal(i.Stats().MessagesReceived, uint64(2))
+	is.Equal(i.Stats().Unacked, 1)
+}
+
+func TestIterator_checkPositionGap(t *testing.T) {
+	tests := []struct {
+		name     string
+		firstSeq uint64
+		want     uint64
+	}{
+		{name: "next message exists", firstSeq: 1},
+		{name: "stream starts right after the position", firstSeq: 11},
+		{name: "messages were removed", firstSeq: 15, want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			js := &mockJetStream{streamInfo: &nats.StreamInfo{State: nats.StreamState{FirstSeq: tt.firstSeq}}}
+			i := &Iterator{jetstream: js, stream: "stream"}
+
+			i.checkPositionGap(context.Background(), 10)
+			is.Equal(i.positionGap, tt.want)
+		})
+	}
+
+	t.Run("stream info fails", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{streamInfoErr: nats.ErrStreamNotFound}
+		i := &Iterator{jetstream: js, stream: "stream"}
+
+		i.checkPositionGap(context.Background(), 10)
+		is.Equal(i.positionGap, uint64(0))
+	})
+}
+
+func TestIterator_Next_positionGap(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	i := &Iterator{
+		params: IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			AckPolicy:    nats.AckNonePolicy,
+		},
+		messages:    make(chan *nats.Msg, 2),
+		positionGap: 4,
+	}
+
+	for _, seq := range []string{"15", "16"} {
+		i.messages <- &nats.Msg{
+			Subject: "foo",
+			Reply:   "$JS.ACK.stream.consumer.1." + seq + ".1.1700000000000000000.0",
+			Sub:     &nats.Subscription{},
+		}
+	}
+
+	// only the first record after the gap reports it
+	record, err := i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(record.Metadata[internal.MetadataPositionGap], "4")
+
+	record, err = i.Next(ctx)
+	is.NoErr(err)
+	_, ok := record.Metadata[internal.MetadataPositionGap]
+	is.True(!ok)
+}
+
+func TestIterator_Stop_deleteConsumer(t *testing.T) {
+	tests := []struct {
+		name      string
+		deleteErr error
+		wantErr   error
+	}{
+		{name: "consumer is deleted"},
+		// the consumer may be shared with another connector, which deleted it first
+		{name: "consumer doesn't exist", deleteErr: nats.ErrConsumerNotFound},
+		{name: "delete fails", deleteErr: nats.ErrTimeout, wantErr: nats.ErrTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			server := startTestServer(t)
+
+			nc, err := nats.Connect(server.addr)
+			is.NoErr(err)
+			defer nc.Close()
+
+			sub, err := nc.SubscribeSync("foo")
+			is.NoErr(err)
+
+			js := &mockJetStream{deleteConsumerErr: tt.deleteErr}
+			i := &Iterator{
+				params: IteratorParams{
+					Durable:              "durable",
+					ConsumerType:         ConsumerTypePull,
+					AckPolicy:            nats.AckExplicitPolicy,
+					DeleteConsumerOnStop: true,
+				},
+				jetstream:     js,
+				stream:        "stream",
+				subscription:  sub,
+				unackMessages: map[uint64]*nats.Msg{},
+			}
+
+			err = i.Stop()
+			is.True(errors.Is(err, tt.wantErr))
+			is.Equal(js.deletedConsumer, "durable")
+		})
+	}
+}
+
+func TestIterator_Stop_naksBufferedMessages(t *testing.T) {
+	is := is.New(t)
+
+	server := startTestServer(t)
+
+	nc, err := nats.Connect(server.addr)
+	is.NoErr(err)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	is.NoErr(err)
+
+	newMsg := func(seq int) *nats.Msg {
+		return &nats.Msg{
+			Subject: "foo",
+			Reply:   fmt.Sprintf("$JS.ACK.stream.consumer.1.%d.%d.1700000000000000000.0", seq, seq),
+			Sub:     sub,
+		}
+	}
+
+	i := &Iterator{
+		params: IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			AckPolicy:    nats.AckExplicitPolicy,
+		},
+		subscription:  sub,
+		unackMessages: map[uint64]*nats.Msg{},
+		messages:      make(chan *nats.Msg, 3),
+	}
+
+	// fill the buffer and read one of the messages, so it awaits an acknowledgement
+	for seq := range 3 {
+		i.messages <- newMsg(seq + 1)
+	}
+	_, err = i.Next(context.Background())
+	is.NoErr(err)
+
+	is.NoErr(i.Stop())
+	is.NoErr(nc.Flush())
+
+	// all the messages are negatively acknowledged, so the server redelivers them
+	is.Equal(server.published(), []string{
+		"$JS.ACK.stream.consumer.1.2.2.1700000000000000000.0 -NAK",
+		"$JS.ACK.stream.consumer.1.3.3.1700000000000000000.0 -NAK",
+		"$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 -NAK",
+	})
+	is.Equal(i.Stats().Naks, uint64(3))
+	is.Equal(i.Stats().Unacked, 0)
+	is.Equal(len(i.messages), 0)
+}
+
+func TestIterator_Stop_unsubscribeFails(t *testing.T) {
+	is := is.New(t)
+
+	server := startTestServer(t)
+
+	nc, err := nats.Connect(server.addr)
+	is.NoErr(err)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	is.NoErr(err)
+
+	deletesSub, err := nc.SubscribeSync("deletes")
+	is.NoErr(err)
+
+	// unsubscribing a second time fails
+	unsubscribed, err := nc.SubscribeSync("foo")
+	is.NoErr(err)
+	is.NoErr(unsubscribed.Unsubscribe())
+
+	newMsg := func(seq int) *nats.Msg {
+		return &nats.Msg{
+			Subject: "foo",
+			Reply:   fmt.Sprintf("$JS.ACK.stream.consumer.1.%d.%d.1700000000000000000.0", seq, seq),
+			Sub:     sub,
+		}
+	}
+
+	i := &Iterator{
+		params: IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			AckPolicy:    nats.AckExplicitPolicy,
+		},
+		subscription:        unsubscribed,
+		unackMessages:       map[uint64]*nats.Msg{1: newMsg(1)},
+		messages:            make(chan *nats.Msg, 1),
+		deletesSubscription: deletesSub,
+		deletesDone:         make(chan struct{}),
+	}
+	i.messages <- newMsg(2)
+
+	err = i.Stop()
+	is.True(errors.Is(err, nats.ErrBadSubscription))
+	is.NoErr(nc.Flush())
+
+	// the messages are negatively acknowledged and the deletes are stopped anyway
+	is.Equal(server.published(), []string{
+		"$JS.ACK.stream.consumer.1.2.2.1700000000000000000.0 -NAK",
+		"$JS.ACK.stream.consumer.1.1.1.1700000000000000000.0 -NAK",
+	})
+	is.Equal(i.Stats().Naks, uint64(2))
+	is.True(!deletesSub.IsValid())
+
+	_, open := <-i.deletesDone
+	is.True(!open)
+}
+
+func TestIterator_detach(t *testing.T) {
+	is := is.New(t)
+
+	server := startTestServer(t)
+
+	nc, err := nats.Connect(server.addr)
+	is.NoErr(err)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	is.NoErr(err)
+
+	newMsg := func(seq int) *nats.Msg {
+		return &nats.Msg{
+			Subject: "foo",
+			Reply:   fmt.Sprintf("$JS.ACK.stream.consumer.1.%d.%d.1700000000000000000.0", seq, seq),
+			Sub:     sub,
+		}
+	}
+
+	i := &Iterator{
+		nc: &mockNATSClient{},
+		params: IteratorParams{
+			ConsumerType: ConsumerTypePull,
+			AckPolicy:    nats.AckExplicitPolicy,
+		},
+		subscription:  sub,
+		unackMessages: map[uint64]*nats.Msg{1: newMsg(1)},
+		fetched:       []*nats.Msg{newMsg(2), newMsg(3)},
+		detached:      make(chan struct{}),
+	}
+
+	is.NoErr(i.detach())
+	is.NoErr(nc.Flush())
+
+	// the fetched messages are negatively acknowledged, while the ones awaiting
+	// an acknowledgement are kept for the replacing iterator
+	is.Equal(server.published(), []string{
+		"$JS.ACK.stream.consumer.1.2.2.1700000000000000000.0 -NAK",
+		"$JS.ACK.stream.consumer.1.3.3.1700000000000000000.0 -NAK",
+	})
+	is.Equal(i.Stats().Naks, uint64(2))
+	is.Equal(len(i.fetched), 0)
+	is.Equal(len(i.unackMessages), 1)
+	is.True(!sub.IsValid())
+	is.True(!i.HasNext(context.Background()))
+
+	// detaching again is a no-op
+	is.NoErr(i.detach())
+}
+
+func TestIterator_closed(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	i := &Iterator{
+		nc: &mockNATSClient{},
+		params: IteratorParams{
+			ConsumerType: ConsumerTypePush,
+			AckPolicy:    nats.AckExplicitPolicy,
+		},
+		unackMessages: map[uint64]*nats.Msg{},
+		messages:      make(chan *nats.Msg, 1),
+	}
+
+	// acknowledgements racing with Stop either fail to find the message or see the closed iterator
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				_ = i.Ack(ctx, opencdc.Position(`{"opt_seq":1}`))
+				_ = i.Nak(ctx, opencdc.Position(`{"opt_seq":1}`))
+			}
+		}()
+	}
+
+	is.NoErr(i.Stop())
+	wg.Wait()
+
+	// stopping again is a no-op
+	is.NoErr(i.Stop())
+
+	is.True(errors.Is(i.Ack(ctx, opencdc.Position(`{"opt_seq":1}`)), ErrIteratorClosed))
+	is.True(errors.Is(i.Nak(ctx, opencdc.Position(`{"opt_seq":1}`)), ErrIteratorClosed))
+	is.True(!i.HasNext(ctx))
+	is.True(errors.Is(i.WaitForNext(ctx), ErrIteratorClosed))
+
+	_, err := i.Next(ctx)
+	is.True(errors.Is(err, ErrIteratorClosed))
+}
+
+// testServer speaks just enough of the NATS protocol to let a client connect
+// and records the messages published to it. Requests are answered with an empty
+// reply unless noReplies is set.
+type testServer struct {
+	addr string
+
+	mu        sync.Mutex
+	msgs      []string
+	noReplies bool
+}
+
+// startTestServer starts a testServer and returns it.
+func startTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &testServer{addr: ln.Addr().String()}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	_, _ = conn.Write([]byte(`INFO {"server_id":"test","version":"2.10.0","max_payload":1048576}` + "\r\n"))
+
+	// subscription IDs by subject
+	subs := make(map[string]string)
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			_, _ = conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "SUB "):
+			fields := strings.Fields(line)
+			subs[fields[1]] = fields[len(fields)-1]
+		case strings.HasPrefix(line, "PUB "):
+			// the payload follows on the next line
+			fields := strings.Fields(line)
+			scanner.Scan()
+
+			s.mu.Lock()
+			s.msgs = append(s.msgs, fields[1]+" "+scanner.Text())
+			noReplies := s.noReplies
+			s.mu.Unlock()
+
+			// a request carries the reply subject, which the client is subscribed to with a wildcard
+			if len(fields) == 4 && !noReplies {
+				reply := fields[2]
+				for subject, sid := range subs {
+					if prefix, ok := strings.CutSuffix(subject, "*"); ok && strings.HasPrefix(reply, prefix) {
+						_, _ = fmt.Fprintf(conn, "MSG %s %s 0\r\n\r\n", reply, sid)
+					}
+				}
+			}
+		}
+	}
+}
+
+// published returns the published messages in the form of "<subject> <payload>".
+func (s *testServer) published() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.msgs)
+}
+
+func TestIterator_checkConsumer(t *testing.T) {
+	t.Run("consumer doesn't exist", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{consumerInfoErr: nats.ErrConsumerNotFound}
+		i := &Iterator{
+			jetstream: js,
+			stream:    "stream",
+			params:    IteratorParams{Durable: "durable", ConsumerType: ConsumerTypePull},
+		}
+
+		err := i.checkConsumer(context.Background())
+		is.True(errors.Is(err, nats.ErrConsumerNotFound))
+		is.True(strings.Contains(err.Error(), `consumer "durable" doesn't exist in stream "stream"`))
+		// the consumer is never created
+		is.Equal(js.addedConsumer, nil)
+	})
+
+	t.Run("consumer exists", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{consumerInfo: &nats.ConsumerInfo{
+			Config: nats.ConsumerConfig{Durable: "durable", DeliverSubject: "deliver"},
+		}}
+		i := &Iterator{
+			jetstream: js,
+			stream:    "stream",
+			params:    IteratorParams{Durable: "durable", ConsumerType: ConsumerTypePush},
+		}
+
+		is.NoErr(i.checkConsumer(context.Background()))
+		is.Equal(js.addedConsumer, nil)
+
+		// a push consumer can't be bound to as a pull consumer
+		i.params.ConsumerType = ConsumerTypePull
+		is.True(i.checkConsumer(context.Background()) != nil)
+	})
+}
+
+func TestIterator_ensureConsumer(t *testing.T) {
+	requested := &nats.ConsumerConfig{
+		Durable:       "durable",
+		DeliverPolicy: nats.DeliverByStartSequencePolicy,
+		OptStartSeq:   10,
+		AckPolicy:     nats.AckExplicitPolicy,
+		ReplayPolicy:  nats.ReplayInstantPolicy,
+		FilterSubject: "foo",
+		MaxWaiting:    1024,
+	}
+
+	t.Run("consumer doesn't exist", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{consumerInfoErr: nats.ErrConsumerNotFound}
+		i := &Iterator{jetstream: js, stream: "stream"}
+
+		is.NoErr(i.ensureConsumer(context.Background(), requested))
+		is.Equal(js.addedConsumer, requested)
+	})
+
+	t.Run("matching consumer exists", func(t *testing.T) {
+		is := is.New(t)
+
+		existing := *requested
+		// the start position and server defaults don't have to match
+		existing.DeliverPolicy = nats.DeliverAllPolicy
+		existing.OptStartSeq = 0
+		existing.AckWait = 30 * time.Second
+		existing.MaxDeliver = -1
+
+		js := &mockJetStream{consumerInfo: &nats.ConsumerInfo{Config: existing}}
+		i := &Iterator{jetstream: js, stream: "stream"}
+
+		is.NoErr(i.ensureConsumer(context.Background(), requested))
+		is.Equal(js.addedConsumer, nil)
+	})
+
+	t.Run("different consumer exists", func(t *testing.T) {
+		is := is.New(t)
+
+		existing := *requested
+		existing.FilterSubject = "bar"
+
+		js := &mockJetStream{consumerInfo: &nats.ConsumerInfo{Config: existing}}
+		i := &Iterator{jetstream: js, stream: "stream"}
+
+		err := i.ensureConsumer(context.Background(), requested)
+		is.True(err != nil)
+		is.Equal(err.Error(),
+			`consumer "durable" already exists with a different config, mismatched fields: FilterSubject`)
+		is.Equal(js.addedConsumer, nil)
+	})
+
+	t.Run("reset on start", func(t *testing.T) {
+		is := is.New(t)
+
+		existing := *requested
+		existing.FilterSubject = "bar"
+
+		js := &mockJetStream{consumerInfo: &nats.ConsumerInfo{Config: existing}}
+		i := &Iterator{jetstream: js, stream: "stream", params: IteratorParams{ResetOnStart: true}}
+
+		is.NoErr(i.ensureConsumer(context.Background(), requested))
+		is.Equal(js.deletedConsumer, "durable")
+		is.Equal(js.addedConsumer, requested)
+	})
+
+	t.Run("reset on start, consumer doesn't exist", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{consumerInfoErr: nats.ErrConsumerNotFound}
+		i := &Iterator{jetstream: js, stream: "stream", params: IteratorParams{ResetOnStart: true}}
+
+		is.NoErr(i.ensureConsumer(context.Background(), requested))
+		is.Equal(js.deletedConsumer, "")
+		is.Equal(js.addedConsumer, requested)
+	})
+}
+
+func TestNewIterator_resetOnStart(t *testing.T) {
+	is := is.New(t)
+
+	sdkPosition, err := position{OptSeq: 42}.marshalSDKPosition()
+	is.NoErr(err)
+
+	js := &mockJetStream{
+		stream:       "stream",
+		consumerInfo: &nats.ConsumerInfo{Config: nats.ConsumerConfig{Durable: "durable"}},
+	}
+	i, err := NewIterator(context.Background(), &mockNATSClient{js: js}, IteratorParams{
+		Durable:        "durable",
+		DeliverSubject: "durable.conduit",
+		Subject:        "foo",
+		SDKPosition:    sdkPosition,
+		DeliverPolicy:  nats.DeliverLastPolicy,
+		AckPolicy:      nats.AckExplicitPolicy,
+		ConsumerType:   ConsumerTypePush,
+		ResetOnStart:   true,
+	})
+	is.NoErr(err)
+
+	is.Equal(js.deletedConsumer, "durable")
+	is.Equal(js.addedConsumer.DeliverPolicy, nats.DeliverAllPolicy)
+	is.Equal(js.addedConsumer.OptStartSeq, uint64(0))
+	is.Equal(i.lastSeq.Load(), uint64(0))
+
+	// a re-created Iterator continues where this one left off
+	is.True(!i.resumeParams().ResetOnStart)
+
+	_, err = NewIterator(context.Background(), &mockNATSClient{js: js}, IteratorParams{
+		Durable:      "durable",
+		Subject:      "foo",
+		ResetOnStart: true,
+		BindOnly:     true,
+	})
+	is.Equal(err.Error(), "reset on start can't be combined with bind only")
+}
+
+func TestValidateIterator(t *testing.T) {
+	params := IteratorParams{
+		Stream:       "stream",
+		Durable:      "durable",
+		Subject:      "foo.bar",
+		AckPolicy:    nats.AckExplicitPolicy,
+		ConsumerType: ConsumerTypePull,
+	}
+	streamInfo := &nats.StreamInfo{Config: nats.StreamConfig{Name: "stream", Subjects: []string{"foo.*"}}}
+
+	tests := []struct {
+		name    string
+		params  func(p IteratorParams) IteratorParams
+		js      *mockJetStream
+		wantErr string
+	}{
+		{
+			name: "consumer doesn't exist",
+			js: &mockJetStream{
+				stream:          "stream",
+				streamInfo:      streamInfo,
+				consumerInfoErr: nats.ErrConsumerNotFound,
+			},
+		},
+		{
+			name: "compatible consumer",
+			js: &mockJetStream{
+				stream:     "stream",
+				streamInfo: streamInfo,
+				consumerInfo: &nats.ConsumerInfo{Config: nats.ConsumerConfig{
+					Durable:       "durable",
+					AckPolicy:     nats.AckExplicitPolicy,
+					FilterSubject: "foo.bar",
+					MaxWaiting:    defaultBufferSize,
+				}},
+			},
+		},
+		{
+			name: "incompatible consumer",
+			js: &mockJetStream{
+				stream:     "stream",
+				streamInfo: streamInfo,
+				consumerInfo: &nats.ConsumerInfo{Config: nats.ConsumerConfig{
+					Durable:        "durable",
+					AckPolicy:      nats.AckAllPolicy,
+					FilterSubject:  "foo.bar",
+					DeliverSubject: "durable.conduit",
+				}},
+			},
+			wantErr: `validate: consumer "durable" already exists with a different config, ` +
+				"mismatched fields: AckPolicy, DeliverSubject, MaxWaiting, " +
+				"delete the consumer or use another durable name",
+		},
+		{
+			name: "incompatible consumer is reset",
+			params: func(p IteratorParams) IteratorParams {
+				p.ResetOnStart = true
+
+				return p
+			},
+			js: &mockJetStream{
+				stream:       "stream",
+				streamInfo:   streamInfo,
+				consumerInfo: &nats.ConsumerInfo{Config: nats.ConsumerConfig{AckPolicy: nats.AckAllPolicy}},
+			},
+		},
+		{
+			name: "no stream captures the subject",
+			js:   &mockJetStream{streamErr: nats.ErrNoMatchingStream},
+			wantErr: `validate: no stream captures the subject "foo.bar", ` +
+				"create the stream or enable auto-creating it: " + nats.ErrNoMatchingStream.Error(),
+		},
+		{
+			name: "stream is auto-created",
+			params: func(p IteratorParams) IteratorParams {
+				p.AutoCreateStream = true
+
+				return p
+			},
+			js: &mockJetStream{streamErr: nats.ErrNoMatchingStream, streamInfoErr: nats.ErrStreamNotFound},
+		},
+		{
+			name: "auto-created stream exists",
+			params: func(p IteratorParams) IteratorParams {
+				p.AutoCreateStream = true
+
+				return p
+			},
+			js:      &mockJetStream{streamErr: nats.ErrNoMatchingStream, streamInfo: streamInfo},
+			wantErr: `validate: stream "stream" exists, but doesn't capture the subject "foo.bar"`,
+		},
+		{
+			name: "subject is partially captured",
+			params: func(p IteratorParams) IteratorParams {
+				p.Subject = "foo.>"
+
+				return p
+			},
+			js: &mockJetStream{stream: "stream", streamInfo: streamInfo},
+			wantErr: `validate: subject "foo.>" is only partially captured ` +
+				`by the stream "stream" with the subjects ["foo.*"]`,
+		},
+		{
+			name: "filter subject isn't captured",
+			params: func(p IteratorParams) IteratorParams {
+				p.FilterSubjects = []string{"foo.bar", "bar.baz"}
+
+				return p
+			},
+			js: &mockJetStream{stream: "stream", streamInfo: streamInfo},
+			wantErr: `validate: subject "bar.baz" is only partially captured ` +
+				`by the stream "stream" with the subjects ["foo.*"]`,
+		},
+		{
+			name: "bound consumer doesn't exist",
+			params: func(p IteratorParams) IteratorParams {
+				p.BindOnly = true
+
+				return p
+			},
+			js: &mockJetStream{
+				stream:          "stream",
+				streamInfo:      streamInfo,
+				consumerInfoErr: nats.ErrConsumerNotFound,
+			},
+			wantErr: `validate: consumer "durable" doesn't exist in stream "stream", ` +
+				"it must be created before binding to it: " + nats.ErrConsumerNotFound.Error(),
+		},
+		{
+			name: "ordered consumer isn't looked up",
+			params: func(p IteratorParams) IteratorParams {
+				p.Ordered = true
+
+				return p
+			},
+			js: &mockJetStream{
+				stream:       "stream",
+				streamInfo:   streamInfo,
+				consumerInfo: &nats.ConsumerInfo{Config: nats.ConsumerConfig{AckPolicy: nats.AckAllPolicy}},
+			},
+		},
+		{
+			name: "invalid params",
+			params: func(p IteratorParams) IteratorParams {
+				p.BufferSize = -1
+
+				return p
+			},
+			js:      &mockJetStream{},
+			wantErr: "validate: buffer size -1 can't be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			p := params
+			if tt.params != nil {
+				p = tt.params(p)
+			}
+
+			err := ValidateIterator(context.Background(), &mockNATSClient{js: tt.js}, p)
+			if tt.wantErr == "" {
+				is.NoErr(err)
+			} else {
+				is.True(err != nil)
+				is.Equal(err.Error(), tt.wantErr)
+			}
+
+			// nothing is created or deleted
+			is.Equal(tt.js.addedStream, nil)
+			is.Equal(tt.js.addedConsumer, nil)
+			is.Equal(tt.js.deletedConsumer, "")
+		})
+	}
+}
+
+func TestIterator_createStream(t *testing.T) {
+	params := IteratorParams{
+		Stream:                  "stream",
+		Subject:                 "foo",
+		StreamSubjects:          []string{"bar", "foo"},
+		StreamRetention:         nats.WorkQueuePolicy,
+		StreamStorage:           nats.MemoryStorage,
+		StreamMaxAge:            time.Hour,
+		StreamDuplicateWindow:   5 * time.Minute,
+		StreamMaxMsgsPerSubject: 10,
+		StreamMaxBytes:          1 << 20,
+	}
+
+	t.Run("stream doesn't exist", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{streamInfoErr: nats.ErrStreamNotFound}
+		i := &Iterator{jetstream: js, params: params}
+
+		stream, err := i.createStream(context.Background())
+		is.NoErr(err)
+		is.Equal(stream, "stream")
+		is.Equal(js.addedStream, &nats.StreamConfig{
+			Name:              "stream",
+			Subjects:          []string{"foo", "bar"},
+			Retention:         nats.WorkQueuePolicy,
+			Storage:           nats.MemoryStorage,
+			MaxAge:            time.Hour,
+			Duplicates:        5 * time.Minute,
+			MaxMsgsPerSubject: 10,
+			MaxBytes:          1 << 20,
+		})
+	})
+
+	t.Run("stream exists", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{streamInfo: &nats.StreamInfo{}}
+		i := &Iterator{jetstream: js, params: params}
+
+		_, err := i.createStream(context.Background())
+		is.True(errors.Is(err, nats.ErrNoMatchingStream))
+		is.Equal(js.addedStream, nil)
+	})
+}
+
+func TestIterator_validateFilterSubjects(t *testing.T) {
+	js := &mockJetStream{streamInfo: &nats.StreamInfo{
+		Config: nats.StreamConfig{Subjects: []string{"orders.*", "payments.>"}},
+	}}
+
+	tests := []struct {
+		name           string
+		filterSubjects []string
+		wantErr        bool
+	}{
+		{
+			name:           "captured subjects",
+			filterSubjects: []string{"orders.created", "orders.*", "payments.eu.>", "payments.us"},
+		},
+		{
+			name:           "subject not captured",
+			filterSubjects: []string{"orders.created", "refunds.created"},
+			wantErr:        true,
+		},
+		{
+			name:           "wildcard wider than the stream subject",
+			filterSubjects: []string{"orders.>"},
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			i := &Iterator{
+				jetstream: js,
+				stream:    "stream",
+				params:    IteratorParams{FilterSubjects: tt.filterSubjects},
+			}
+
+			err := i.validateFilterSubjects(context.Background())
+			is.Equal(err != nil, tt.wantErr)
+		})
+	}
+}
+
+func TestNewIterator_invalidSubject(t *testing.T) {
+	is := is.New(t)
+
+	js := &mockJetStream{stream: "stream"}
+	_, err := NewIterator(context.Background(), &mockNATSClient{js: js}, IteratorParams{
+		BufferSize:     1024,
+		Durable:        "durable",
+		Subject:        "foo.>",
+		FilterSubjects: []string{"foo.bar", "foo. baz"},
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		AckPolicy:      nats.AckExplicitPolicy,
+		ConsumerType:   ConsumerTypePull,
+	})
+	is.True(errors.Is(err, internal.ErrInvalidSubject))
+	is.Equal(js.chanSubscribed, "")
+}
+
+func TestNewIterator_ordered(t *testing.T) {
+	is := is.New(t)
+
+	js := &mockJetStream{stream: "stream"}
+	i, err := NewIterator(context.Background(), &mockNATSClient{js: js}, IteratorParams{
+		BufferSize:    1024,
+		Durable:       "durable",
+		Subject:       "foo",
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		ConsumerType:  ConsumerTypePull,
+		Ordered:       true,
+	})
+	is.NoErr(err)
+
+	is.Equal(i.params.ConsumerType, ConsumerTypePush)
+	is.Equal(i.params.AckPolicy, nats.AckNonePolicy)
+	// the consumer is created by the NATS client
+	is.Equal(js.addedConsumer, nil)
+	is.Equal(js.chanSubscribed, "foo")
+
+	// acknowledgements are no-ops
+	is.NoErr(i.Ack(context.Background(), opencdc.Position(`{"opt_seq":1}`)))
+	is.NoErr(i.Nak(context.Background(), opencdc.Position(`{"opt_seq":1}`)))
+
+	// the position holds the stream sequence
+	record, err := i.messageToRecord(&nats.Msg{
+		Subject: "foo",
+		Reply:   "$JS.ACK.stream.consumer.1.42.3.1700000000000000000.0",
+		Sub:     &nats.Subscription{},
+	})
+	is.NoErr(err)
+	is.Equal(record.Position, opencdc.Position(`{"opt_seq":42,"consumer_seq":3,"num_delivered":1,"subject":"foo"}`))
+}
+
+func TestNewIterator_bufferSize(t *testing.T) {
+	params := IteratorParams{
+		Durable:       "durable",
+		Subject:       "foo",
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		ConsumerType:  ConsumerTypePull,
+		Ordered:       true,
+	}
+
+	t.Run("default", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{stream: "stream"}
+		i, err := NewIterator(context.Background(), &mockNATSClient{js: js}, params)
+		is.NoErr(err)
+
+		is.Equal(i.params.BufferSize, defaultBufferSize)
+		is.Equal(cap(i.messages), defaultBufferSize)
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		is := is.New(t)
+
+		params := params
+		params.BufferSize = -1
+
+		js := &mockJetStream{stream: "stream"}
+		_, err := NewIterator(context.Background(), &mockNATSClient{js: js}, params)
+		is.Equal(err.Error(), "buffer size -1 can't be negative")
+		is.Equal(js.chanSubscribed, "")
+	})
+}
+
+func TestNewIterator_fetch(t *testing.T) {
+	params := IteratorParams{
+		Durable:       "durable",
+		Subject:       "foo",
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		ConsumerType:  ConsumerTypePull,
+		Ordered:       true,
+	}
+
+	t.Run("default", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{stream: "stream"}
+		i, err := NewIterator(context.Background(), &mockNATSClient{js: js}, params)
+		is.NoErr(err)
+
+		is.Equal(i.params.FetchBatchSize, defaultFetchBatchSize)
+		is.Equal(i.params.FetchMaxWait, defaultFetchMaxWait)
+	})
+
+	t.Run("negative batch size", func(t *testing.T) {
+		is := is.New(t)
+
+		params := params
+		params.FetchBatchSize = -1
+
+		_, err := NewIterator(context.Background(), &mockNATSClient{js: &mockJetStream{stream: "stream"}}, params)
+		is.Equal(err.Error(), "fetch batch size -1 can't be negative")
+	})
+
+	t.Run("negative max wait", func(t *testing.T) {
+		is := is.New(t)
+
+		params := params
+		params.FetchMaxWait = -time.Second
+
+		_, err := NewIterator(context.Background(), &mockNATSClient{js: &mockJetStream{stream: "stream"}}, params)
+		is.Equal(err.Error(), "fetch max wait -1s can't be negative")
+	})
+}
+
+func TestIsFetchTimeout(t *testing.T) {
+	is := is.New(t)
+
+	is.True(isFetchTimeout(nats.ErrTimeout))
+	is.True(isFetchTimeout(fmt.Errorf("fetch: %w", context.DeadlineExceeded)))
+	is.True(!isFetchTimeout(nil))
+	is.True(!isFetchTimeout(nats.ErrConsumerDeleted))
+	is.True(!isFetchTimeout(context.Canceled))
+}
+
+// mockNATSClient implements internal.NATSClient returning the js as the JetStream context.
+type mockNATSClient struct {
+	internal.NATSClient
+
+	js *mockJetStream
+	// handler is the handler of the last core NATS subscription.
+	handler nats.MsgHandler
+	// queueGroup is the queue group of the last core NATS subscription.
+	queueGroup string
+}
+
+func (m *mockNATSClient) JetStream(...nats.JSOpt) (nats.JetStreamContext, error) {
+	return m.js, nil
+}
+
+func (m *mockNATSClient) Subscribe(_ string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	m.handler = handler
+
+	return &nats.Subscription{}, nil
+}
+
+func (m *mockNATSClient) IsClosed() bool {
+	return false
+}
+
+func (m *mockNATSClient) QueueSubscribe(_, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	m.handler = handler
+	m.queueGroup = queue
+
+	return &nats.Subscription{}, nil
+}
+
+// mockJetStream implements the JetStream context methods used by tests,
+// calling any other method panics.
+type mockJetStream struct {
+	nats.JetStreamContext
+
+	stream         string
+	streamErr      error
+	chanSubscribed string
+
+	consumerInfo      *nats.ConsumerInfo
+	consumerInfoErr   error
+	addedConsumer     *nats.ConsumerConfig
+	deletedConsumer   string
+	deleteConsumerErr error
+	streamInfo        *nats.StreamInfo
+	streamInfoErr     error
+	addedStream       *nats.StreamConfig
+	kv                nats.KeyValue
+}
+
+func (m *mockJetStream) KeyValue(string) (nats.KeyValue, error) {
+	return m.kv, nil
+}
+
+func (m *mockJetStream) StreamInfo(string, ...nats.JSOpt) (*nats.StreamInfo, error) {
+	return m.streamInfo, m.streamInfoErr
+}
+
+func (m *mockJetStream) AddStream(cfg *nats.StreamConfig, _ ...nats.JSOpt) (*nats.StreamInfo, error) {
+	m.addedStream = cfg
+
+	return &nats.StreamInfo{Config: *cfg}, nil
+}
+
+func (m *mockJetStream) ConsumerInfo(string, string, ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	return m.consumerInfo, m.consumerInfoErr
+}
+
+func (m *mockJetStream) AddConsumer(_ string, cfg *nats.ConsumerConfig, _ ...nats.JSOpt) (*nats.ConsumerInfo, error) {
+	m.addedConsumer = cfg
+
+	return &nats.ConsumerInfo{Config: *cfg}, nil
+}
+
+func (m *mockJetStream) DeleteConsumer(_, consumer string, _ ...nats.JSOpt) error {
+	m.deletedConsumer = consumer
+
+	return m.deleteConsumerErr
+}
+
+func (m *mockJetStream) StreamNameBySubject(string, ...nats.JSOpt) (string, error) {
+	return m.stream, m.streamErr
+}
+
+func (m *mockJetStream) ChanSubscribe(subj string, _ chan *nats.Msg, _ ...nats.SubOpt) (*nats.Subscription, error) {
+	m.chanSubscribed = subj
+
+	return &nats.Subscription{}, nil
+}
@@ -0,0 +1,245 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/nats-io/nats.go"
+)
+
+// kvSubjectPrefix is the prefix of the subjects KV entries are stored under,
+// followed by the bucket name and the key.
+const kvSubjectPrefix = "$KV."
+
+// KVIteratorParams contains incoming params for the NewKVIterator function.
+type KVIteratorParams struct {
+	// Bucket is the name of the KV bucket to watch.
+	Bucket string
+	// Keys is the key pattern to watch, it may contain wildcards, e.g. ">" watches all the keys.
+	Keys string
+	// SDKPosition is the position of the last record read from the bucket.
+	// Entries up to its revision are skipped.
+	SDKPosition opencdc.Position
+	// UpdatesOnly makes the watcher deliver only the changes made after it starts,
+	// without the current values of the keys.
+	UpdatesOnly bool
+	// IgnoreDeletes makes the watcher skip deleted and purged keys.
+	IgnoreDeletes bool
+}
+
+// KVIterator produces records from the changes of the keys in a KV bucket.
+// The watcher is backed by an ordered consumer, so entries don't need to be acknowledged.
+type KVIterator struct {
+	params  KVIteratorParams
+	watcher nats.KeyWatcher
+
+	// mu guards the fields below, as Stop may be called concurrently with reading.
+	mu sync.Mutex
+	// lastRevision is the revision of the last entry turned into a record.
+	// Entries up to it were already read before the connector restarted.
+	lastRevision uint64
+	// keys holds the keys known to exist, so puts can be told apart into creates and updates.
+	keys map[string]struct{}
+	// next is the entry received by WaitForNext which isn't returned by Next yet.
+	next nats.KeyValueEntry
+	// closed is set once the KVIterator is stopped.
+	closed bool
+}
+
+// NewKVIterator creates new instance of the KVIterator watching the bucket.
+func NewKVIterator(ctx context.Context, nc internal.NATSClient, params KVIteratorParams) (*KVIterator, error) {
+	position, err := parsePosition(params.SDKPosition)
+	if err != nil {
+		return nil, fmt.Errorf("parse position: %w", err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("get jetstream context: %w", err)
+	}
+
+	kv, err := js.KeyValue(params.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("get kv bucket %q: %w", params.Bucket, err)
+	}
+
+	var opts []nats.WatchOpt
+	if params.UpdatesOnly {
+		opts = append(opts, nats.UpdatesOnly())
+	}
+	if params.IgnoreDeletes {
+		opts = append(opts, nats.IgnoreDeletes())
+	}
+
+	watcher, err := kv.Watch(params.Keys, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("watch kv bucket %q: %w", params.Bucket, err)
+	}
+
+	sdk.Logger(ctx).Info().
+		Str("bucket", params.Bucket).
+		Str("keys", params.Keys).
+		Uint64("lastRevision", position.OptSeq).
+		Msg("watching kv bucket")
+
+	return &KVIterator{
+		params:       params,
+		watcher:      watcher,
+		lastRevision: position.OptSeq,
+		keys:         make(map[string]struct{}),
+	}, nil
+}
+
+// WaitForNext blocks until there's an entry to turn into a record or the ctx is done.
+// It returns ErrIteratorClosed if the KVIterator is stopped.
+func (i *KVIterator) WaitForNext(ctx context.Context) error {
+	for {
+		i.mu.Lock()
+		closed, ready := i.closed, i.next != nil
+		i.mu.Unlock()
+
+		switch {
+		case closed:
+			return ErrIteratorClosed
+		case ready:
+			return nil
+		}
+
+		// the updates are closed once the watcher is stopped
+		select {
+		case entry, ok := <-i.watcher.Updates():
+			if !ok {
+				return ErrIteratorClosed
+			}
+
+			// a nil entry marks the end of the initial values
+			if entry != nil {
+				i.receive(entry)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// receive makes the entry the next one to turn into a record, unless it was already
+// read before the connector restarted, in which case only its key is tracked.
+func (i *KVIterator) receive(entry nats.KeyValueEntry) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if entry.Revision() <= i.lastRevision {
+		i.trackKey(entry)
+
+		return
+	}
+
+	i.next = entry
+}
+
+// trackKey adds the key of the put entry to the known keys and removes the key of the deleted one.
+// The caller must hold the lock.
+func (i *KVIterator) trackKey(entry nats.KeyValueEntry) {
+	if entry.Operation() == nats.KeyValuePut {
+		i.keys[entry.Key()] = struct{}{}
+	} else {
+		delete(i.keys, entry.Key())
+	}
+}
+
+// Next returns the next record, waiting for it if there's none yet.
+func (i *KVIterator) Next(ctx context.Context) (opencdc.Record, error) {
+	if err := i.WaitForNext(ctx); err != nil {
+		return opencdc.Record{}, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// the iterator may have been stopped in the meantime
+	entry := i.next
+	if entry == nil {
+		return opencdc.Record{}, ErrIteratorClosed
+	}
+	i.next = nil
+
+	record, err := i.entryToRecord(entry)
+	if err != nil {
+		return opencdc.Record{}, err
+	}
+
+	i.trackKey(entry)
+	i.lastRevision = entry.Revision()
+
+	return record, nil
+}
+
+// entryToRecord converts a KV entry into a record. Puts of keys that aren't known to exist
+// yet become create records and the rest update records, deletes and purges become delete records.
+// The caller must hold the lock.
+func (i *KVIterator) entryToRecord(entry nats.KeyValueEntry) (opencdc.Record, error) {
+	position, err := position{
+		OptSeq:  entry.Revision(),
+		Subject: kvSubjectPrefix + entry.Bucket() + "." + entry.Key(),
+	}.marshalSDKPosition()
+	if err != nil {
+		return opencdc.Record{}, fmt.Errorf("marshal position: %w", err)
+	}
+
+	metadata := make(opencdc.Metadata)
+	metadata.SetCreatedAt(entry.Created())
+	metadata.SetCollection(entry.Bucket())
+
+	key := opencdc.RawData(entry.Key())
+
+	if entry.Operation() != nats.KeyValuePut {
+		return sdk.Util.Source.NewRecordDelete(position, metadata, key, nil), nil
+	}
+
+	if _, ok := i.keys[entry.Key()]; ok {
+		return sdk.Util.Source.NewRecordUpdate(position, metadata, key, nil, opencdc.RawData(entry.Value())), nil
+	}
+
+	return sdk.Util.Source.NewRecordCreate(position, metadata, key, opencdc.RawData(entry.Value())), nil
+}
+
+// Ack is a no-op, as the entries of a KV watcher aren't acknowledged.
+func (i *KVIterator) Ack(context.Context, opencdc.Position) error {
+	return nil
+}
+
+// Stop stops the watcher. Stopping a stopped KVIterator is a no-op.
+func (i *KVIterator) Stop() error {
+	i.mu.Lock()
+	closed := i.closed
+	i.closed = true
+	i.mu.Unlock()
+
+	if closed {
+		return nil
+	}
+
+	if err := i.watcher.Stop(); err != nil {
+		return fmt.Errorf("stop kv watcher: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+)
+
+func TestKVIterator_Next(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	watcher := newMockKeyWatcher(
+		&mockKVEntry{key: "a", value: "1", revision: 1, op: nats.KeyValuePut},
+		// the end of the initial values
+		nil,
+		&mockKVEntry{key: "a", value: "2", revision: 2, op: nats.KeyValuePut},
+		&mockKVEntry{key: "b", value: "3", revision: 3, op: nats.KeyValuePut},
+		&mockKVEntry{key: "a", revision: 4, op: nats.KeyValueDelete},
+		&mockKVEntry{key: "a", value: "5", revision: 5, op: nats.KeyValuePut},
+	)
+	i := &KVIterator{watcher: watcher, keys: make(map[string]struct{})}
+
+	want := []struct {
+		operation opencdc.Operation
+		key       string
+		after     opencdc.Data
+	}{
+		{operation: opencdc.OperationCreate, key: "a", after: opencdc.RawData("1")},
+		{operation: opencdc.OperationUpdate, key: "a", after: opencdc.RawData("2")},
+		{operation: opencdc.OperationCreate, key: "b", after: opencdc.RawData("3")},
+		{operation: opencdc.OperationDelete, key: "a"},
+		{operation: opencdc.OperationCreate, key: "a", after: opencdc.RawData("5")},
+	}
+
+	for n, w := range want {
+		record, err := i.Next(ctx)
+		is.NoErr(err)
+		is.Equal(record.Operation, w.operation)
+		is.Equal(record.Key, opencdc.RawData(w.key))
+		is.Equal(record.Payload.After, w.after)
+
+		collection, err := record.Metadata.GetCollection()
+		is.NoErr(err)
+		is.Equal(collection, "bucket")
+
+		pos, err := parsePosition(record.Position)
+		is.NoErr(err)
+		is.Equal(pos, position{OptSeq: uint64(n + 1), Subject: "$KV.bucket." + w.key})
+	}
+
+	// entries don't need to be acknowledged
+	is.NoErr(i.Ack(ctx, opencdc.Position(`{"opt_seq":1}`)))
+}
+
+func TestKVIterator_resume(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	watcher := newMockKeyWatcher(
+		&mockKVEntry{key: "a", value: "1", revision: 1, op: nats.KeyValuePut},
+		&mockKVEntry{key: "b", value: "2", revision: 2, op: nats.KeyValuePut},
+		nil,
+		&mockKVEntry{key: "a", value: "3", revision: 3, op: nats.KeyValuePut},
+	)
+	i := &KVIterator{watcher: watcher, keys: make(map[string]struct{}), lastRevision: 2}
+
+	// the entries read before the restart are skipped, but their keys are known to exist
+	record, err := i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(record.Operation, opencdc.OperationUpdate)
+	is.Equal(record.Key, opencdc.RawData("a"))
+	is.Equal(i.lastRevision, uint64(3))
+}
+
+func TestKVIterator_Stop(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	i := &KVIterator{watcher: newMockKeyWatcher(), keys: make(map[string]struct{})}
+
+	waitErr := make(chan error)
+	go func() {
+		waitErr <- i.WaitForNext(ctx)
+	}()
+
+	// stopping the iterator unblocks the waiting reader
+	time.Sleep(10 * time.Millisecond)
+	is.NoErr(i.Stop())
+	is.True(errors.Is(<-waitErr, ErrIteratorClosed))
+
+	// stopping again is a no-op
+	is.NoErr(i.Stop())
+
+	_, err := i.Next(ctx)
+	is.True(errors.Is(err, ErrIteratorClosed))
+}
+
+func TestNewKVIterator(t *testing.T) {
+	is := is.New(t)
+
+	kv := &mockKeyValue{watcher: newMockKeyWatcher()}
+	i, err := NewKVIterator(context.Background(), &mockNATSClient{js: &mockJetStream{kv: kv}}, KVIteratorParams{
+		Bucket:        "bucket",
+		Keys:          "orders.>",
+		SDKPosition:   opencdc.Position(`{"opt_seq":7}`),
+		UpdatesOnly:   true,
+		IgnoreDeletes: true,
+	})
+	is.NoErr(err)
+	is.Equal(i.lastRevision, uint64(7))
+	is.Equal(kv.watchedKeys, "orders.>")
+	is.Equal(kv.watchOpts, 2)
+}
+
+// mockKeyValue implements the KV methods used by tests, calling any other method panics.
+type mockKeyValue struct {
+	nats.KeyValue
+
+	watcher     nats.KeyWatcher
+	watchedKeys string
+	watchOpts   int
+}
+
+func (m *mockKeyValue) Watch(keys string, opts ...nats.WatchOpt) (nats.KeyWatcher, error) {
+	m.watchedKeys = keys
+	m.watchOpts = len(opts)
+
+	return m.watcher, nil
+}
+
+// mockKeyWatcher delivers the given entries and closes the updates once it's stopped.
+type mockKeyWatcher struct {
+	nats.KeyWatcher
+
+	updates chan nats.KeyValueEntry
+}
+
+func newMockKeyWatcher(entries ...nats.KeyValueEntry) *mockKeyWatcher {
+	updates := make(chan nats.KeyValueEntry, len(entries))
+	for _, entry := range entries {
+		updates <- entry
+	}
+
+	return &mockKeyWatcher{updates: updates}
+}
+
+func (m *mockKeyWatcher) Updates() <-chan nats.KeyValueEntry {
+	return m.updates
+}
+
+func (m *mockKeyWatcher) Stop() error {
+	close(m.updates)
+
+	return nil
+}
+
+// mockKVEntry is an entry of the "bucket" KV bucket.
+type mockKVEntry struct {
+	key      string
+	value    string
+	revision uint64
+	op       nats.KeyValueOp
+}
+
+func (e *mockKVEntry) Bucket() string             { return "bucket" }
+func (e *mockKVEntry) Key() string                { return e.key }
+func (e *mockKVEntry) Value() []byte              { return []byte(e.value) }
+func (e *mockKVEntry) Revision() uint64           { return e.revision }
+func (e *mockKVEntry) Created() time.Time         { return time.Unix(1700000000, 0) }
+func (e *mockKVEntry) Delta() uint64              { return 0 }
+func (e *mockKVEntry) Operation() nats.KeyValueOp { return e.op }
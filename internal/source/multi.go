@@ -0,0 +1,261 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// StreamParams identifies one of the streams consumed by a MultiIterator.
+type StreamParams struct {
+	// Stream is the name of the stream, it identifies the stream in the positions,
+	// so it must be unique.
+	Stream string
+	// Subject is the subject the consumer of the stream receives messages from.
+	Subject string
+	// Durable is the name of the consumer of the stream.
+	Durable string
+	// DeliverSubject is the deliver subject of a push consumer of the stream.
+	DeliverSubject string
+}
+
+// multiPosition is the position of a record read by the MultiIterator.
+// It holds the position of the last record read from every stream, so each of the streams
+// resumes where it left off after a restart, regardless of which stream the record came from.
+type multiPosition struct {
+	// Stream is the stream the record was read from.
+	Stream string `json:"stream"`
+	// Positions are the positions of the last records read from the streams by their names,
+	// including the position of this record.
+	Positions map[string]opencdc.Position `json:"positions"`
+}
+
+// parseMultiPosition converts an opencdc.Position into a multiPosition.
+func parseMultiPosition(sdkPosition opencdc.Position) (multiPosition, error) {
+	var p multiPosition
+
+	if len(sdkPosition) == 0 {
+		return p, nil
+	}
+
+	if err := json.Unmarshal(sdkPosition, &p); err != nil {
+		return multiPosition{}, fmt.Errorf("unmarshal opencdc.Position into multi-stream position: %w", err)
+	}
+
+	return p, nil
+}
+
+// MultiIterator consumes several streams, each using an Iterator of its own,
+// and multiplexes their records. Records are acknowledged by the Iterator they were read from.
+type MultiIterator struct {
+	// streams are the names of the streams consumed by the iterators at the same index.
+	streams []string
+	// mu guards the iterators, which are replaced after a reconnect.
+	mu        sync.RWMutex
+	iterators []*Iterator
+	// positions are the positions of the last records read from the streams.
+	positions map[string]opencdc.Position
+	// next is the index of the iterator whose records are read first by the next call to Next,
+	// so all the streams take turns.
+	next int
+}
+
+// NewMultiIterator creates an Iterator for each of the params.Streams, starting at its position,
+// the other params are shared by all of them.
+func NewMultiIterator(ctx context.Context, nc internal.NATSClient, params IteratorParams) (*MultiIterator, error) {
+	if len(params.Streams) == 0 {
+		return nil, errors.New("no streams to consume")
+	}
+
+	position, err := parseMultiPosition(params.SDKPosition)
+	if err != nil {
+		return nil, fmt.Errorf("parse position: %w", err)
+	}
+
+	m := &MultiIterator{
+		positions: make(map[string]opencdc.Position, len(params.Streams)),
+	}
+
+	for _, stream := range params.Streams {
+		if _, ok := m.positions[stream.Stream]; ok || stream.Stream == "" {
+			_ = m.Stop()
+
+			return nil, fmt.Errorf("stream %q must be unique and not empty", stream.Stream)
+		}
+		m.positions[stream.Stream] = position.Positions[stream.Stream]
+
+		iterator, err := NewIterator(ctx, nc, params.streamParams(stream, position.Positions[stream.Stream]))
+		if err != nil {
+			_ = m.Stop()
+
+			return nil, fmt.Errorf("init iterator of stream %q: %w", stream.Stream, err)
+		}
+
+		m.streams = append(m.streams, stream.Stream)
+		m.iterators = append(m.iterators, iterator)
+	}
+
+	return m, nil
+}
+
+// streamParams returns the params of the Iterator consuming one of the Streams from the sdkPosition.
+func (p IteratorParams) streamParams(stream StreamParams, sdkPosition opencdc.Position) IteratorParams {
+	p.Streams = nil
+	p.Stream = stream.Stream
+	p.Subject = stream.Subject
+	p.Durable = stream.Durable
+	p.DeliverSubject = stream.DeliverSubject
+	p.SDKPosition = sdkPosition
+
+	return p
+}
+
+// WaitForNext blocks until any of the iterators has a record or the ctx is done.
+func (m *MultiIterator) WaitForNext(ctx context.Context) error {
+	iterators := m.snapshot()
+	if m.ready(iterators) >= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(iterators))
+	for _, iterator := range iterators {
+		go func() {
+			errs <- iterator.WaitForNext(ctx)
+		}()
+	}
+
+	// the first iterator to return stops the others, whose messages received
+	// in the meantime are still available to Next
+	err := <-errs
+	cancel()
+
+	for range len(iterators) - 1 {
+		if otherErr := <-errs; err == nil && !errors.Is(otherErr, context.Canceled) {
+			err = otherErr
+		}
+	}
+
+	if m.ready(iterators) >= 0 {
+		return nil
+	}
+
+	return err
+}
+
+// ready returns the index of the first iterator, starting at the next one, which has
+// a record to return, or -1 if there's none.
+func (m *MultiIterator) ready(iterators []*Iterator) int {
+	for n := range iterators {
+		index := (m.next + n) % len(iterators)
+		if iterators[index].hasBuffered() {
+			return index
+		}
+	}
+
+	return -1
+}
+
+// Next returns the next record of the iterators, taking turns, with its position holding
+// the positions of all the streams. If none of them has a record it returns sdk.ErrBackoffRetry.
+func (m *MultiIterator) Next(ctx context.Context) (opencdc.Record, error) {
+	iterators := m.snapshot()
+
+	index := m.ready(iterators)
+	if index < 0 {
+		return opencdc.Record{}, sdk.ErrBackoffRetry
+	}
+	m.next = (index + 1) % len(iterators)
+
+	record, err := iterators[index].Next(ctx)
+	if err != nil {
+		return opencdc.Record{}, err
+	}
+
+	stream := m.streams[index]
+	m.positions[stream] = record.Position
+
+	record.Position, err = json.Marshal(multiPosition{
+		Stream:    stream,
+		Positions: maps.Clone(m.positions),
+	})
+	if err != nil {
+		return opencdc.Record{}, fmt.Errorf("marshal position: %w", err)
+	}
+
+	return record, nil
+}
+
+// Ack acknowledges the record at the position using the iterator of its stream.
+func (m *MultiIterator) Ack(ctx context.Context, sdkPosition opencdc.Position) error {
+	position, err := parseMultiPosition(sdkPosition)
+	if err != nil {
+		return fmt.Errorf("parse position: %w", err)
+	}
+
+	// the iterator isn't replaced while its records are acknowledged
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for n, stream := range m.streams {
+		if stream == position.Stream {
+			return m.iterators[n].Ack(ctx, position.Positions[stream])
+		}
+	}
+
+	return fmt.Errorf("position of unknown stream %q", position.Stream)
+}
+
+// Stop stops all the iterators.
+func (m *MultiIterator) Stop() error {
+	var errs []error
+	for n, iterator := range m.snapshot() {
+		if err := iterator.Stop(); err != nil {
+			errs = append(errs, fmt.Errorf("stop iterator of stream %q: %w", m.streams[n], err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// snapshot returns the current iterators.
+func (m *MultiIterator) snapshot() []*Iterator {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.iterators)
+}
+
+// replace replaces the iterator at the index with the resubscribed one after a reconnect,
+// which takes over the messages awaiting an acknowledgement.
+func (m *MultiIterator) replace(index int, resubscribed *Iterator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resubscribed.adoptPending(m.iterators[index])
+	m.iterators[index] = resubscribed
+}
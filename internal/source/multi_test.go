@@ -0,0 +1,195 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+)
+
+func TestMultiIterator_Next(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	newIterator := func(stream string, seqs ...string) *Iterator {
+		i := &Iterator{
+			params: IteratorParams{
+				Stream:       stream,
+				ConsumerType: ConsumerTypePush,
+				AckPolicy:    nats.AckNonePolicy,
+			},
+			messages: make(chan *nats.Msg, len(seqs)),
+		}
+
+		for _, seq := range seqs {
+			i.messages <- &nats.Msg{
+				Subject: stream,
+				Reply:   "$JS.ACK." + stream + ".consumer.1." + seq + ".1.1700000000000000000.0",
+				Sub:     &nats.Subscription{},
+			}
+		}
+
+		return i
+	}
+
+	m := &MultiIterator{
+		streams:   []string{"foo", "bar"},
+		iterators: []*Iterator{newIterator("foo", "1", "2"), newIterator("bar", "7")},
+		positions: map[string]opencdc.Position{},
+	}
+
+	// the streams take turns, until only one of them has records
+	var subjects []string
+	var last opencdc.Position
+	for range 3 {
+		is.NoErr(m.WaitForNext(ctx))
+
+		record, err := m.Next(ctx)
+		is.NoErr(err)
+
+		collection, err := record.Metadata.GetCollection()
+		is.NoErr(err)
+		subjects = append(subjects, collection)
+		last = record.Position
+	}
+	is.Equal(subjects, []string{"foo", "bar", "foo"})
+
+	_, err := m.Next(ctx)
+	is.Equal(err, sdk.ErrBackoffRetry)
+
+	// the position holds the positions of all the streams
+	position, err := parseMultiPosition(last)
+	is.NoErr(err)
+	is.Equal(position.Stream, "foo")
+	is.Equal(len(position.Positions), 2)
+
+	fooPosition, err := parsePosition(position.Positions["foo"])
+	is.NoErr(err)
+	is.Equal(fooPosition.OptSeq, uint64(2))
+
+	barPosition, err := parsePosition(position.Positions["bar"])
+	is.NoErr(err)
+	is.Equal(barPosition.OptSeq, uint64(7))
+
+	is.NoErr(m.Ack(ctx, last))
+}
+
+func TestMultiIterator_Ack(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	m := &MultiIterator{
+		streams: []string{"foo", "bar"},
+		iterators: []*Iterator{
+			{params: IteratorParams{AckPolicy: nats.AckNonePolicy}},
+			{params: IteratorParams{AckPolicy: nats.AckExplicitPolicy}, unackMessages: map[uint64]*nats.Msg{}},
+		},
+	}
+
+	position := func(stream string) opencdc.Position {
+		sdkPosition, err := json.Marshal(multiPosition{
+			Stream: stream,
+			Positions: map[string]opencdc.Position{
+				"foo": opencdc.Position(`{"opt_seq":1}`),
+				"bar": opencdc.Position(`{"opt_seq":1}`),
+			},
+		})
+		is.NoErr(err)
+
+		return sdkPosition
+	}
+
+	// the ack is routed to the iterator of the stream
+	is.NoErr(m.Ack(ctx, position("foo")))
+	is.True(m.Ack(ctx, position("bar")) != nil)
+
+	err := m.Ack(ctx, position("baz"))
+	is.Equal(err.Error(), `position of unknown stream "baz"`)
+}
+
+func TestParseMultiPosition(t *testing.T) {
+	is := is.New(t)
+
+	// every stream starts from its deliver policy on the first run
+	for _, sdkPosition := range []opencdc.Position{nil, {}} {
+		position, err := parseMultiPosition(sdkPosition)
+		is.NoErr(err)
+		is.Equal(position.Positions["foo"], nil)
+	}
+
+	_, err := parseMultiPosition(opencdc.Position(`{"stream":1}`))
+	is.True(err != nil)
+}
+
+func TestNewMultiIterator_invalidStreams(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	_, err := NewMultiIterator(ctx, nil, IteratorParams{})
+	is.Equal(err.Error(), "no streams to consume")
+
+	_, err = NewMultiIterator(ctx, nil, IteratorParams{
+		Streams: []StreamParams{{Stream: ""}},
+	})
+	is.Equal(err.Error(), `stream "" must be unique and not empty`)
+}
+
+func TestNewIterator_streams(t *testing.T) {
+	is := is.New(t)
+
+	_, err := NewIterator(context.Background(), nil, IteratorParams{
+		Subject: "foo",
+		Streams: []StreamParams{{Stream: "foo", Subject: "foo", Durable: "foo"}},
+	})
+	is.Equal(err.Error(), "multiple streams must be consumed by a MultiIterator")
+}
+
+func TestNewMultiIterator_sharedSubject(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	// both streams default to the Subject, which is captured only by the first one
+	params := IteratorParams{
+		Durable:       "durable",
+		Subject:       "orders.>",
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		ConsumerType:  ConsumerTypePull,
+		Ordered:       true,
+		Streams: []StreamParams{
+			{Stream: "orders", Subject: "orders.>", Durable: "durable-orders"},
+			{Stream: "payments", Subject: "orders.>", Durable: "durable-payments"},
+		},
+	}
+	nc := &mockNATSClient{js: &mockJetStream{
+		stream:     "orders",
+		streamInfo: &nats.StreamInfo{Config: nats.StreamConfig{Subjects: []string{"orders.>"}}},
+	}}
+
+	_, err := NewMultiIterator(ctx, nc, params)
+	is.True(errors.Is(err, ErrStreamMismatch))
+	is.Equal(err.Error(), `init iterator of stream "payments": subject "orders.>" is captured by the stream "orders" `+
+		`instead of the stream "payments": subject isn't captured by the stream`)
+
+	err = ValidateIterator(ctx, nc, params)
+	is.True(errors.Is(err, ErrStreamMismatch))
+}
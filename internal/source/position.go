@@ -25,6 +25,17 @@ import (
 type position struct {
 	// OptSeq is a position of a message in a stream.
 	OptSeq uint64 `json:"opt_seq"`
+	// ConsumerSeq is a position of a message in the consumer.
+	// It changes on every redelivery of the message.
+	ConsumerSeq uint64 `json:"consumer_seq,omitempty"`
+	// NumDelivered is the number of times the message has been delivered.
+	NumDelivered uint64 `json:"num_delivered,omitempty"`
+	// Subject is the concrete subject of a message,
+	// which may differ from the configured one if it contains wildcards or filter subjects are used.
+	Subject string `json:"subject,omitempty"`
+	// Advisory is the ID of the advisory a delete record was created from.
+	// Positions of delete records don't belong to any message, so they aren't acknowledged.
+	Advisory string `json:"advisory,omitempty"`
 }
 
 // marshalPosition marshals the underlying position into a opencdc.Position as JSON bytes.
@@ -38,10 +49,11 @@ func (p position) marshalSDKPosition() (opencdc.Position, error) {
 }
 
 // parsePosition converts an opencdc.Position into a position.
+// An empty position, e.g. on the first run of a pipeline, is a zero position.
 func parsePosition(sdkPosition opencdc.Position) (position, error) {
 	var p position
 
-	if sdkPosition == nil {
+	if len(sdkPosition) == 0 {
 		return p, nil
 	}
 
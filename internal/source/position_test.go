@@ -89,6 +89,21 @@ func Test_parsePosition(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "success, with consumer sequence and deliveries",
+			args: args{
+				sdkPosition: opencdc.Position([]byte(
+					`{"opt_seq":32,"consumer_seq":40,"num_delivered":2,"subject":"foo.bar"}`,
+				)),
+			},
+			want: position{
+				OptSeq:       32,
+				ConsumerSeq:  40,
+				NumDelivered: 2,
+				Subject:      "foo.bar",
+			},
+			wantErr: false,
+		},
 		{
 			name: "success, empty",
 			args: args{
@@ -111,6 +126,16 @@ func Test_parsePosition(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "success, position is empty",
+			args: args{
+				sdkPosition: opencdc.Position{},
+			},
+			want: position{
+				OptSeq: 0,
+			},
+			wantErr: false,
+		},
 		{
 			name: "fail, wrong field type",
 			args: args{
@@ -0,0 +1,300 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/nats-io/nats.go"
+)
+
+// PubSubIteratorParams contains incoming params for the NewPubSubIterator function.
+type PubSubIteratorParams struct {
+	// BufferSize is the capacity of the buffer holding the received messages until they're read.
+	// If it's zero the defaultBufferSize is used.
+	BufferSize int
+	// Subject is the subject to subscribe to, it may contain wildcards.
+	Subject string
+	// QueueGroup is the queue group of the subscription. Iterators subscribed with the same QueueGroup
+	// split the messages between each other. If it's empty every iterator receives all the messages.
+	QueueGroup string
+	// SDKPosition is the position of the last record read, the sequences of the new records continue after it.
+	SDKPosition opencdc.Position
+	// WALPath is the path of the write-ahead log keeping the read messages until they're acknowledged.
+	// If it's empty the messages aren't persisted, so the ones not acknowledged before the connector
+	// stops are lost.
+	WALPath string
+	// SubjectPrefix is the prefix the Subject is prepended with, it's removed from the record collection.
+	SubjectPrefix    string
+	PropagateHeaders bool
+	PayloadEncoding  string
+	// EnableTracing makes the PubSubIterator copy the trace context propagated in the message headers
+	// into the record metadata.
+	EnableTracing bool
+}
+
+// PubSubIterator produces records from the messages published to a core NATS subject.
+// Core NATS has no acknowledgements, so the messages are acknowledged only in the WAL, if there's one.
+type PubSubIterator struct {
+	params       PubSubIteratorParams
+	subscription *nats.Subscription
+	wal          *wal
+	// messages buffers the received messages until they're read.
+	messages chan *nats.Msg
+	// stop is closed once the PubSubIterator is stopped, releasing a handler waiting for a full buffer.
+	stop chan struct{}
+
+	// mu guards the fields below, as Stop may be called concurrently with reading.
+	mu sync.Mutex
+	// replay holds the messages read from the WAL which weren't acknowledged before the restart,
+	// they're returned before any received message.
+	replay []walEntry
+	// lastSeq is the sequence of the last record.
+	lastSeq uint64
+	// next is the message received by WaitForNext which isn't returned by Next yet.
+	next *nats.Msg
+	// closed is set once the PubSubIterator is stopped.
+	closed bool
+}
+
+// NewPubSubIterator creates new instance of the PubSubIterator subscribed to the subject.
+func NewPubSubIterator(
+	ctx context.Context,
+	nc internal.NATSClient,
+	params PubSubIteratorParams,
+) (*PubSubIterator, error) {
+	if err := internal.ValidateSubject(params.Subject, true); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case params.BufferSize < 0:
+		return nil, fmt.Errorf("buffer size %d can't be negative", params.BufferSize)
+	case params.BufferSize == 0:
+		params.BufferSize = defaultBufferSize
+	}
+
+	position, err := parsePosition(params.SDKPosition)
+	if err != nil {
+		return nil, fmt.Errorf("parse position: %w", err)
+	}
+
+	i := &PubSubIterator{
+		params:   params,
+		messages: make(chan *nats.Msg, params.BufferSize),
+		stop:     make(chan struct{}),
+		lastSeq:  position.OptSeq,
+	}
+
+	if params.WALPath != "" {
+		i.wal, i.replay, err = openWAL(params.WALPath)
+		if err != nil {
+			return nil, err
+		}
+
+		// the sequences continue after the replayed ones, so the positions keep increasing
+		if n := len(i.replay); n > 0 {
+			i.lastSeq = max(i.lastSeq, i.replay[n-1].Seq)
+		}
+	}
+
+	if params.QueueGroup != "" {
+		i.subscription, err = nc.QueueSubscribe(params.Subject, params.QueueGroup, i.receive)
+	} else {
+		i.subscription, err = nc.Subscribe(params.Subject, i.receive)
+	}
+	if err != nil {
+		if i.wal != nil {
+			_ = i.wal.close()
+		}
+
+		return nil, fmt.Errorf("subscribe to %q: %w", params.Subject, err)
+	}
+
+	sdk.Logger(ctx).Info().
+		Str("subject", params.Subject).
+		Str("queueGroup", params.QueueGroup).
+		Int("replayed", len(i.replay)).
+		Msg("subscribed to core NATS")
+
+	return i, nil
+}
+
+// receive buffers the message. It blocks while the buffer is full, so messages published
+// in the meantime pile up in the subscription until the client drops them as a slow consumer.
+func (i *PubSubIterator) receive(msg *nats.Msg) {
+	select {
+	case i.messages <- msg:
+	case <-i.stop:
+	}
+}
+
+// WaitForNext blocks until there's a message to turn into a record or the ctx is done.
+// It returns ErrIteratorClosed if the PubSubIterator is stopped.
+func (i *PubSubIterator) WaitForNext(ctx context.Context) error {
+	for {
+		i.mu.Lock()
+		closed, ready := i.closed, i.next != nil || len(i.replay) > 0
+		i.mu.Unlock()
+
+		switch {
+		case closed:
+			return ErrIteratorClosed
+		case ready:
+			return nil
+		}
+
+		select {
+		case msg := <-i.messages:
+			i.mu.Lock()
+			i.next = msg
+			i.mu.Unlock()
+		case <-i.stop:
+			return ErrIteratorClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Next returns the next record, waiting for it if there's none yet. The replayed messages
+// are returned first, a received message is written to the WAL before its record is returned.
+func (i *PubSubIterator) Next(ctx context.Context) (opencdc.Record, error) {
+	if err := i.WaitForNext(ctx); err != nil {
+		return opencdc.Record{}, err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(i.replay) > 0 {
+		entry := i.replay[0]
+		i.replay = i.replay[1:]
+
+		return i.entryToRecord(entry)
+	}
+
+	// the iterator may have been stopped in the meantime
+	msg := i.next
+	if msg == nil {
+		return opencdc.Record{}, ErrIteratorClosed
+	}
+
+	entry := walEntry{
+		Seq:      i.lastSeq + 1,
+		Subject:  msg.Subject,
+		Header:   msg.Header,
+		Data:     msg.Data,
+		Received: time.Now(),
+	}
+
+	// the message stays the next one if it can't be written
+	if i.wal != nil {
+		if err := i.wal.append(entry); err != nil {
+			return opencdc.Record{}, err
+		}
+	}
+
+	i.next = nil
+	i.lastSeq = entry.Seq
+
+	return i.entryToRecord(entry)
+}
+
+// entryToRecord converts a received message into a record. The caller must hold the lock.
+func (i *PubSubIterator) entryToRecord(entry walEntry) (opencdc.Record, error) {
+	position, err := position{OptSeq: entry.Seq, Subject: entry.Subject}.marshalSDKPosition()
+	if err != nil {
+		return opencdc.Record{}, fmt.Errorf("marshal position: %w", err)
+	}
+
+	payload, decompressed, err := decodePayload(entry.Header, i.params.PayloadEncoding, entry.Data)
+	if err != nil {
+		return opencdc.Record{}, fmt.Errorf("message on subject %q: %w", entry.Subject, err)
+	}
+
+	metadata := make(opencdc.Metadata)
+	metadata.SetCreatedAt(entry.Received)
+	metadata[internal.MetadataContentType] = contentType(entry.Header)
+	metadata.SetCollection(internal.TrimSubjectPrefix(i.params.SubjectPrefix, entry.Subject))
+
+	if i.params.PropagateHeaders {
+		for key, values := range entry.Header {
+			// the content encoding doesn't apply to the decompressed payload
+			if decompressed && key == internal.ContentEncodingHeader {
+				continue
+			}
+
+			metadata[internal.MetadataHeaderPrefix+key] = strings.Join(values, ",")
+		}
+	}
+
+	if i.params.EnableTracing {
+		internal.ExtractTrace(entry.Header, metadata)
+	}
+
+	return sdk.Util.Source.NewRecordCreate(position, metadata, nil, opencdc.RawData(payload)), nil
+}
+
+// Ack removes the message at the position from the WAL. It's a no-op if there's no WAL.
+func (i *PubSubIterator) Ack(_ context.Context, sdkPosition opencdc.Position) error {
+	if i.wal == nil {
+		return nil
+	}
+
+	position, err := parsePosition(sdkPosition)
+	if err != nil {
+		return fmt.Errorf("parse position: %w", err)
+	}
+
+	return i.wal.ack(position.OptSeq)
+}
+
+// Stop unsubscribes and closes the WAL, the messages which aren't acknowledged yet
+// are replayed after a restart. Stopping a stopped PubSubIterator is a no-op.
+func (i *PubSubIterator) Stop() error {
+	i.mu.Lock()
+	closed := i.closed
+	i.closed = true
+	i.mu.Unlock()
+
+	if closed {
+		return nil
+	}
+
+	close(i.stop)
+
+	var errs []error
+	// the subscription is gone with the closed connection
+	if err := i.subscription.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+		errs = append(errs, fmt.Errorf("unsubscribe: %w", err))
+	}
+
+	if i.wal != nil {
+		if err := i.wal.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,149 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+)
+
+func TestPubSubIterator_Next(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	nc := &mockNATSClient{}
+	i, err := NewPubSubIterator(ctx, nc, PubSubIteratorParams{
+		Subject:          "foo.*",
+		SDKPosition:      opencdc.Position(`{"opt_seq":41}`),
+		PropagateHeaders: true,
+	})
+	is.NoErr(err)
+
+	nc.handler(&nats.Msg{Subject: "foo.bar", Header: nats.Header{"Type": []string{"a"}}, Data: []byte("hello")})
+
+	record, err := i.Next(ctx)
+	is.NoErr(err)
+	// the sequence continues after the position
+	is.Equal(record.Position, opencdc.Position(`{"opt_seq":42,"subject":"foo.bar"}`))
+	is.Equal(record.Operation, opencdc.OperationCreate)
+	is.Equal(record.Payload.After, opencdc.RawData("hello"))
+	is.Equal(record.Metadata["nats.header.Type"], "a")
+
+	collection, err := record.Metadata.GetCollection()
+	is.NoErr(err)
+	is.Equal(collection, "foo.bar")
+
+	// there's nothing to acknowledge without the WAL
+	is.NoErr(i.Ack(ctx, record.Position))
+
+	is.NoErr(i.Stop())
+	is.True(errors.Is(i.WaitForNext(ctx), ErrIteratorClosed))
+	is.NoErr(i.Stop())
+}
+
+func TestPubSubIterator_queueGroup(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	nc := &mockNATSClient{}
+	i, err := NewPubSubIterator(ctx, nc, PubSubIteratorParams{Subject: "foo", QueueGroup: "workers"})
+	is.NoErr(err)
+	is.Equal(nc.queueGroup, "workers")
+
+	nc.handler(&nats.Msg{Subject: "foo", Data: []byte("hello")})
+
+	record, err := i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(record.Payload.After, opencdc.RawData("hello"))
+	is.NoErr(i.Stop())
+}
+
+func TestPubSubIterator_durability(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	params := PubSubIteratorParams{
+		Subject: "foo",
+		WALPath: filepath.Join(t.TempDir(), "wal"),
+	}
+
+	nc := &mockNATSClient{}
+	i, err := NewPubSubIterator(ctx, nc, params)
+	is.NoErr(err)
+
+	var positions []opencdc.Position
+	for _, data := range []string{"1", "2", "3"} {
+		nc.handler(&nats.Msg{Subject: "foo", Data: []byte(data)})
+
+		record, err := i.Next(ctx)
+		is.NoErr(err)
+		positions = append(positions, record.Position)
+	}
+
+	// the second message isn't acknowledged before the connector stops
+	is.NoErr(i.Ack(ctx, positions[0]))
+	is.NoErr(i.Ack(ctx, positions[2]))
+	is.NoErr(i.Stop())
+
+	params.SDKPosition = positions[2]
+	nc = &mockNATSClient{}
+	i, err = NewPubSubIterator(ctx, nc, params)
+	is.NoErr(err)
+
+	// the unacknowledged message is replayed before the received ones
+	nc.handler(&nats.Msg{Subject: "foo", Data: []byte("4")})
+
+	replayed, err := i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(replayed.Position, positions[1])
+	is.Equal(replayed.Payload.After, opencdc.RawData("2"))
+
+	received, err := i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(received.Position, opencdc.Position(`{"opt_seq":4,"subject":"foo"}`))
+	is.Equal(received.Payload.After, opencdc.RawData("4"))
+
+	// the WAL is truncated once all the messages are acknowledged
+	is.NoErr(i.Ack(ctx, replayed.Position))
+	is.NoErr(i.Ack(ctx, received.Position))
+
+	info, err := os.Stat(params.WALPath)
+	is.NoErr(err)
+	is.Equal(info.Size(), int64(0))
+
+	is.NoErr(i.Stop())
+}
+
+func TestReadWAL_truncatedEntry(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "wal")
+	err := os.WriteFile(path, []byte(`{"seq":1,"subject":"foo","data":"MQ=="}`+"\n"+`{"seq":2,"sub`), 0o600)
+	is.NoErr(err)
+
+	// the entry being written when the connector crashed is ignored
+	entries, err := readWAL(path)
+	is.NoErr(err)
+	is.Equal(len(entries), 1)
+	is.Equal(entries[0].Seq, uint64(1))
+	is.Equal(entries[0].Data, []byte("1"))
+}
@@ -16,7 +16,10 @@ package source
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/conduitio-labs/conduit-connector-nats-jetstream/internal"
 	"github.com/conduitio/conduit-commons/config"
@@ -25,13 +28,43 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+const (
+	// resubscribeMaxAttempts is the maximum number of attempts to re-subscribe after reconnecting.
+	resubscribeMaxAttempts = 8
+	// resubscribeInitialBackoff is the wait before the second attempt to re-subscribe,
+	// it doubles with every further attempt up to the resubscribeMaxBackoff.
+	resubscribeInitialBackoff = time.Second
+	resubscribeMaxBackoff     = 30 * time.Second
+)
+
 // Source operates source logic.
 type Source struct {
 	sdk.UnimplementedSource
 
-	config   Config
-	nc       internal.NATSClient
+	config Config
+	nc     internal.NATSClient
+	// mu guards the iterator, which is replaced after a reconnect.
+	mu       sync.RWMutex
 	iterator *Iterator
+	// kv is the iterator used instead of the iterator if the KVBucket is set.
+	kv *KVIterator
+	// pubsub is the iterator used instead of the iterator in the pubsub mode.
+	pubsub *PubSubIterator
+	// multi is the iterator used instead of the iterator if the Streams are set.
+	multi *MultiIterator
+
+	// resubscribeMu makes the resubscriptions after consecutive reconnects run one after another.
+	resubscribeMu sync.Mutex
+	// resubscribing tracks the running resubscriptions, which are canceled by the stopResubscribe.
+	resubscribing   sync.WaitGroup
+	stopResubscribe context.CancelFunc
+}
+
+// recordIterator produces the records read by the Source.
+type recordIterator interface {
+	WaitForNext(ctx context.Context) error
+	Next(ctx context.Context) (opencdc.Record, error)
+	Ack(ctx context.Context, position opencdc.Position) error
 }
 
 // NewSource creates new instance of the Source.
@@ -67,18 +100,28 @@ func (s *Source) Open(ctx context.Context, position opencdc.Position) error {
 	if err != nil {
 		return fmt.Errorf("connect to NATS: %w", err)
 	}
-	s.nc = conn
-
-	s.iterator, err = NewIterator(ctx, s.nc, IteratorParams{
-		BufferSize:     s.config.BufferSize,
-		Stream:         s.config.Stream,
-		Durable:        s.config.Durable,
-		DeliverSubject: s.config.DeliverSubject,
-		Subject:        s.config.Subject,
-		SDKPosition:    position,
-		DeliverPolicy:  s.config.NATSDeliverPolicy(),
-		AckPolicy:      s.config.NATSAckPolicy(),
-	})
+	s.nc = internal.WithJetStreamOptions(conn, internal.JetStreamOptions(s.config.Config)...)
+
+	if s.config.KVBucket != "" {
+		return s.openKV(ctx, conn, position)
+	}
+
+	if s.config.Mode == modePubSub {
+		return s.openPubSub(ctx, conn, position)
+	}
+
+	params := s.iteratorParams(position)
+	if s.config.ValidateOnOpen {
+		if err := ValidateIterator(ctx, s.nc, params); err != nil {
+			return err
+		}
+	}
+
+	if len(params.Streams) > 0 {
+		s.multi, err = NewMultiIterator(ctx, s.nc, params)
+	} else {
+		s.iterator, err = NewIterator(ctx, s.nc, params)
+	}
 	if err != nil {
 		return fmt.Errorf("init jetstream iterator: %w", err)
 	}
@@ -86,12 +129,16 @@ func (s *Source) Open(ctx context.Context, position opencdc.Position) error {
 	// Async handlers & callbacks
 	conn.SetErrorHandler(internal.ErrorHandlerCallback(ctx))
 	conn.SetDisconnectErrHandler(internal.DisconnectErrCallback(ctx, func(*nats.Conn) {
-		if err := s.iterator.unAckAll(); err != nil {
-			sdk.Logger(ctx).Error().Err(err).Send()
+		for _, iterator := range s.jetstreamIterators() {
+			if err := iterator.unAckAll(); err != nil {
+				sdk.Logger(ctx).Error().Err(err).Send()
+			}
 		}
 	}))
+	resubscribeCtx, cancel := context.WithCancel(ctx)
+	s.stopResubscribe = cancel
 	conn.SetReconnectHandler(internal.ReconnectCallback(ctx, func(*nats.Conn) {
-		s.iterator, err = NewIterator(ctx, conn, s.iterator.params)
+		s.resubscribeAsync(resubscribeCtx, s.nc)
 	}))
 	conn.SetClosedHandler(internal.ClosedCallback(ctx))
 	conn.SetDiscoveredServersHandler(internal.DiscoveredServersCallback(ctx))
@@ -99,14 +146,310 @@ func (s *Source) Open(ctx context.Context, position opencdc.Position) error {
 	return nil
 }
 
+// iteratorParams returns the IteratorParams based on the config, starting at the position.
+func (s *Source) iteratorParams(position opencdc.Position) IteratorParams {
+	// the start time is validated by ParseConfig
+	startTime, _ := s.config.NATSStartTime()
+
+	return IteratorParams{
+		BufferSize:              s.config.BufferSize,
+		Stream:                  s.config.Stream,
+		Durable:                 s.config.Durable,
+		DeliverSubject:          s.config.DeliverSubject,
+		Subject:                 internal.PrefixSubject(s.config.SubjectPrefix, s.config.Subject),
+		SDKPosition:             position,
+		DeliverPolicy:           s.config.NATSDeliverPolicy(),
+		StartSeq:                s.config.StartSequence,
+		StartTime:               startTime,
+		AckPolicy:               s.config.NATSAckPolicy(),
+		AckSync:                 s.config.AckSync,
+		AckMode:                 AckMode(s.config.AckMode),
+		ReplayPolicy:            s.config.ReplayPolicy,
+		ConsumerType:            ConsumerType(s.config.ConsumerType),
+		Ordered:                 s.config.Ordered,
+		RateLimit:               s.config.RateLimit,
+		Heartbeat:               s.config.Heartbeat,
+		AckWait:                 s.config.AckWait,
+		MaxDeliver:              s.config.MaxDeliver,
+		BackOff:                 s.config.BackOff,
+		MaxAckPending:           s.config.MaxAckPending,
+		FetchBatchSize:          s.config.FetchBatchSize,
+		FetchMaxWait:            s.config.FetchMaxWait,
+		FilterSubjects:          s.filterSubjects(),
+		MatchSubject:            s.config.MatchSubject,
+		MatchHeader:             s.config.MatchHeader,
+		MaxMessageAge:           s.config.MaxMessageAge,
+		SubjectPrefix:           s.config.SubjectPrefix,
+		PropagateHeaders:        s.config.PropagateHeaders,
+		EnableTracing:           s.config.EnableTracing,
+		SourcePositionMetadata:  s.config.SourcePositionMetadata,
+		BeforeHeader:            s.config.BeforeHeader,
+		KeySource:               s.config.KeySource,
+		LegacyRecordFormat:      s.config.LegacyRecordFormat,
+		PayloadEncoding:         s.config.PayloadEncoding,
+		TrackDeletes:            s.config.TrackDeletes,
+		APIPrefix:               internal.JetStreamAPIPrefix(s.config.Config),
+		BindOnly:                s.config.BindOnly,
+		HeadersOnly:             s.config.HeadersOnly,
+		DeleteConsumerOnStop:    s.config.DeleteConsumerOnStop,
+		ResetOnStart:            s.config.ResetOnStart,
+		AutoCreateStream:        s.config.AutoCreateStream,
+		StreamSubjects:          s.config.StreamSubjects,
+		StreamRetention:         s.config.NATSRetentionPolicy(),
+		StreamStorage:           s.config.NATSStorageType(),
+		StreamMaxAge:            s.config.StreamMaxAge,
+		StreamDuplicateWindow:   s.config.StreamDuplicateWindow,
+		StreamMaxMsgsPerSubject: s.config.StreamMaxMsgsPerSubject,
+		StreamMaxBytes:          s.config.StreamMaxBytes,
+		Streams:                 s.streams(),
+	}
+}
+
+// streams returns the Streams with their subjects prepended with the SubjectPrefix.
+func (s *Source) streams() []StreamParams {
+	streams := s.config.NATSStreams()
+	for i := range streams {
+		streams[i].Subject = internal.PrefixSubject(s.config.SubjectPrefix, streams[i].Subject)
+	}
+
+	return streams
+}
+
+// filterSubjects returns the FilterSubjects prepended with the SubjectPrefix.
+func (s *Source) filterSubjects() []string {
+	if len(s.config.FilterSubjects) == 0 {
+		return nil
+	}
+
+	subjects := make([]string, len(s.config.FilterSubjects))
+	for n, subject := range s.config.FilterSubjects {
+		subjects[n] = internal.PrefixSubject(s.config.SubjectPrefix, subject)
+	}
+
+	return subjects
+}
+
+// jetstreamIterators returns the iterators consuming JetStream, the iterator or the ones of the multi.
+func (s *Source) jetstreamIterators() []*Iterator {
+	if s.multi != nil {
+		return s.multi.snapshot()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return []*Iterator{s.iterator}
+}
+
+// resubscribeAsync runs the resubscribe on its own goroutine, as its retries can take minutes,
+// which mustn't block the NATS client's callbacks. It's canceled and awaited by Teardown.
+func (s *Source) resubscribeAsync(ctx context.Context, nc internal.NATSClient) {
+	s.resubscribing.Add(1)
+	go func() {
+		defer s.resubscribing.Done()
+
+		s.resubscribe(ctx, nc)
+	}()
+}
+
+// resubscribe re-creates the iterators after the connection is re-established if they're pull
+// consumers, or if their consumers are gone, e.g. after a full cluster restart. The NATS client
+// re-establishes the subscriptions of existing push consumers and of ordered consumers on its own.
+// The re-created iterators take over the messages awaiting an acknowledgement from the replaced ones.
+func (s *Source) resubscribe(ctx context.Context, nc internal.NATSClient) {
+	s.resubscribeMu.Lock()
+	defer s.resubscribeMu.Unlock()
+
+	if s.multi != nil {
+		for n, iterator := range s.multi.snapshot() {
+			if resubscribed := s.resubscribeIterator(ctx, nc, iterator); resubscribed != nil {
+				s.multi.replace(n, resubscribed)
+			}
+		}
+
+		return
+	}
+
+	// the iterator is replaced only here, under the resubscribeMu
+	if resubscribed := s.resubscribeIterator(ctx, nc, s.iterator); resubscribed != nil {
+		s.mu.Lock()
+		resubscribed.adoptPending(s.iterator)
+		s.iterator = resubscribed
+		s.mu.Unlock()
+	}
+}
+
+// resubscribeIterator returns a new iterator replacing the iterator, or nil if it's kept.
+// Failed attempts are retried with an exponential backoff, as the cluster may not be ready yet.
+func (s *Source) resubscribeIterator(ctx context.Context, nc internal.NATSClient, iterator *Iterator) *Iterator {
+	if iterator.params.Ordered {
+		return nil
+	}
+
+	backoff := resubscribeInitialBackoff
+	for attempt := 1; ; attempt++ {
+		resubscribed, err := s.tryResubscribe(ctx, nc, iterator)
+		if err == nil {
+			return resubscribed
+		}
+
+		if attempt == resubscribeMaxAttempts || nc.IsClosed() {
+			sdk.Logger(ctx).Error().Err(err).
+				Int("attempt", attempt).
+				Msg("failed to re-subscribe after reconnecting, giving up")
+
+			return nil
+		}
+
+		sdk.Logger(ctx).Warn().Err(err).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Msg("failed to re-subscribe after reconnecting, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		}
+
+		backoff = min(2*backoff, resubscribeMaxBackoff)
+	}
+}
+
+// tryResubscribe returns a new iterator continuing where the iterator left off,
+// or nil if it's a push consumer which still exists.
+func (s *Source) tryResubscribe(ctx context.Context, nc internal.NATSClient, iterator *Iterator) (*Iterator, error) {
+	exists, err := iterator.consumerExists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists && iterator.params.ConsumerType == ConsumerTypePush {
+		return nil, nil
+	}
+
+	sdk.Logger(ctx).Info().
+		Bool("consumer_exists", exists).
+		Str("durable", iterator.params.Durable).
+		Msg("re-subscribing after reconnecting")
+
+	if err := iterator.detach(); err != nil {
+		sdk.Logger(ctx).Warn().Err(err).Msg("failed to detach the previous iterator")
+	}
+
+	resubscribed, err := NewIterator(ctx, nc, iterator.resumeParams())
+	if err != nil {
+		return nil, fmt.Errorf("init jetstream iterator: %w", err)
+	}
+
+	return resubscribed, nil
+}
+
+// openKV initializes the iterator watching the KVBucket.
+func (s *Source) openKV(ctx context.Context, conn *nats.Conn, position opencdc.Position) error {
+	var err error
+
+	s.kv, err = NewKVIterator(ctx, s.nc, KVIteratorParams{
+		Bucket:        s.config.KVBucket,
+		Keys:          s.config.Subject,
+		SDKPosition:   position,
+		UpdatesOnly:   s.config.KVUpdatesOnly,
+		IgnoreDeletes: s.config.KVIgnoreDeletes,
+	})
+	if err != nil {
+		return fmt.Errorf("init kv iterator: %w", err)
+	}
+
+	// the watcher's ordered consumer is recreated by the NATS client on its own
+	setLoggingCallbacks(ctx, conn)
+
+	return nil
+}
+
+// pubSubIteratorParams returns the PubSubIteratorParams based on the config, starting at the position.
+func (s *Source) pubSubIteratorParams(position opencdc.Position) PubSubIteratorParams {
+	params := PubSubIteratorParams{
+		BufferSize:       s.config.BufferSize,
+		Subject:          internal.PrefixSubject(s.config.SubjectPrefix, s.config.Subject),
+		QueueGroup:       s.config.QueueGroup,
+		SubjectPrefix:    s.config.SubjectPrefix,
+		SDKPosition:      position,
+		PropagateHeaders: s.config.PropagateHeaders,
+		EnableTracing:    s.config.EnableTracing,
+		PayloadEncoding:  s.config.PayloadEncoding,
+	}
+	if s.config.Durability {
+		params.WALPath = s.config.WALPath
+	}
+
+	return params
+}
+
+// openPubSub initializes the iterator subscribed to the Subject on core NATS.
+func (s *Source) openPubSub(ctx context.Context, conn *nats.Conn, position opencdc.Position) error {
+	var err error
+
+	s.pubsub, err = NewPubSubIterator(ctx, conn, s.pubSubIteratorParams(position))
+	if err != nil {
+		return fmt.Errorf("init pubsub iterator: %w", err)
+	}
+
+	// core NATS subscriptions are re-established by the NATS client on its own
+	setLoggingCallbacks(ctx, conn)
+
+	return nil
+}
+
+// setLoggingCallbacks sets the connection handlers which only log the events.
+func setLoggingCallbacks(ctx context.Context, conn *nats.Conn) {
+	conn.SetErrorHandler(internal.ErrorHandlerCallback(ctx))
+	conn.SetDisconnectErrHandler(internal.DisconnectErrCallback(ctx, func(*nats.Conn) {}))
+	conn.SetReconnectHandler(internal.ReconnectCallback(ctx, func(*nats.Conn) {}))
+	conn.SetClosedHandler(internal.ClosedCallback(ctx))
+	conn.SetDiscoveredServersHandler(internal.DiscoveredServersCallback(ctx))
+}
+
+// records returns the iterator the records are read from. The caller must hold the mu.
+func (s *Source) records() recordIterator {
+	if s.kv != nil {
+		return s.kv
+	}
+
+	if s.pubsub != nil {
+		return s.pubsub
+	}
+
+	if s.multi != nil {
+		return s.multi
+	}
+
+	return s.iterator
+}
+
 // Read fetches a record from an iterator.
-// If there's no record will return sdk.ErrBackoffRetry.
+// It blocks until there's a record or the ctx is done.
+// If the iterator fails to receive messages it returns sdk.ErrBackoffRetry.
 func (s *Source) Read(ctx context.Context) (opencdc.Record, error) {
-	if !s.iterator.HasNext(ctx) {
+	s.mu.RLock()
+	records := s.records()
+	s.mu.RUnlock()
+
+	if err := records.WaitForNext(ctx); err != nil {
+		if ctx.Err() != nil {
+			return opencdc.Record{}, ctx.Err()
+		}
+
+		// retrying wouldn't help, the connector has to be restarted to re-create the consumer
+		if errors.Is(err, ErrConsumerDeleted) {
+			return opencdc.Record{}, err
+		}
+
+		sdk.Logger(ctx).Error().Err(err).Msg("wait for next message")
+
 		return opencdc.Record{}, sdk.ErrBackoffRetry
 	}
 
-	record, err := s.iterator.Next(ctx)
+	record, err := records.Next(ctx)
 	if err != nil {
 		return opencdc.Record{}, fmt.Errorf("read next record: %w", err)
 	}
@@ -115,21 +458,59 @@ func (s *Source) Read(ctx context.Context) (opencdc.Record, error) {
 }
 
 // Ack acknowledges a message at the given position.
-func (s *Source) Ack(_ context.Context, position opencdc.Position) error {
-	return s.iterator.Ack(position)
+func (s *Source) Ack(ctx context.Context, position opencdc.Position) error {
+	// the iterator isn't replaced while its records are acknowledged
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.records().Ack(ctx, position)
 }
 
 // Teardown closes connections, stops iterator.
-func (s *Source) Teardown(context.Context) error {
-	if s.iterator != nil {
-		if err := s.iterator.Stop(); err != nil {
+func (s *Source) Teardown(ctx context.Context) error {
+	if s.stopResubscribe != nil {
+		s.stopResubscribe()
+	}
+	s.resubscribing.Wait()
+
+	if err := s.stop(); err != nil {
+		if !s.config.IgnoreStopErrors {
 			return fmt.Errorf("stop source: %w", err)
 		}
+
+		sdk.Logger(ctx).Warn().Err(err).Msg("failed to stop the source, ignoring the error")
 	}
 
 	if s.nc != nil {
-		// closing nats connection
-		s.nc.Close()
+		// draining lets the in-flight acknowledgements complete before the connection is closed
+		if err := internal.DrainConn(ctx, s.nc); err != nil {
+			return fmt.Errorf("drain connection: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// stop stops the iterator, the KV watcher, the core NATS subscriber or the iterators of the multiple
+// streams, whichever is open.
+func (s *Source) stop() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.iterator != nil {
+		return s.iterator.Stop()
+	}
+
+	if s.kv != nil {
+		return s.kv.Stop()
+	}
+
+	if s.pubsub != nil {
+		return s.pubsub.Stop()
+	}
+
+	if s.multi != nil {
+		return s.multi.Stop()
 	}
 
 	return nil
@@ -21,6 +21,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -130,6 +132,242 @@ func TestSource_Read_JetStream_backoffRetry(t *testing.T) {
 	}
 }
 
+func TestSource_Read_JetStream_deliverNew(t *testing.T) {
+	stream, subject := "mystreamdelivernew", "foo_new"
+
+	testConn, err := test.GetTestConnection()
+	if err != nil {
+		t.Fatalf("get test connection: %v", err)
+	}
+	t.Cleanup(testConn.Close)
+
+	if err := test.CreateTestStream(testConn, stream, []string{subject}); err != nil {
+		t.Fatalf("create test stream: %v", err)
+	}
+
+	js, err := testConn.JetStream()
+	if err != nil {
+		t.Fatalf("get jetstream context: %v", err)
+	}
+
+	// the message published before the first run is never read
+	if _, err := js.Publish(subject, []byte("old")); err != nil {
+		t.Fatalf("publish message: %v", err)
+	}
+
+	openSource := func(position opencdc.Position) sdk.Source {
+		source := NewSource()
+		err := source.Configure(context.Background(), map[string]string{
+			ConfigUrls:          test.TestURL,
+			ConfigSubject:       subject,
+			ConfigStream:        stream,
+			ConfigDeliverPolicy: "new",
+		})
+		if err != nil {
+			t.Fatalf("configure source: %v", err)
+		}
+
+		if err := source.Open(context.Background(), position); err != nil {
+			t.Fatalf("open source: %v", err)
+		}
+
+		return source
+	}
+
+	source := openSource(nil)
+
+	if _, err := js.Publish(subject, []byte("new")); err != nil {
+		t.Fatalf("publish message: %v", err)
+	}
+
+	record := readTestRecord(t, source)
+	if got := string(record.Payload.After.Bytes()); got != "new" {
+		t.Fatalf("Source.Read payload = %q, want %q", got, "new")
+	}
+
+	if err := source.Teardown(context.Background()); err != nil {
+		t.Fatalf("teardown source: %v", err)
+	}
+
+	// a restart continues after the position instead of skipping the messages published in the meantime
+	if _, err := js.Publish(subject, []byte("newer")); err != nil {
+		t.Fatalf("publish message: %v", err)
+	}
+
+	source = openSource(record.Position)
+	t.Cleanup(func() {
+		if err := source.Teardown(context.Background()); err != nil {
+			t.Errorf("teardown source: %v", err)
+		}
+	})
+
+	record = readTestRecord(t, source)
+	if got := string(record.Payload.After.Bytes()); got != "newer" {
+		t.Fatalf("Source.Read payload = %q, want %q", got, "newer")
+	}
+}
+
+func TestSource_Read_JetStream_consumerDeleted(t *testing.T) {
+	stream, subject, durable := "mystreamconsumerdeleted", "foo_deleted", "deleted"
+
+	testConn, err := test.GetTestConnection()
+	if err != nil {
+		t.Fatalf("get test connection: %v", err)
+	}
+	t.Cleanup(testConn.Close)
+
+	if err := test.CreateTestStream(testConn, stream, []string{subject}); err != nil {
+		t.Fatalf("create test stream: %v", err)
+	}
+
+	source := &Source{}
+	err = source.Configure(context.Background(), map[string]string{
+		ConfigUrls:         test.TestURL,
+		ConfigSubject:      subject,
+		ConfigStream:       stream,
+		ConfigDurable:      durable,
+		ConfigConsumerType: "push",
+	})
+	if err != nil {
+		t.Fatalf("configure source: %v", err)
+	}
+
+	if err := source.Open(context.Background(), nil); err != nil {
+		t.Fatalf("open source: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = source.Teardown(context.Background())
+	})
+
+	// don't wait for the default interval
+	source.iterator.checkInterval = 100 * time.Millisecond
+
+	js, err := testConn.JetStream()
+	if err != nil {
+		t.Fatalf("get jetstream context: %v", err)
+	}
+
+	if err := js.DeleteConsumer(stream, durable); err != nil {
+		t.Fatalf("delete consumer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = source.Read(ctx)
+	if !errors.Is(err, ErrConsumerDeleted) {
+		t.Fatalf("Source.Read error = %v, want %v", err, ErrConsumerDeleted)
+	}
+}
+
+// readTestRecord reads the next record from the source, retrying while there's none yet.
+func readTestRecord(t *testing.T, source sdk.Source) opencdc.Record {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for {
+		record, err := source.Read(ctx)
+		if errors.Is(err, sdk.ErrBackoffRetry) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("read message: %v", err)
+		}
+
+		return record
+	}
+}
+
+func TestPubSubIterator_queueGroup_loadBalancing(t *testing.T) {
+	const (
+		subject  = "foo_queue_group"
+		messages = 100
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// two iterators in the same queue group, each with its own connection
+	received := make(chan string, messages*2)
+	counts := make([]int, 2)
+	var wg sync.WaitGroup
+	for n := range counts {
+		conn, err := test.GetTestConnection()
+		if err != nil {
+			t.Fatalf("get test connection: %v", err)
+		}
+		t.Cleanup(conn.Close)
+
+		i, err := NewPubSubIterator(ctx, conn, PubSubIteratorParams{Subject: subject, QueueGroup: "workers"})
+		if err != nil {
+			t.Fatalf("create iterator: %v", err)
+		}
+		t.Cleanup(func() { _ = i.Stop() })
+
+		// make sure the subscription is registered before publishing
+		if err := conn.Flush(); err != nil {
+			t.Fatalf("flush: %v", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				record, err := i.Next(ctx)
+				if err != nil {
+					return
+				}
+
+				counts[n]++
+				received <- string(record.Payload.After.Bytes())
+			}
+		}()
+	}
+
+	testConn, err := test.GetTestConnection()
+	if err != nil {
+		t.Fatalf("get test connection: %v", err)
+	}
+	t.Cleanup(testConn.Close)
+
+	for n := range messages {
+		if err := testConn.Publish(subject, []byte(strconv.Itoa(n))); err != nil {
+			t.Fatalf("publish message: %v", err)
+		}
+	}
+
+	// every message is received exactly once
+	seen := make(map[string]bool)
+	for len(seen) < messages {
+		select {
+		case payload := <-received:
+			if seen[payload] {
+				t.Fatalf("message %s received twice", payload)
+			}
+			seen[payload] = true
+		case <-ctx.Done():
+			t.Fatalf("received %d of %d messages", len(seen), messages)
+		}
+	}
+
+	// wait for any duplicates still in flight
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	if len(received) != 0 {
+		t.Fatalf("received %d duplicate messages", len(received))
+	}
+
+	// the messages are split between both iterators
+	if counts[0] == 0 || counts[1] == 0 {
+		t.Fatalf("messages are not load-balanced: %v", counts)
+	}
+}
+
 func createTestJetStream(stream, subject string) (sdk.Source, error) {
 	source := NewSource()
 	err := source.Configure(context.Background(), map[string]string{
@@ -0,0 +1,231 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+)
+
+func TestSource_resubscribe(t *testing.T) {
+	params := IteratorParams{
+		BufferSize:     1024,
+		Stream:         "stream",
+		Durable:        "durable",
+		DeliverSubject: "durable.deliver",
+		Subject:        "foo",
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		AckPolicy:      nats.AckExplicitPolicy,
+		ConsumerType:   ConsumerTypePush,
+	}
+
+	t.Run("push consumer exists", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{stream: "stream", consumerInfo: &nats.ConsumerInfo{}}
+		iterator := &Iterator{jetstream: js, stream: "stream", params: params}
+		s := &Source{iterator: iterator}
+
+		s.resubscribe(context.Background(), &mockNATSClient{js: js})
+
+		// the NATS client re-establishes the subscription on its own
+		is.Equal(s.iterator, iterator)
+		is.Equal(js.addedConsumer, nil)
+	})
+
+	t.Run("push consumer is gone", func(t *testing.T) {
+		is := is.New(t)
+
+		js := &mockJetStream{
+			stream:          "stream",
+			consumerInfoErr: nats.ErrConsumerNotFound,
+			streamInfo:      &nats.StreamInfo{},
+		}
+		iterator := &Iterator{jetstream: js, stream: "stream", params: params}
+		iterator.lastSeq.Store(41)
+		s := &Source{iterator: iterator}
+
+		s.resubscribe(context.Background(), &mockNATSClient{js: js})
+
+		// the consumer is re-created, continuing after the last read message
+		is.True(s.iterator != iterator)
+		is.True(js.addedConsumer != nil)
+		is.Equal(js.addedConsumer.Durable, "durable")
+		is.Equal(js.addedConsumer.DeliverPolicy, nats.DeliverByStartSequencePolicy)
+		is.Equal(js.addedConsumer.OptStartSeq, uint64(42))
+		is.Equal(js.chanSubscribed, "foo")
+	})
+
+	t.Run("ordered consumer", func(t *testing.T) {
+		is := is.New(t)
+
+		iterator := &Iterator{params: IteratorParams{Ordered: true}}
+		s := &Source{iterator: iterator}
+
+		s.resubscribe(context.Background(), &mockNATSClient{})
+
+		// the NATS client re-creates ordered consumers on its own
+		is.Equal(s.iterator, iterator)
+	})
+}
+
+func TestSource_resubscribe_whileReading(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	js := &mockJetStream{stream: "stream", consumerInfoErr: nats.ErrConsumerNotFound, streamInfo: &nats.StreamInfo{}}
+	nc := &mockNATSClient{js: js}
+	iterator := &Iterator{
+		nc:     nc,
+		stream: "stream",
+		params: IteratorParams{
+			BufferSize:     1024,
+			Stream:         "stream",
+			Durable:        "durable",
+			DeliverSubject: "durable.deliver",
+			Subject:        "foo",
+			DeliverPolicy:  nats.DeliverAllPolicy,
+			AckPolicy:      nats.AckExplicitPolicy,
+			ConsumerType:   ConsumerTypePush,
+		},
+		jetstream:     js,
+		messages:      make(chan *nats.Msg, 1),
+		unackMessages: map[uint64]*nats.Msg{1: {}},
+		detached:      make(chan struct{}),
+	}
+	s := &Source{iterator: iterator}
+
+	// the records are read and acknowledged while the connector resubscribes
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			readCtx, cancel := context.WithTimeout(ctx, time.Millisecond)
+			_, _ = s.Read(readCtx)
+			cancel()
+
+			_ = s.Ack(ctx, opencdc.Position(`{"opt_seq":2}`))
+			_ = s.jetstreamIterators()
+		}
+	}()
+
+	s.resubscribeAsync(ctx, nc)
+	s.resubscribing.Wait()
+	close(done)
+	wg.Wait()
+
+	s.mu.RLock()
+	resubscribed := s.iterator
+	s.mu.RUnlock()
+
+	// the replaced iterator releases its readers
+	is.True(resubscribed != iterator)
+	is.True(errors.Is(iterator.WaitForNext(ctx), ErrIteratorClosed))
+
+	// and hands over the message awaiting an acknowledgement
+	is.Equal(len(iterator.unackMessages), 0)
+	_, ok := resubscribed.unackMessages[1]
+	is.True(ok)
+}
+
+func TestSource_Teardown_stopsResubscribe(t *testing.T) {
+	is := is.New(t)
+
+	// the consumer info keeps failing, so the resubscription is retried
+	js := &mockJetStream{stream: "stream", consumerInfoErr: nats.ErrTimeout}
+	s := &Source{iterator: &Iterator{
+		jetstream:     js,
+		stream:        "stream",
+		params:        IteratorParams{Durable: "durable", ConsumerType: ConsumerTypePull},
+		unackMessages: map[uint64]*nats.Msg{},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopResubscribe = cancel
+	s.resubscribeAsync(ctx, &mockNATSClient{js: js})
+
+	start := time.Now()
+	is.NoErr(s.Teardown(context.Background()))
+	is.True(time.Since(start) < resubscribeInitialBackoff)
+}
+
+func TestSource_pubSubIteratorParams(t *testing.T) {
+	is := is.New(t)
+
+	s := &Source{config: Config{
+		Mode:       modePubSub,
+		QueueGroup: "workers",
+		Durability: true,
+		WALPath:    "wal",
+	}}
+	s.config.Subject = "foo"
+
+	params := s.pubSubIteratorParams(nil)
+	is.Equal(params.Subject, "foo")
+	is.Equal(params.QueueGroup, "workers")
+	is.Equal(params.WALPath, "wal")
+}
+
+func TestSource_Teardown_ignoreStopErrors(t *testing.T) {
+	is := is.New(t)
+
+	server := startTestServer(t)
+
+	nc, err := nats.Connect(server.addr)
+	is.NoErr(err)
+	defer nc.Close()
+
+	newSource := func() *Source {
+		sub, err := nc.SubscribeSync("foo")
+		is.NoErr(err)
+
+		return &Source{iterator: &Iterator{
+			params: IteratorParams{
+				Durable:              "durable",
+				ConsumerType:         ConsumerTypePull,
+				AckPolicy:            nats.AckExplicitPolicy,
+				DeleteConsumerOnStop: true,
+			},
+			jetstream:     &mockJetStream{deleteConsumerErr: nats.ErrTimeout},
+			stream:        "stream",
+			subscription:  sub,
+			unackMessages: map[uint64]*nats.Msg{},
+		}}
+	}
+
+	s := newSource()
+	err = s.Teardown(context.Background())
+	is.True(errors.Is(err, nats.ErrTimeout))
+
+	s = newSource()
+	s.config.IgnoreStopErrors = true
+	is.NoErr(s.Teardown(context.Background()))
+}
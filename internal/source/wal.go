@@ -0,0 +1,226 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// walEntry is a line of the write-ahead log. It's either a received message,
+// or an acknowledgement of the message with the Seq.
+type walEntry struct {
+	Seq      uint64      `json:"seq"`
+	Subject  string      `json:"subject,omitempty"`
+	Header   nats.Header `json:"header,omitempty"`
+	Data     []byte      `json:"data,omitempty"`
+	Received time.Time   `json:"received"`
+	Ack      bool        `json:"ack,omitempty"`
+}
+
+// wal is a write-ahead log of the messages received from core NATS, which are kept
+// in it until they're acknowledged, so they can be replayed after a restart.
+// The entries are written to the file without syncing it, so they survive a crash
+// of the connector, but not necessarily one of the operating system.
+type wal struct {
+	mu   sync.Mutex
+	file *os.File
+	// pending holds the sequences of the messages which aren't acknowledged yet.
+	pending map[uint64]struct{}
+}
+
+// openWAL opens the write-ahead log at the path, creating it if it doesn't exist.
+// It returns the messages which weren't acknowledged before the log was closed, in the order
+// they were received, and compacts the log so it contains only them.
+func openWAL(path string) (*wal, []walEntry, error) {
+	unacked, err := readWAL(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := compactWAL(path, unacked); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open wal: %w", err)
+	}
+
+	w := &wal{
+		file:    file,
+		pending: make(map[uint64]struct{}, len(unacked)),
+	}
+	for _, entry := range unacked {
+		w.pending[entry.Seq] = struct{}{}
+	}
+
+	return w, unacked, nil
+}
+
+// readWAL returns the messages of the log at the path which aren't acknowledged.
+// A truncated last entry, left by a crash while writing it, is ignored, as the record
+// of its message wasn't returned yet.
+func readWAL(path string) ([]walEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	defer file.Close()
+
+	var (
+		entries []walEntry
+		acked   = make(map[uint64]struct{})
+		decoder = json.NewDecoder(file)
+	)
+
+	for {
+		var entry walEntry
+
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read wal %q: %w", path, err)
+		}
+
+		if entry.Ack {
+			acked[entry.Seq] = struct{}{}
+
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	unacked := entries[:0]
+	for _, entry := range entries {
+		if _, ok := acked[entry.Seq]; !ok {
+			unacked = append(unacked, entry)
+		}
+	}
+
+	return unacked, nil
+}
+
+// compactWAL replaces the log at the path with one containing only the entries.
+// The new log is written next to the old one first, so a crash doesn't lose either.
+func compactWAL(path string, entries []walEntry) error {
+	tmpPath := path + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("create compacted wal: %w", err)
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+
+			return fmt.Errorf("write compacted wal: %w", err)
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+
+		return fmt.Errorf("sync compacted wal: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close compacted wal: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("replace wal: %w", err)
+	}
+
+	return nil
+}
+
+// append writes the received message to the log.
+func (w *wal) append(entry walEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.write(entry); err != nil {
+		return err
+	}
+	w.pending[entry.Seq] = struct{}{}
+
+	return nil
+}
+
+// ack marks the message with the seq as acknowledged. Once there are no pending messages
+// left the log is truncated, so it doesn't grow indefinitely. Acknowledging a message
+// which isn't pending is a no-op.
+func (w *wal) ack(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.pending[seq]; !ok {
+		return nil
+	}
+	delete(w.pending, seq)
+
+	if len(w.pending) == 0 {
+		// the file is opened in the append mode, so the next entry is written at its start
+		if err := w.file.Truncate(0); err != nil {
+			return fmt.Errorf("truncate wal: %w", err)
+		}
+
+		return nil
+	}
+
+	return w.write(walEntry{Seq: seq, Ack: true})
+}
+
+// write appends the entry to the file. The caller must hold the lock.
+func (w *wal) write(entry walEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal wal entry: %w", err)
+	}
+
+	if _, err := w.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write wal entry: %w", err)
+	}
+
+	return nil
+}
+
+// close closes the log file, the pending messages are replayed once it's opened again.
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("close wal: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidSubject is returned when a subject doesn't have a valid NATS subject syntax.
+var ErrInvalidSubject = errors.New("invalid subject")
+
+// ValidateSubject checks that the subject consists of non-empty dot-separated tokens without whitespace.
+// If allowWildcards is set, a token may be a "*" wildcard and the last token may be a ">" wildcard,
+// otherwise wildcards are rejected.
+func ValidateSubject(subject string, allowWildcards bool) error {
+	if subject == "" {
+		return fmt.Errorf("%w: subject is empty", ErrInvalidSubject)
+	}
+
+	tokens := strings.Split(subject, ".")
+	for n, token := range tokens {
+		var reason string
+
+		switch {
+		case token == "":
+			reason = "is empty"
+		case strings.ContainsFunc(token, unicode.IsSpace):
+			reason = "contains whitespace"
+		case token == "*" || token == ">":
+			if !allowWildcards {
+				reason = "is a wildcard, which isn't allowed"
+			} else if token == ">" && n != len(tokens)-1 {
+				reason = `is a ">" wildcard, which must be the last token`
+			}
+		case strings.ContainsAny(token, "*>"):
+			reason = "contains a wildcard, which must be a whole token"
+		}
+
+		if reason != "" {
+			return fmt.Errorf("%w %q: token %d %q %s", ErrInvalidSubject, subject, n+1, token, reason)
+		}
+	}
+
+	return nil
+}
+
+// PrefixSubject prepends the prefix to the subject, separated by a dot.
+// The subject is returned as it is if the prefix is empty.
+func PrefixSubject(prefix, subject string) string {
+	if prefix == "" {
+		return subject
+	}
+
+	return prefix + "." + subject
+}
+
+// TrimSubjectPrefix removes the prefix prepended by PrefixSubject from the subject.
+// The subject is returned as it is if it doesn't start with the prefix.
+func TrimSubjectPrefix(prefix, subject string) string {
+	if prefix == "" {
+		return subject
+	}
+
+	return strings.TrimPrefix(subject, prefix+".")
+}
@@ -0,0 +1,100 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestValidateSubject(t *testing.T) {
+	tests := []struct {
+		name           string
+		subject        string
+		allowWildcards bool
+		wantErr        string
+	}{
+		{name: "literal", subject: "orders.eu.123"},
+		{name: "wildcards", subject: "orders.*.>", allowWildcards: true},
+		{
+			name:    "empty",
+			subject: "",
+			wantErr: "invalid subject: subject is empty",
+		},
+		{
+			name:    "empty token",
+			subject: "orders..123",
+			wantErr: `invalid subject "orders..123": token 2 "" is empty`,
+		},
+		{
+			name:    "trailing dot",
+			subject: "orders.",
+			wantErr: `invalid subject "orders.": token 2 "" is empty`,
+		},
+		{
+			name:    "whitespace",
+			subject: "orders.eu west",
+			wantErr: `invalid subject "orders.eu west": token 2 "eu west" contains whitespace`,
+		},
+		{
+			name:           "partial wildcard",
+			subject:        "orders.eu*",
+			allowWildcards: true,
+			wantErr: `invalid subject "orders.eu*": token 2 "eu*" contains a wildcard, ` +
+				`which must be a whole token`,
+		},
+		{
+			name:           "full wildcard not last",
+			subject:        "orders.>.123",
+			allowWildcards: true,
+			wantErr: `invalid subject "orders.>.123": token 2 ">" is a ">" wildcard, ` +
+				`which must be the last token`,
+		},
+		{
+			name:    "wildcards not allowed",
+			subject: "orders.*",
+			wantErr: `invalid subject "orders.*": token 2 "*" is a wildcard, which isn't allowed`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+
+			err := ValidateSubject(tt.subject, tt.allowWildcards)
+			if tt.wantErr == "" {
+				is.NoErr(err)
+
+				return
+			}
+			is.True(errors.Is(err, ErrInvalidSubject))
+			is.Equal(err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestPrefixSubject(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(PrefixSubject("", "foo.bar"), "foo.bar")
+	is.Equal(PrefixSubject("tenant", "foo.bar"), "tenant.foo.bar")
+
+	is.Equal(TrimSubjectPrefix("", "tenant.foo.bar"), "tenant.foo.bar")
+	is.Equal(TrimSubjectPrefix("tenant", "tenant.foo.bar"), "foo.bar")
+	// only a whole token is removed
+	is.Equal(TrimSubjectPrefix("tenant", "tenants.foo.bar"), "tenants.foo.bar")
+}
@@ -0,0 +1,100 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Propagator returns the global OpenTelemetry text map propagator, which can be replaced
+// using otel.SetTextMapPropagator, or the W3C trace context propagator if none was set.
+func Propagator() propagation.TextMapPropagator {
+	propagator := otel.GetTextMapPropagator()
+	// the default global propagator doesn't propagate anything
+	if len(propagator.Fields()) == 0 {
+		return propagation.TraceContext{}
+	}
+
+	return propagator
+}
+
+// HeaderCarrier adapts NATS message headers to the propagation.TextMapCarrier interface.
+// Unlike the propagation.HeaderCarrier it keeps the keys as they are, as NATS headers
+// are case-sensitive, so e.g. the W3C "traceparent" header stays lowercase.
+type HeaderCarrier nats.Header
+
+// Get returns the first value of the header with the key.
+func (c HeaderCarrier) Get(key string) string {
+	return nats.Header(c).Get(key)
+}
+
+// Set sets the header with the key to the value.
+func (c HeaderCarrier) Set(key, value string) {
+	c[key] = []string{value}
+}
+
+// Keys returns the keys of the headers.
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// MetadataCarrier adapts record metadata to the propagation.TextMapCarrier interface.
+type MetadataCarrier opencdc.Metadata
+
+// Get returns the value of the metadata field with the key.
+func (c MetadataCarrier) Get(key string) string {
+	return c[key]
+}
+
+// Set sets the metadata field with the key to the value.
+func (c MetadataCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys returns the keys of the metadata fields.
+func (c MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// ExtractTrace copies the trace context propagated in the message headers, if any,
+// into the record metadata, so processors following the source continue the trace.
+func ExtractTrace(header nats.Header, metadata opencdc.Metadata) {
+	propagator := Propagator()
+	ctx := propagator.Extract(context.Background(), HeaderCarrier(header))
+	propagator.Inject(ctx, MetadataCarrier(metadata))
+}
+
+// InjectTrace writes the trace context into the message headers. The trace context held
+// by the record metadata, e.g. extracted by a source, takes precedence over the span of the ctx.
+func InjectTrace(ctx context.Context, metadata opencdc.Metadata, header nats.Header) {
+	propagator := Propagator()
+	ctx = propagator.Extract(ctx, MetadataCarrier(metadata))
+	propagator.Inject(ctx, HeaderCarrier(header))
+}
@@ -0,0 +1,71 @@
+// Copyright © 2025 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestInjectTrace(t *testing.T) {
+	is := is.New(t)
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	is.NoErr(err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	is.NoErr(err)
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	// the span of the context is used if the record has no trace context
+	header := make(nats.Header)
+	InjectTrace(ctx, opencdc.Metadata{}, header)
+	is.Equal(header.Get("traceparent"), testTraceparent)
+
+	// the trace context of the record takes precedence
+	otherTraceparent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	header = make(nats.Header)
+	InjectTrace(ctx, opencdc.Metadata{"traceparent": otherTraceparent}, header)
+	is.Equal(header.Get("traceparent"), otherTraceparent)
+
+	// nothing is written without a trace context
+	header = make(nats.Header)
+	InjectTrace(context.Background(), opencdc.Metadata{}, header)
+	is.Equal(len(header), 0)
+}
+
+func TestExtractTrace(t *testing.T) {
+	is := is.New(t)
+
+	metadata := make(opencdc.Metadata)
+	ExtractTrace(nats.Header{"traceparent": []string{testTraceparent}}, metadata)
+	is.Equal(metadata, opencdc.Metadata{"traceparent": testTraceparent})
+
+	// an invalid trace context is dropped
+	metadata = make(opencdc.Metadata)
+	ExtractTrace(nats.Header{"traceparent": []string{"invalid"}}, metadata)
+	is.Equal(len(metadata), 0)
+}